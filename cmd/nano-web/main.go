@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+
+	"github.com/compliance-framework/portal/nanoweb"
+)
+
+func main() {
+	if nanoweb.RunCommand(os.Args[1:]) {
+		return
+	}
+	nanoweb.Serve()
+}
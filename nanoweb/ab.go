@@ -0,0 +1,152 @@
+package nanoweb
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	mathrand "math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const abCookie = "nano_ab"
+
+// Splits visitors between variant subdirectories of the site. Each visitor
+// is assigned a bucket kept in a signed cookie, and HTML is served from that
+// bucket's directory when it has the page.
+type ABTest struct {
+	Variants []string
+	Weights  []int
+
+	secret []byte
+	total  int
+}
+
+var abTest = getABTest()
+
+func getABTest() *ABTest {
+	variants := []string{}
+	for _, variant := range strings.Split(getEnv("AB_VARIANTS", ""), ",") {
+		if variant = strings.Trim(strings.TrimSpace(variant), "/"); variant != "" {
+			variants = append(variants, variant)
+		}
+	}
+	if len(variants) == 0 {
+		return nil
+	}
+	test := &ABTest{Variants: variants, Weights: make([]int, len(variants))}
+	split := strings.Split(getEnv("AB_SPLIT", ""), ",")
+	for i := range variants {
+		test.Weights[i] = 1
+		if i < len(split) && strings.TrimSpace(split[i]) != "" {
+			weight, err := strconv.Atoi(strings.TrimSpace(split[i]))
+			if err != nil || weight < 0 {
+				configError("invalid AB_SPLIT weight %q", split[i])
+				return nil
+			}
+			test.Weights[i] = weight
+		}
+		test.total += test.Weights[i]
+	}
+	if test.total == 0 {
+		configError("AB_SPLIT gives every variant a weight of 0")
+		return nil
+	}
+	if secret := getEnv("AB_SECRET", ""); secret != "" {
+		test.secret = []byte(secret)
+	} else {
+		// Buckets won't survive a restart, or be shared between replicas
+		logln("⇨ AB_SECRET not set, using a random key")
+		test.secret = make([]byte, 32)
+		rand.Read(test.secret)
+	}
+	return test
+}
+
+func (test *ABTest) sign(variant string) string {
+	return variant + "." + hex.EncodeToString(hmacSHA256(test.secret, variant)[:16])
+}
+
+// The variant in a signed cookie, if it's valid and still being tested
+func (test *ABTest) verify(value string) string {
+	variant, _, found := strings.Cut(value, ".")
+	if !found || !hmac.Equal([]byte(test.sign(variant)), []byte(value)) {
+		return ""
+	}
+	for _, candidate := range test.Variants {
+		if candidate == variant {
+			return variant
+		}
+	}
+	return ""
+}
+
+func (test *ABTest) pick() string {
+	n := mathrand.Intn(test.total)
+	for i, weight := range test.Weights {
+		if n < weight {
+			return test.Variants[i]
+		}
+		n -= weight
+	}
+	return test.Variants[len(test.Variants)-1]
+}
+
+// Assign the request to a bucket, setting the cookie for new visitors
+func (test *ABTest) Assign(ctx *fasthttp.RequestCtx) string {
+	ctx.Response.Header.Add("Vary", "Cookie")
+	if variant := test.verify(string(ctx.Request.Header.Cookie(abCookie))); variant != "" {
+		return variant
+	}
+	variant := test.pick()
+	cookie := fasthttp.AcquireCookie()
+	cookie.SetKey(abCookie)
+	cookie.SetValue(test.sign(variant))
+	cookie.SetPath("/")
+	cookie.SetHTTPOnly(true)
+	cookie.SetSameSite(fasthttp.CookieSameSiteLaxMode)
+	ctx.Response.Header.SetCookie(cookie)
+	fasthttp.ReleaseCookie(cookie)
+	return variant
+}
+
+// Swap in the bucket's copy of an HTML page, if it has one. Only pages are
+// bucketed, so assets and misses are sent without the cookie or Vary: Cookie
+// and stay cacheable.
+func (test *ABTest) Select(ctx *fasthttp.RequestCtx, routes Routes, path string, route Route, exists bool) (Route, bool) {
+	if exists && route.ContentType != "text/html" || !exists && !test.hasVariant(routes, path) {
+		return route, exists
+	}
+	variant := test.Assign(ctx)
+	ctx.Response.Header.Set("X-AB-Bucket", variant)
+	if variantRoute, ok := routes["/"+variant+path]; ok && variantRoute.ContentType == "text/html" {
+		return variantRoute, true
+	}
+	return route, exists
+}
+
+// Whether any bucket has an HTML page at path
+func (test *ABTest) hasVariant(routes Routes, path string) bool {
+	for _, variant := range test.Variants {
+		if route, ok := routes["/"+variant+path]; ok && route.ContentType == "text/html" {
+			return true
+		}
+	}
+	return false
+}
+
+// The bucket a file belongs to, available to templates as .Bucket
+func (test *ABTest) bucketFor(name string) string {
+	if test == nil {
+		return ""
+	}
+	dir, _, _ := strings.Cut(name, "/")
+	for _, variant := range test.Variants {
+		if variant == dir {
+			return variant
+		}
+	}
+	return ""
+}
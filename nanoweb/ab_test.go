@@ -0,0 +1,51 @@
+package nanoweb
+
+import (
+	"strings"
+	"testing"
+)
+
+// Only pages are bucketed, so assets and misses don't get the cookie or
+// vary on it
+func TestABOnlyPages(t *testing.T) {
+	testSite(t, map[string]string{
+		"index.html":   "home",
+		"b/index.html": "home b",
+		"b/only.html":  "only b",
+		"app.js":       "app",
+		"404.html":     "not found",
+	})
+	previous := abTest
+	abTest = &ABTest{Variants: []string{"a", "b"}, Weights: []int{0, 1}, secret: []byte("secret"), total: 1}
+	t.Cleanup(func() { abTest = previous })
+
+	tests := []struct {
+		uri      string
+		status   int
+		body     string
+		bucketed bool
+	}{
+		{"/", 200, "home b", true},
+		{"/only.html", 200, "only b", true},
+		{"/app.js", 200, "app", false},
+		{"/missing", 404, "not found", false},
+		{"/missing.js", 404, "not found", false},
+	}
+	for _, test := range tests {
+		ctx := serve(test.uri)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.uri, status, test.status)
+		}
+		if test.body != "" && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s: body %q, want %q", test.uri, ctx.Response.Body(), test.body)
+		}
+		cookie := string(ctx.Response.Header.PeekCookie(abCookie))
+		vary := false
+		for _, value := range ctx.Response.Header.PeekAll("Vary") {
+			vary = vary || strings.Contains(string(value), "Cookie")
+		}
+		if (cookie != "") != test.bucketed || vary != test.bucketed {
+			t.Errorf("%s: cookie %q, Vary: Cookie %v, want bucketed %v", test.uri, cookie, vary, test.bucketed)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// ACCESS_LOG_FORMAT=ecs replaces the request log line with an Elastic Common
+// Schema document per request, so it can be shipped to Elasticsearch or
+// OpenSearch as is
+var accessLogFormat = getEnv("ACCESS_LOG_FORMAT", "text")
+
+type ecsAccessLog struct {
+	Timestamp string `json:"@timestamp"`
+	Message   string `json:"message"`
+	ECS       struct {
+		Version string `json:"version"`
+	} `json:"ecs"`
+	Log struct {
+		Level string `json:"level"`
+	} `json:"log"`
+	Event struct {
+		Kind     string `json:"kind"`
+		Category string `json:"category"`
+		Duration int64  `json:"duration"`
+	} `json:"event"`
+	HTTP struct {
+		Request struct {
+			Method   string `json:"method"`
+			Referrer string `json:"referrer,omitempty"`
+		} `json:"request"`
+		Response struct {
+			StatusCode int `json:"status_code"`
+			Body       struct {
+				Bytes int `json:"bytes"`
+			} `json:"body"`
+		} `json:"response"`
+		Version string `json:"version"`
+	} `json:"http"`
+	URL struct {
+		Domain string `json:"domain,omitempty"`
+		Path   string `json:"path"`
+		Query  string `json:"query,omitempty"`
+	} `json:"url"`
+	Client struct {
+		IP  string  `json:"ip"`
+		Geo *ecsGeo `json:"geo,omitempty"`
+		AS  *ecsAS  `json:"as,omitempty"`
+	} `json:"client"`
+	UserAgent struct {
+		Original string `json:"original,omitempty"`
+	} `json:"user_agent"`
+}
+
+type ecsGeo struct {
+	CountryISOCode string `json:"country_iso_code"`
+}
+
+type ecsAS struct {
+	Number       uint `json:"number"`
+	Organization struct {
+		Name string `json:"name,omitempty"`
+	} `json:"organization"`
+}
+
+func logECSAccess(ctx *fasthttp.RequestCtx, start time.Time, duration time.Duration) {
+	var entry ecsAccessLog
+	entry.Timestamp = start.UTC().Format(time.RFC3339Nano)
+	entry.ECS.Version = "8.11.0"
+	entry.Log.Level = "info"
+	entry.Event.Kind = "event"
+	entry.Event.Category = "web"
+	entry.Event.Duration = duration.Nanoseconds()
+	entry.HTTP.Request.Method = string(ctx.Method())
+	entry.HTTP.Request.Referrer = string(ctx.Referer())
+	entry.HTTP.Response.StatusCode = ctx.Response.StatusCode()
+	entry.HTTP.Response.Body.Bytes = responseSize(ctx)
+	entry.HTTP.Version = "1.1"
+	if !ctx.Request.Header.IsHTTP11() {
+		entry.HTTP.Version = "1.0"
+	}
+	entry.URL.Domain = string(ctx.Host())
+	if host, _, err := net.SplitHostPort(entry.URL.Domain); err == nil {
+		entry.URL.Domain = host
+	}
+	entry.URL.Path = string(ctx.Path())
+	entry.URL.Query = string(ctx.URI().QueryString())
+	entry.Client.IP = logIP(ctx.RemoteIP())
+	entry.UserAgent.Original = logUserAgent(string(ctx.UserAgent()))
+	if geo, ok := requestGeo(ctx); ok {
+		if geo.Country != "" {
+			entry.Client.Geo = &ecsGeo{CountryISOCode: geo.Country}
+		}
+		if geo.ASN != 0 {
+			entry.Client.AS = &ecsAS{Number: geo.ASN}
+			entry.Client.AS.Organization.Name = geo.Org
+		}
+	}
+	entry.Message = fmt.Sprintf("%s %s %d", entry.HTTP.Request.Method, entry.URL.Path, entry.HTTP.Response.StatusCode)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	logOutput.Write(append(line, '\n'))
+}
@@ -0,0 +1,58 @@
+package nanoweb
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/pprofhandler"
+)
+
+var adminToken = getEnv("ADMIN_TOKEN", "")
+
+// Where the built-in endpoints are served when they're kept off the public
+// listener. Set from the server's AdminAddr.
+var adminAddr string
+
+// The admin listener serves the built-in endpoints and pprof, and nothing
+// else
+func adminHandler(ctx *fasthttp.RequestCtx) {
+	site := siteForHost(string(ctx.Host()))
+	path := string(ctx.Path())
+	if builtinHandler(ctx, site, site.Table(), path) {
+		return
+	}
+	if strings.HasPrefix(path, "/debug/pprof/") {
+		pprofhandler.PprofHandler(ctx)
+		return
+	}
+	ctx.Error("Not Found", fasthttp.StatusNotFound)
+}
+
+// Check for an `Authorization: Bearer` token, in constant time
+func bearerAuthorized(ctx *fasthttp.RequestCtx, token string) bool {
+	if token == "" {
+		return false
+	}
+	given, found := strings.CutPrefix(string(ctx.Request.Header.Peek("Authorization")), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+func unauthorized(ctx *fasthttp.RequestCtx) {
+	ctx.Error("Unauthorized", fasthttp.StatusUnauthorized)
+	ctx.Response.Header.Set("WWW-Authenticate", "Bearer")
+	auditDenied(ctx, "bearer_token")
+}
+
+func writeJSON(ctx *fasthttp.RequestCtx, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		ctx.Error("Internal Server Error", fasthttp.StatusInternalServerError)
+		return
+	}
+	ctx.Response.Header.Set("Content-Type", "application/json")
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	ctx.SetStatusCode(status)
+	ctx.SetBody(body)
+}
@@ -0,0 +1,185 @@
+package nanoweb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Watches the rate of 5xx and 404 responses over a rolling window and POSTs
+// ALERT_WEBHOOK_URL when either goes over its threshold, so broken deploys
+// get noticed without external monitoring. Built-in /__ endpoints don't count.
+type Alerts struct {
+	URL          string
+	Slack        bool
+	Window       time.Duration
+	ErrorRate    float64
+	NotFoundRate float64
+	MinRequests  int
+	Cooldown     time.Duration
+
+	mu      sync.Mutex
+	buckets []alertBucket
+	alerts  map[string]*alertState
+	client  *http.Client
+}
+
+// Counts for one second of the window
+type alertBucket struct {
+	second   int64
+	total    int
+	errors   int
+	notFound int
+}
+
+type alertState struct {
+	firing bool
+	sent   time.Time
+}
+
+type Alert struct {
+	Alert     string  `json:"alert"`
+	Rate      float64 `json:"rate"`
+	Threshold float64 `json:"threshold"`
+	Requests  int     `json:"requests"`
+	Window    string  `json:"window"`
+	DeployID  string  `json:"deployId"`
+}
+
+func getAlerts() *Alerts {
+	url := getEnv("ALERT_WEBHOOK_URL", "")
+	if url == "" {
+		return nil
+	}
+	alerts := &Alerts{
+		URL:          url,
+		Slack:        getEnv("ALERT_FORMAT", "") == "slack" || strings.Contains(url, "hooks.slack.com"),
+		Window:       getAlertDuration("ALERT_WINDOW", "1m"),
+		ErrorRate:    getAlertRate("ALERT_ERROR_RATE", "5"),
+		NotFoundRate: getAlertRate("ALERT_NOT_FOUND_RATE", "20"),
+		Cooldown:     getAlertDuration("ALERT_COOLDOWN", "10m"),
+		alerts:       map[string]*alertState{"error_rate": {}, "not_found_rate": {}},
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+	minRequests, err := strconv.Atoi(getEnv("ALERT_MIN_REQUESTS", "20"))
+	if err != nil || minRequests < 1 {
+		configError("invalid ALERT_MIN_REQUESTS %q", getEnv("ALERT_MIN_REQUESTS", ""))
+		return nil
+	}
+	alerts.MinRequests = minRequests
+	alerts.buckets = make([]alertBucket, max(int(alerts.Window/time.Second), 1))
+	return alerts
+}
+
+func getAlertDuration(name string, fallback string) time.Duration {
+	duration, err := time.ParseDuration(getEnv(name, fallback))
+	if err != nil || duration <= 0 {
+		configError("invalid %s %q", name, getEnv(name, ""))
+		return time.Minute
+	}
+	return duration
+}
+
+func getAlertRate(name string, fallback string) float64 {
+	rate, err := strconv.ParseFloat(getEnv(name, fallback), 64)
+	if err != nil || rate < 0 || rate > 100 {
+		configError("invalid %s %q", name, getEnv(name, ""))
+		return 0
+	}
+	return rate
+}
+
+func (alerts *Alerts) wrap(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		next(ctx)
+		if !strings.HasPrefix(string(ctx.Path()), "/__") {
+			alerts.observe(ctx.Response.StatusCode(), time.Now())
+		}
+	}
+}
+
+func (alerts *Alerts) observe(status int, now time.Time) {
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+	second := now.Unix()
+	bucket := &alerts.buckets[second%int64(len(alerts.buckets))]
+	if bucket.second != second {
+		*bucket = alertBucket{second: second}
+	}
+	bucket.total++
+	if status >= 500 {
+		bucket.errors++
+	} else if status == fasthttp.StatusNotFound {
+		bucket.notFound++
+	}
+
+	var total, errors, notFound int
+	for _, bucket := range alerts.buckets {
+		if second-bucket.second < int64(len(alerts.buckets)) {
+			total += bucket.total
+			errors += bucket.errors
+			notFound += bucket.notFound
+		}
+	}
+	if total < alerts.MinRequests {
+		return
+	}
+	alerts.check("error_rate", 100*float64(errors)/float64(total), alerts.ErrorRate, total, now)
+	alerts.check("not_found_rate", 100*float64(notFound)/float64(total), alerts.NotFoundRate, total, now)
+}
+
+// Fire an alert when a rate goes over its threshold, once until it recovers
+// and at most once per cooldown
+func (alerts *Alerts) check(name string, rate float64, threshold float64, total int, now time.Time) {
+	state := alerts.alerts[name]
+	if rate <= threshold {
+		if state.firing {
+			logf("⇨ %s recovered to %.1f%%\n", name, rate)
+		}
+		state.firing = false
+		return
+	}
+	if state.firing || now.Sub(state.sent) < alerts.Cooldown {
+		return
+	}
+	state.firing = true
+	state.sent = now
+	go alerts.send(Alert{
+		Alert:     name,
+		Rate:      rate,
+		Threshold: threshold,
+		Requests:  total,
+		Window:    alerts.Window.String(),
+		DeployID:  defaultSite.Table().DeployID,
+	})
+}
+
+func (alerts *Alerts) send(alert Alert) {
+	message := fmt.Sprintf("nano-web %s is %.1f%% over the last %s (threshold %.1f%%, %d requests, deploy %s)",
+		alert.Alert, alert.Rate, alert.Window, alert.Threshold, alert.Requests, alert.DeployID)
+	logln("⇨ alert:", message)
+	var payload interface{} = alert
+	if alerts.Slack {
+		payload = map[string]string{"text": message}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	res, err := alerts.client.Post(alerts.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logln("⇨ error sending alert", err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		logln("⇨ error sending alert", res.Status)
+	}
+}
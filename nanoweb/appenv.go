@@ -0,0 +1,59 @@
+package nanoweb
+
+import (
+	"path"
+	"strings"
+)
+
+// Everything with the CONFIG_PREFIX ends up in every page, so leave out the
+// names matching CONFIG_EXCLUDE globs, or with CONFIG_ALLOW, only inject the
+// names matching it. Names that look like secrets are warned about.
+var configExclude = getNameGlobs("CONFIG_EXCLUDE")
+var configAllow = getNameGlobs("CONFIG_ALLOW")
+
+var secretWords = []string{"KEY", "SECRET", "TOKEN", "PASSWORD", "PASSWD", "PRIVATE", "CREDENTIALS"}
+
+func getNameGlobs(name string) []string {
+	globs := []string{}
+	for _, glob := range strings.Split(getEnv(name, ""), ",") {
+		if glob = strings.TrimSpace(glob); glob != "" {
+			if _, err := path.Match(glob, ""); err != nil {
+				logln("⇨ invalid", name, glob)
+				continue
+			}
+			globs = append(globs, glob)
+		}
+	}
+	return globs
+}
+
+func matchesName(globs []string, name string) bool {
+	for _, glob := range globs {
+		if matched, _ := path.Match(glob, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether an environment variable with the prefix is injected
+func injectedEnv(key string) bool {
+	if len(configAllow) > 0 && !matchesName(configAllow, key) {
+		return false
+	}
+	return !matchesName(configExclude, key)
+}
+
+// Whether a variable's name suggests it holds a secret, e.g. VITE_API_KEY or
+// VITE_AUTHTOKEN. KEY has to be a word of its own, so VITE_KEYCLOAK_URL and
+// VITE_MONKEY aren't.
+func looksSecret(key string) bool {
+	for _, word := range strings.Split(strings.ToUpper(key), "_") {
+		for _, secret := range secretWords {
+			if word == secret || (secret != "KEY" && strings.HasSuffix(word, secret)) {
+				return true
+			}
+		}
+	}
+	return false
+}
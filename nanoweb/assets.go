@@ -0,0 +1,121 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// A build's manifest of fingerprinted assets: Vite's .vite/manifest.json,
+// a webpack or Create React App asset-manifest.json, or the one written by
+// `nano-web hash`. With one, the files it maps to are cached forever and
+// everything else has to be revalidated, unless the headers file says
+// otherwise. ASSET_MANIFEST_REWRITE=1 also points references to the original
+// names in HTML at the fingerprinted ones.
+type AssetManifest struct {
+	// URL paths of fingerprinted files
+	Fingerprinted map[string]bool
+	// Original names to fingerprinted ones, relative to the public dir
+	Renames map[string]string
+}
+
+var assetManifestPath = getEnv("ASSET_MANIFEST", "")
+var assetManifestRewrite = getEnv("ASSET_MANIFEST_REWRITE", "0") == "1"
+
+// Where builds write their manifests, looked for without ASSET_MANIFEST
+var assetManifestFiles = []string{".vite/manifest.json", assetManifestFile}
+
+const revalidateCacheControl = "public, max-age=0, must-revalidate"
+
+// Load the site's asset manifest, if it has one
+func loadAssetManifest(fsys fs.FS) (*AssetManifest, string, error) {
+	names := assetManifestFiles
+	switch assetManifestPath {
+	case "none":
+		return nil, "", nil
+	case "":
+	default:
+		names = []string{strings.TrimPrefix(path.Clean(assetManifestPath), "/")}
+	}
+	for _, name := range names {
+		dat, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			if assetManifestPath != "" {
+				return nil, name, err
+			}
+			continue
+		}
+		var entries map[string]any
+		if err := json.Unmarshal(dat, &entries); err != nil {
+			return nil, name, err
+		}
+		manifest := &AssetManifest{Fingerprinted: make(map[string]bool), Renames: make(map[string]string)}
+		// CRA nests its entries under "files"
+		if files, ok := entries["files"].(map[string]any); ok {
+			entries = files
+		}
+		for key, entry := range entries {
+			switch entry := entry.(type) {
+			case string:
+				manifest.add(fsys, key, entry)
+			case map[string]any:
+				// Vite: {"file": ..., "css": [...], "assets": [...]}
+				if file, ok := entry["file"].(string); ok {
+					manifest.add(fsys, key, file)
+				}
+				for _, field := range []string{"css", "assets"} {
+					files, _ := entry[field].([]any)
+					for _, file := range files {
+						if file, ok := file.(string); ok {
+							manifest.add(fsys, "", file)
+						}
+					}
+				}
+			}
+		}
+		logln("⇨ loaded", len(manifest.Fingerprinted), "fingerprinted assets from", name)
+		return manifest, name, nil
+	}
+	return nil, "", nil
+}
+
+// Record a file the manifest maps to, if it's in the build and was renamed
+func (manifest *AssetManifest) add(fsys fs.FS, original string, file string) {
+	if strings.Contains(file, "://") {
+		return
+	}
+	file = strings.TrimPrefix(path.Clean("/"+file), "/")
+	if file == original {
+		return
+	}
+	if _, err := fs.Stat(fsys, file); err != nil {
+		return
+	}
+	manifest.Fingerprinted["/"+file] = true
+	if original != "" {
+		manifest.Renames[strings.TrimPrefix(path.Clean("/"+original), "/")] = file
+	}
+}
+
+// Cache fingerprinted files forever and revalidate everything else, where
+// the headers file hasn't set a Cache-Control
+func (manifest *AssetManifest) apply(urlPath string, route *Route) {
+	if manifest == nil || route.getHeader("Cache-Control") != "" {
+		return
+	}
+	cacheControl := revalidateCacheControl
+	if manifest.Fingerprinted[urlPath] {
+		cacheControl = immutableCacheControl
+	}
+	route.Headers = append(route.Headers, Header{Key: "Cache-Control", Value: cacheControl})
+}
+
+// Point an HTML page's references to original names at the fingerprinted
+// ones, with ASSET_MANIFEST_REWRITE
+func (manifest *AssetManifest) rewrite(urlPath string, mimetype string, content []byte) []byte {
+	if manifest == nil || !assetManifestRewrite || mimetype != "text/html" || len(manifest.Renames) == 0 {
+		return content
+	}
+	return []byte(rewriteAssetReferences(strings.TrimPrefix(urlPath, "/"), string(content), manifest.Renames))
+}
@@ -0,0 +1,88 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Requests refused by auth, rate limits, request limits or GeoIP are written
+// to AUDIT_LOG as JSON lines naming the rule that refused them, apart from the
+// access log so security tooling can take just the denials. Denials are
+// counted by rule in the metrics either way.
+var auditOutput = getAuditOutput()
+
+var denials = struct {
+	sync.Mutex
+	rules map[string]int64
+}{rules: make(map[string]int64)}
+
+type auditEntry struct {
+	Timestamp string `json:"@timestamp"`
+	Rule      string `json:"rule"`
+	Status    int    `json:"status"`
+	ClientIP  string `json:"client_ip"`
+	Method    string `json:"method"`
+	Host      string `json:"host"`
+	Path      string `json:"path"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+func getAuditOutput() io.Writer {
+	switch name := getEnv("AUDIT_LOG", ""); name {
+	case "":
+		return nil
+	case "stdout":
+		return os.Stdout
+	case "stderr":
+		return os.Stderr
+	default:
+		file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			configError("error opening AUDIT_LOG: %s", err)
+			return nil
+		}
+		return file
+	}
+}
+
+// Record that a request was refused by a rule, once its response is set
+func auditDenied(ctx *fasthttp.RequestCtx, rule string) {
+	denials.Lock()
+	denials.rules[rule]++
+	denials.Unlock()
+	if auditOutput == nil {
+		return
+	}
+	line, err := json.Marshal(auditEntry{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Rule:      rule,
+		Status:    ctx.Response.StatusCode(),
+		ClientIP:  logIP(ctx.RemoteIP()),
+		Method:    string(ctx.Method()),
+		Host:      string(ctx.Host()),
+		Path:      string(ctx.URI().PathOriginal()),
+		UserAgent: logUserAgent(string(ctx.UserAgent())),
+	})
+	if err != nil {
+		return
+	}
+	auditOutput.Write(append(line, '\n'))
+}
+
+func writeDenialMetrics(w io.Writer) {
+	denials.Lock()
+	defer denials.Unlock()
+	if len(denials.rules) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "# TYPE nano_web_denied_requests_total counter")
+	for _, rule := range sortedKeys(denials.rules) {
+		fmt.Fprintf(w, "nano_web_denied_requests_total{rule=%q} %d\n", rule, denials.rules[rule])
+	}
+}
@@ -0,0 +1,209 @@
+package nanoweb
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password protects every site, e.g. for staging. BASIC_AUTH is a single
+// user:pass and BASIC_AUTH_FILE an htpasswd file with bcrypt, apr1 or SHA
+// entries. Checked before anything is looked up, search and the built-in
+// endpoints included, except the health check and those with their own token
+// or signature.
+type BasicAuth struct {
+	Realm string
+	Users map[string]string
+
+	// The Authorization header of the server's own requests, such as
+	// SELF_CHECK, as passwords can't be read back out of an htpasswd file
+	internal string
+
+	// Hashes of Authorization headers that checked out, so bcrypt only runs
+	// once per visitor's credentials
+	mu       sync.Mutex
+	verified map[[32]byte]struct{}
+}
+
+const basicAuthCacheSize = 1000
+
+var basicAuth = getBasicAuth()
+
+func getBasicAuth() *BasicAuth {
+	credentials, file := getEnv("BASIC_AUTH", ""), getEnv("BASIC_AUTH_FILE", "")
+	if credentials == "" && file == "" {
+		return nil
+	}
+	auth := &BasicAuth{
+		Realm:    getEnv("BASIC_AUTH_REALM", "nano-web"),
+		Users:    make(map[string]string),
+		verified: make(map[[32]byte]struct{}),
+	}
+	secret := make([]byte, 16)
+	rand.Read(secret)
+	auth.internal = "Basic " + base64.StdEncoding.EncodeToString([]byte("nano-web:"+hex.EncodeToString(secret)))
+	if credentials != "" {
+		user, pass, found := strings.Cut(credentials, ":")
+		if !found || user == "" {
+			configError("invalid BASIC_AUTH, use user:pass")
+			return nil
+		}
+		auth.Users[user] = "{PLAIN}" + pass
+	}
+	if file != "" {
+		if err := auth.load(file); err != nil {
+			configError("error loading BASIC_AUTH_FILE: %s", err)
+			return nil
+		}
+	}
+	return auth
+}
+
+func (auth *BasicAuth) load(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if user, hash, found := strings.Cut(line, ":"); found {
+			auth.Users[user] = hash
+		}
+	}
+	return scanner.Err()
+}
+
+// Whether the request has the credentials of a user
+func (auth *BasicAuth) Authorized(ctx *fasthttp.RequestCtx) bool {
+	header := ctx.Request.Header.Peek("Authorization")
+	encoded, found := strings.CutPrefix(string(header), "Basic ")
+	if !found {
+		return false
+	}
+	if subtle.ConstantTimeCompare(header, []byte(auth.internal)) == 1 {
+		return true
+	}
+	key := sha256.Sum256(header)
+	auth.mu.Lock()
+	_, verified := auth.verified[key]
+	auth.mu.Unlock()
+	if verified {
+		return true
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	user, pass, _ := strings.Cut(string(decoded), ":")
+	hash, exists := auth.Users[user]
+	if !exists || !checkPassword(hash, pass) {
+		return false
+	}
+	auth.mu.Lock()
+	if len(auth.verified) >= basicAuthCacheSize {
+		auth.verified = make(map[[32]byte]struct{})
+	}
+	auth.verified[key] = struct{}{}
+	auth.mu.Unlock()
+	return true
+}
+
+func (auth *BasicAuth) challenge(ctx *fasthttp.RequestCtx) {
+	ctx.Error("Unauthorized", fasthttp.StatusUnauthorized)
+	ctx.Response.Header.Set("WWW-Authenticate", `Basic realm="`+auth.Realm+`", charset="UTF-8"`)
+	auditDenied(ctx, "basic_auth")
+}
+
+// Check a password against an htpasswd hash
+func checkPassword(hash string, pass string) bool {
+	var expected string
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		expected = apr1(pass, salt)
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		expected = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "{PLAIN}"):
+		expected = "{PLAIN}" + pass
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+}
+
+// Apache's MD5-crypt variant
+func apr1(pass string, salt string) string {
+	const magic = "$apr1$"
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	alternate := md5.Sum([]byte(pass + salt + pass))
+	digest := md5.New()
+	digest.Write([]byte(pass + magic + salt))
+	for i := len(pass); i > 0; i -= 16 {
+		digest.Write(alternate[:min(i, 16)])
+	}
+	for i := len(pass); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			digest.Write([]byte{0})
+		} else {
+			digest.Write([]byte{pass[0]})
+		}
+	}
+	final := digest.Sum(nil)
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 == 1 {
+			round.Write([]byte(pass))
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write([]byte(pass))
+		}
+		if i&1 == 1 {
+			round.Write(final)
+		} else {
+			round.Write([]byte(pass))
+		}
+		final = round.Sum(nil)
+	}
+	out := []byte(magic + salt + "$")
+	encode := func(a, b, c byte, n int) {
+		v := uint(a)<<16 | uint(b)<<8 | uint(c)
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(final[0], final[6], final[12], 4)
+	encode(final[1], final[7], final[13], 4)
+	encode(final[2], final[8], final[14], 4)
+	encode(final[3], final[9], final[15], 4)
+	encode(final[4], final[10], final[5], 4)
+	encode(0, 0, final[11], 2)
+	return string(out)
+}
@@ -0,0 +1,155 @@
+package nanoweb
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password protect the test site with users whose password is "secret"
+func testBasicAuth(t *testing.T) *BasicAuth {
+	t.Helper()
+	bcrypted, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &BasicAuth{
+		Realm: "staging",
+		Users: map[string]string{
+			"plain":  "{PLAIN}secret",
+			"bcrypt": string(bcrypted),
+			// openssl passwd -apr1 -salt xxxxyyyy secret
+			"apr1":  "$apr1$xxxxyyyy$ah8rog3N5NxMSRCRanUtX1",
+			"short": "$apr1$ab$jiiV6N7hIIuIoJbc1hxOE/",
+			"sha":   "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=",
+		},
+		internal: "Basic " + base64.StdEncoding.EncodeToString([]byte("nano-web:internal")),
+		verified: make(map[[32]byte]struct{}),
+	}
+	previous := basicAuth
+	basicAuth = auth
+	t.Cleanup(func() { basicAuth = previous })
+	return auth
+}
+
+func serveAs(uri string, user string, pass string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI(uri)
+	if user != "" {
+		ctx.Request.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+pass)))
+	}
+	handler(ctx)
+	return ctx
+}
+
+func TestBasicAuth(t *testing.T) {
+	testSite(t, map[string]string{"index.html": "home"})
+	testBasicAuth(t)
+	tests := []struct {
+		user   string
+		pass   string
+		status int
+	}{
+		{"", "", 401},
+		{"plain", "secret", 200},
+		{"bcrypt", "secret", 200},
+		{"apr1", "secret", 200},
+		{"short", "secret", 200},
+		{"sha", "secret", 200},
+		{"plain", "wrong", 401},
+		{"bcrypt", "wrong", 401},
+		{"apr1", "wrong", 401},
+		{"sha", "wrong", 401},
+		{"bcrypt", "", 401},
+		{"nobody", "secret", 401},
+		{"nano-web", "guess", 401},
+	}
+	for _, test := range tests {
+		// Twice, as credentials that checked out are remembered
+		for i := 0; i < 2; i++ {
+			ctx := serveAs("/", test.user, test.pass)
+			if status := ctx.Response.StatusCode(); status != test.status {
+				t.Errorf("%s:%s: status %d, want %d", test.user, test.pass, status, test.status)
+			}
+			challenge := string(ctx.Response.Header.Peek("WWW-Authenticate"))
+			if test.status == 401 && challenge != `Basic realm="staging", charset="UTF-8"` {
+				t.Errorf("%s:%s: WWW-Authenticate %q", test.user, test.pass, challenge)
+			}
+			if test.status == 200 && string(ctx.Response.Body()) != "home" {
+				t.Errorf("%s:%s: body %q", test.user, test.pass, ctx.Response.Body())
+			}
+		}
+	}
+}
+
+func TestBasicAuthMalformed(t *testing.T) {
+	testSite(t, map[string]string{"index.html": "home"})
+	testBasicAuth(t)
+	for _, header := range []string{"Bearer secret", "Basic", "Basic !!!", "basic " + base64.StdEncoding.EncodeToString([]byte("plain:secret"))} {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/")
+		ctx.Request.Header.Set("Authorization", header)
+		handler(ctx)
+		if status := ctx.Response.StatusCode(); status != 401 {
+			t.Errorf("%q: status %d, want 401", header, status)
+		}
+	}
+}
+
+// The health check answers probes without the password, and the server's
+// own requests get through with their internal credentials
+func TestBasicAuthExemptions(t *testing.T) {
+	testSite(t, map[string]string{"index.html": "home"})
+	auth := testBasicAuth(t)
+	previous := healthEnabled
+	healthEnabled = true
+	t.Cleanup(func() { healthEnabled = previous })
+
+	if status := serveAs(healthPath, "", "").Response.StatusCode(); status != 200 {
+		t.Errorf("%s: status %d, want 200", healthPath, status)
+	}
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/")
+	ctx.Request.Header.Set("Authorization", auth.internal)
+	handler(ctx)
+	if status := ctx.Response.StatusCode(); status != 200 {
+		t.Errorf("internal credentials: status %d, want 200", status)
+	}
+	if status := serveAs(searchPath, "", "").Response.StatusCode(); status != 401 {
+		t.Errorf("%s: status %d, want 401", searchPath, status)
+	}
+
+	// The deploy API checks its own token, but site paths that merely start
+	// like it don't
+	previousDeployer := deployer
+	deployer = &Deployer{Token: "token"}
+	t.Cleanup(func() { deployer = previousDeployer })
+	for _, path := range []string{deployPath, deployPath + "/rollback", deployPath + "X", deployPath + "s/x"} {
+		ctx := serveAs(path, "", "")
+		if status := ctx.Response.StatusCode(); status != 401 {
+			t.Errorf("%s: status %d, want 401", path, status)
+		}
+		challenge := string(ctx.Response.Header.Peek("WWW-Authenticate"))
+		if basic := strings.HasPrefix(challenge, "Basic"); basic == isDeployPath(path) {
+			t.Errorf("%s: challenged with %q", path, challenge)
+		}
+	}
+
+	site := testSlots(t)
+	for _, path := range []string{slotsPath, slotsPath + "/blue", slotsPath + "foo", slotsPath + "s/x"} {
+		ctx := serveAs(path, "", "")
+		if status := ctx.Response.StatusCode(); status != 401 {
+			t.Errorf("%s: status %d, want 401", path, status)
+		}
+		challenge := string(ctx.Response.Header.Peek("WWW-Authenticate"))
+		if basic := strings.HasPrefix(challenge, "Basic"); basic == isSlotsPath(path) {
+			t.Errorf("%s: challenged with %q", path, challenge)
+		}
+	}
+	if site.slots.Active() != "blue" {
+		t.Errorf("site paths switched the slot to %s", site.slots.Active())
+	}
+}
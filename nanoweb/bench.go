@@ -0,0 +1,149 @@
+package nanoweb
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type BenchResult struct {
+	Path     string
+	Encoding string
+	Requests int
+	Errors   int
+	Latency  []time.Duration
+}
+
+func (result *BenchResult) percentile(p float64) time.Duration {
+	if len(result.Latency) == 0 {
+		return 0
+	}
+	return result.Latency[int(float64(len(result.Latency)-1)*p)]
+}
+
+// Load test a running server, or an in-process one serving a directory
+func benchCommand(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	duration := flags.Duration("duration", 5*time.Second, "how long to hit each path and encoding for")
+	concurrency := flags.Int("concurrency", 32, "concurrent connections")
+	pathList := flags.String("paths", "", "comma separated paths. Defaults to a sample of the site's routes")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	logOutput = os.Stderr
+	target := getPublicDir()
+	if flags.NArg() > 0 {
+		target = flags.Arg(0)
+	}
+
+	var paths []string
+	baseURL := strings.TrimSuffix(target, "/")
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		site, err := getCommandSite([]string{target})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		sites = []*Site{site}
+		defaultSite = site
+		site.Reload()
+		paths = benchPaths(site.Table())
+		// Don't measure request logging
+		logOutput = io.Discard
+		go (&fasthttp.Server{Handler: handler}).Serve(listener)
+		baseURL = "http://" + listener.Addr().String()
+	}
+	if *pathList != "" {
+		paths = strings.Split(*pathList, ",")
+	}
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+
+	fmt.Printf("benchmarking %s for %s per path and encoding with %d connections\n\n", target, *duration, *concurrency)
+	fmt.Printf("%-32s %-8s %10s %8s %10s %10s %10s\n", "PATH", "ENCODING", "RPS", "ERRORS", "P50", "P90", "P99")
+	failed := false
+	for _, path := range paths {
+		for _, encoding := range []string{"identity", "gzip", "br"} {
+			result := bench(baseURL+path, encoding, *duration, *concurrency)
+			result.Path = path
+			fmt.Printf("%-32s %-8s %10.0f %8d %10s %10s %10s\n", path, encoding,
+				float64(result.Requests)/duration.Seconds(), result.Errors,
+				result.percentile(0.5), result.percentile(0.9), result.percentile(0.99))
+			failed = failed || result.Errors > 0
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// The largest few file routes of each content type, as a representative sample
+func benchPaths(table *RouteTable) []string {
+	byType := make(map[string][]ManifestEntry)
+	for _, entry := range getManifest(table).Routes {
+		byType[entry.ContentType] = append(byType[entry.ContentType], entry)
+	}
+	paths := []string{}
+	for _, entries := range byType {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Size > entries[j].Size })
+		for i := 0; i < len(entries) && i < 2; i++ {
+			paths = append(paths, entries[i].Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func bench(url string, encoding string, duration time.Duration, concurrency int) *BenchResult {
+	client := &fasthttp.Client{MaxConnsPerHost: concurrency}
+	result := &BenchResult{Encoding: encoding}
+	deadline := time.Now().Add(duration)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := fasthttp.AcquireRequest()
+			res := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseRequest(req)
+			defer fasthttp.ReleaseResponse(res)
+			req.SetRequestURI(url)
+			req.Header.Set("Accept-Encoding", encoding)
+			latency := []time.Duration{}
+			errors := 0
+			for time.Now().Before(deadline) {
+				start := time.Now()
+				err := client.Do(req, res)
+				if err != nil || res.StatusCode() >= 400 {
+					errors++
+					continue
+				}
+				latency = append(latency, time.Since(start))
+			}
+			mu.Lock()
+			result.Latency = append(result.Latency, latency...)
+			result.Errors += errors
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	result.Requests = len(result.Latency)
+	sort.Slice(result.Latency, func(i, j int) bool { return result.Latency[i] < result.Latency[j] })
+	return result
+}
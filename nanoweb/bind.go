@@ -0,0 +1,40 @@
+package nanoweb
+
+import "net"
+
+// BIND restricts the listener to one address, e.g. 127.0.0.1 or ::1 for a
+// sidecar that only its pod should reach. Empty listens on every interface,
+// over IPv4 and IPv6.
+func getBindAddr() string {
+	return net.JoinHostPort(getEnv("BIND", ""), getEnv("PORT", "80"))
+}
+
+// The network to listen on for addr, "tcp" or "udp". An explicit wildcard
+// only binds its own family, so 0.0.0.0 is IPv4 only and :: IPv6 only,
+// where Go would otherwise listen dual-stack on both.
+func listenNetwork(proto string, addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return proto
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return proto
+	case ip.To4() != nil:
+		return proto + "4"
+	default:
+		return proto + "6"
+	}
+}
+
+// A host to reach a listener on from this machine
+func loopbackHost(host string) string {
+	switch host {
+	case "", "0.0.0.0":
+		return "127.0.0.1"
+	case "::":
+		return "::1"
+	}
+	return host
+}
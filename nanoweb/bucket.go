@@ -0,0 +1,372 @@
+package nanoweb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// An S3 compatible bucket (including GCS through its XML API with HMAC keys)
+// synced into a local cache directory that the site is served from
+type BucketSource struct {
+	Endpoint     string
+	Bucket       string
+	Prefix       string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	CacheDir     string
+
+	client *http.Client
+	etags  map[string]string
+}
+
+type bucketObject struct {
+	Key          string    `xml:"Key"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+type listBucketResult struct {
+	Contents              []bucketObject `xml:"Contents"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	NextContinuationToken string         `xml:"NextContinuationToken"`
+}
+
+var bucketSource = getBucketSource()
+
+func getBucketSource() *BucketSource {
+	bucket := getEnv("S3_BUCKET", "")
+	if bucket == "" {
+		return nil
+	}
+	region := getEnv("S3_REGION", getEnv("AWS_REGION", "us-east-1"))
+	return &BucketSource{
+		Endpoint:     strings.TrimSuffix(getEnv("S3_ENDPOINT", "https://s3."+region+".amazonaws.com"), "/"),
+		Bucket:       bucket,
+		Prefix:       strings.TrimPrefix(getEnv("S3_PREFIX", ""), "/"),
+		Region:       region,
+		AccessKey:    getEnv("AWS_ACCESS_KEY_ID", ""),
+		SecretKey:    getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		SessionToken: getEnv("AWS_SESSION_TOKEN", ""),
+		CacheDir:     getEnv("S3_CACHE_DIR", filepath.Join(os.TempDir(), "nano-web-"+bucket)),
+		client:       &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Escape as S3 expects: everything except unreserved characters, optionally
+// keeping slashes
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Sign a request with AWS Signature Version 4. Anonymous requests are left
+// unsigned so public buckets work without credentials.
+func (source *BucketSource) sign(req *http.Request) {
+	if source.AccessKey == "" {
+		return
+	}
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	if source.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", source.SessionToken)
+	}
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		params = append(params, awsEscape(key, false)+"="+awsEscape(query.Get(key), false))
+	}
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if source.SessionToken != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	headers := ""
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers += name + ":" + strings.TrimSpace(value) + "\n"
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.Path, true),
+		strings.Join(params, "&"),
+		headers,
+		strings.Join(signed, ";"),
+		emptyPayloadHash,
+	}, "\n")
+	scope := date + "/" + source.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+source.SecretKey), date)
+	key = hmacSHA256(key, source.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		source.AccessKey, scope, strings.Join(signed, ";"), signature))
+}
+
+func (source *BucketSource) get(key string, query url.Values) (*http.Response, error) {
+	target, err := url.Parse(source.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	// Keys may contain anything, including ? # and %, so they're escaped
+	// rather than parsed as part of the URL
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + source.Bucket + "/" + key
+	target.RawPath = awsEscape(target.Path, true)
+	target.RawQuery = query.Encode()
+	req, err := http.NewRequest("GET", target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	source.sign(req)
+	res, err := source.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", target.Path, res.Status)
+	}
+	return res, nil
+}
+
+func (source *BucketSource) list() ([]bucketObject, error) {
+	objects := []bucketObject{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {source.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		res, err := source.get("", query)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			if !strings.HasSuffix(object.Key, "/") {
+				objects = append(objects, object)
+			}
+		}
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (source *BucketSource) download(object bucketObject, dest string) error {
+	res, err := source.get(object.Key, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp := dest + ".nano-web-tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, res.Body); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	os.Chtimes(tmp, object.LastModified, object.LastModified)
+	return os.Rename(tmp, dest)
+}
+
+// The synced objects are served from the current symlink in the cache dir
+func (source *BucketSource) PublicDir() string {
+	return filepath.Join(source.CacheDir, "current")
+}
+
+func (source *BucketSource) etagsPath() string {
+	return filepath.Join(source.CacheDir, "etags.json")
+}
+
+// The ETags of what was last synced, saved so a restart doesn't download the
+// whole bucket again. Only files still on disk are trusted.
+func (source *BucketSource) loadETags(live string) map[string]string {
+	etags := make(map[string]string)
+	dat, err := os.ReadFile(source.etagsPath())
+	if err != nil || live == "" {
+		return etags
+	}
+	saved := make(map[string]string)
+	if err := json.Unmarshal(dat, &saved); err != nil {
+		return etags
+	}
+	for name, etag := range saved {
+		if path, err := safeJoin(live, name); err == nil {
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				etags[name] = etag
+			}
+		}
+	}
+	return etags
+}
+
+// Bring the served tree in line with the bucket, downloading objects whose
+// ETag changed and dropping ones that were deleted. Changes are made in a
+// staging dir, where unchanged files are hard links to the live ones, and
+// only swapped in once every download succeeded. Returns whether anything
+// changed.
+func (source *BucketSource) Sync() (bool, error) {
+	objects, err := source.list()
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(source.CacheDir, 0755); err != nil {
+		return false, err
+	}
+	live, err := filepath.EvalSymlinks(source.PublicDir())
+	if err != nil {
+		live = ""
+	}
+	if source.etags == nil {
+		source.etags = source.loadETags(live)
+	}
+
+	wanted := make(map[string]bucketObject)
+	changed := live == ""
+	for _, object := range objects {
+		name := strings.TrimPrefix(strings.TrimPrefix(object.Key, source.Prefix), "/")
+		if _, err := safeJoin(source.CacheDir, name); name == "" || err != nil {
+			continue
+		}
+		wanted[name] = object
+		if source.etags[name] != object.ETag {
+			changed = true
+		}
+	}
+	for name := range source.etags {
+		if _, exists := wanted[name]; !exists {
+			logln("⇨ removing", name)
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	staging, err := os.MkdirTemp(source.CacheDir, "sync-")
+	if err != nil {
+		return false, err
+	}
+	etags := make(map[string]string, len(wanted))
+	for name, object := range wanted {
+		target, _ := safeJoin(staging, name)
+		if source.etags[name] == object.ETag {
+			previous, _ := safeJoin(live, name)
+			if os.MkdirAll(filepath.Dir(target), 0755) == nil && os.Link(previous, target) == nil {
+				etags[name] = object.ETag
+				continue
+			}
+		}
+		if err := source.download(object, target); err != nil {
+			os.RemoveAll(staging)
+			return false, err
+		}
+		logln("⇨ synced", object.Key)
+		etags[name] = object.ETag
+	}
+
+	if err := replaceSymlink(source.PublicDir(), filepath.Base(staging)); err != nil {
+		os.RemoveAll(staging)
+		return false, err
+	}
+	if previous := filepath.Base(live); strings.HasPrefix(previous, "sync-") {
+		os.RemoveAll(filepath.Join(source.CacheDir, previous))
+	}
+	source.etags = etags
+	dat, _ := json.Marshal(etags)
+	if err := os.WriteFile(source.etagsPath(), dat, 0644); err != nil {
+		logln("⇨ error saving bucket ETags", err)
+	}
+	return true, nil
+}
+
+func getBucketPollInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("S3_POLL_INTERVAL", "60s"))
+	if err != nil || interval <= 0 {
+		return 60 * time.Second
+	}
+	return interval
+}
+
+// Poll the bucket and reload the site whenever its contents change
+func (source *BucketSource) Watch(site *Site) {
+	for range time.Tick(getBucketPollInterval()) {
+		changed, err := source.Sync()
+		if err != nil {
+			logln("⇨ error syncing bucket", source.Bucket, err)
+			continue
+		}
+		if changed {
+			logln("⇨ bucket", source.Bucket, "changed, reloading")
+			reloadMu.Lock()
+			err := site.Reload()
+			reloadMu.Unlock()
+			if err != nil {
+				logln("⇨ error reloading bucket", source.Bucket, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package nanoweb
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A bucket served from memory, counting the objects downloaded
+type testBucket struct {
+	mu        sync.Mutex
+	objects   map[string]string
+	failing   string
+	downloads []string
+}
+
+func (bucket *testBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/site/")
+	if r.URL.Path == "/site/" && r.URL.Query().Get("list-type") == "2" {
+		result := listBucketResult{}
+		for key, content := range bucket.objects {
+			result.Contents = append(result.Contents, bucketObject{Key: key, ETag: `"` + content + `"`, Size: int64(len(content))})
+		}
+		xml.NewEncoder(w).Encode(result)
+		return
+	}
+	content, exists := bucket.objects[key]
+	if !exists || key == bucket.failing {
+		http.Error(w, "NoSuchKey", http.StatusNotFound)
+		return
+	}
+	bucket.downloads = append(bucket.downloads, key)
+	w.Write([]byte(content))
+}
+
+func (bucket *testBucket) downloaded() []string {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+	downloads := bucket.downloads
+	bucket.downloads = nil
+	return downloads
+}
+
+func readSynced(t *testing.T, source *BucketSource, name string) string {
+	t.Helper()
+	dat, err := os.ReadFile(filepath.Join(source.PublicDir(), filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(dat)
+}
+
+func TestBucketSync(t *testing.T) {
+	bucket := &testBucket{objects: map[string]string{
+		"index.html":       "home",
+		"a?b#c%d.html":     "odd",
+		"docs/100% ok.txt": "ok",
+	}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+	cacheDir := t.TempDir()
+	newSource := func() *BucketSource {
+		return &BucketSource{Endpoint: server.URL, Bucket: "site", CacheDir: cacheDir, client: server.Client()}
+	}
+
+	source := newSource()
+	if changed, err := source.Sync(); err != nil || !changed {
+		t.Fatalf("first sync: changed %v, error %v", changed, err)
+	}
+	if downloads := bucket.downloaded(); len(downloads) != 3 {
+		t.Errorf("first sync downloaded %v", downloads)
+	}
+	for name, content := range bucket.objects {
+		if synced := readSynced(t, source, name); synced != content {
+			t.Errorf("%s: synced %q, want %q", name, synced, content)
+		}
+	}
+	if changed, err := source.Sync(); err != nil || changed {
+		t.Errorf("unchanged sync: changed %v, error %v", changed, err)
+	}
+
+	// A restart only downloads what changed while it was down
+	bucket.objects["index.html"] = "home v2"
+	source = newSource()
+	if changed, err := source.Sync(); err != nil || !changed {
+		t.Fatalf("sync after restart: changed %v, error %v", changed, err)
+	}
+	if downloads := bucket.downloaded(); len(downloads) != 1 || downloads[0] != "index.html" {
+		t.Errorf("sync after restart downloaded %v, want only index.html", downloads)
+	}
+	if synced := readSynced(t, source, "index.html"); synced != "home v2" {
+		t.Errorf("index.html: synced %q", synced)
+	}
+
+	// A sync that fails part way leaves the live tree as it was
+	bucket.objects["index.html"] = "home v3"
+	bucket.objects["new.html"] = "new"
+	bucket.failing = "new.html"
+	if changed, err := source.Sync(); err == nil || changed {
+		t.Errorf("failed sync: changed %v, error %v", changed, err)
+	}
+	if synced := readSynced(t, source, "index.html"); synced != "home v2" {
+		t.Errorf("index.html after a failed sync: %q, want the previous content", synced)
+	}
+
+	bucket.failing = ""
+	delete(bucket.objects, "docs/100% ok.txt")
+	if changed, err := source.Sync(); err != nil || !changed {
+		t.Fatalf("sync after removal: changed %v, error %v", changed, err)
+	}
+	if _, err := os.Stat(filepath.Join(source.PublicDir(), "docs", "100% ok.txt")); !os.IsNotExist(err) {
+		t.Errorf("removed object still synced: %v", err)
+	}
+	if synced := readSynced(t, source, "new.html"); synced != "new" {
+		t.Errorf("new.html: synced %q", synced)
+	}
+	// Only the live sync is kept around
+	if dirs, _ := filepath.Glob(filepath.Join(cacheDir, "sync-*")); len(dirs) != 1 {
+		t.Errorf("sync dirs left behind: %v", dirs)
+	}
+}
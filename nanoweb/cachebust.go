@@ -0,0 +1,34 @@
+package nanoweb
+
+import (
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Routes are looked up by path alone, so cache-busting query strings like
+// /app.js?v=123 serve /app.js. When the query has one of the VERSION_QUERY
+// params the URL changes with the content, so it can be cached forever.
+var versionQueryParams = getVersionQueryParams()
+
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+func getVersionQueryParams() []string {
+	params := []string{}
+	for _, param := range strings.Split(getEnv("VERSION_QUERY", ""), ",") {
+		if param = strings.TrimSpace(param); param != "" {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+func hasVersionQuery(ctx *fasthttp.RequestCtx) bool {
+	args := ctx.QueryArgs()
+	for _, param := range versionQueryParams {
+		if len(args.Peek(param)) > 0 {
+			return true
+		}
+	}
+	return false
+}
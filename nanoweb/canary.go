@@ -0,0 +1,90 @@
+package nanoweb
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+const canaryCookie = "nano_canary"
+
+// Serves a percentage of visitors from a canary directory, sticky by cookie
+// or by client IP
+type Canary struct {
+	Dir     string
+	Percent int
+	Sticky  string
+
+	table atomic.Pointer[RouteTable]
+}
+
+func getCanary() *Canary {
+	dir := getEnv("CANARY_DIR", "")
+	if dir == "" {
+		return nil
+	}
+	percent, err := strconv.Atoi(getEnv("CANARY_PERCENT", "10"))
+	if err != nil || percent < 0 || percent > 100 {
+		configError("invalid CANARY_PERCENT %q, must be between 0 and 100", getEnv("CANARY_PERCENT", ""))
+		return nil
+	}
+	sticky := getEnv("CANARY_STICKY", "cookie")
+	if sticky != "cookie" && sticky != "ip" {
+		configError("invalid CANARY_STICKY %q", sticky)
+		return nil
+	}
+	return &Canary{
+		Dir:     dir,
+		Percent: percent,
+		Sticky:  sticky,
+	}
+}
+
+func (canary *Canary) Reload(site *Site) {
+	logln("⇨ populating canary", canary.Dir)
+	table := site.Build(canary.Dir)
+	table.DeployID = table.ContentHash()
+	canary.table.Store(table)
+}
+
+func ipBucket(ctx *fasthttp.RequestCtx) int {
+	hash := fnv.New32a()
+	hash.Write(ctx.RemoteIP())
+	return int(hash.Sum32() % 100)
+}
+
+// Assign the request to the canary or stable build, returning the table to
+// serve from
+func (canary *Canary) Assign(ctx *fasthttp.RequestCtx, stable *RouteTable) *RouteTable {
+	var isCanary bool
+	if canary.Sticky == "ip" {
+		isCanary = ipBucket(ctx) < canary.Percent
+	} else {
+		ctx.Response.Header.Add("Vary", "Cookie")
+		switch string(ctx.Request.Header.Cookie(canaryCookie)) {
+		case "canary":
+			isCanary = true
+		case "stable":
+			isCanary = false
+		default:
+			isCanary = rand.Intn(100) < canary.Percent
+			cookie := fasthttp.AcquireCookie()
+			cookie.SetKey(canaryCookie)
+			cookie.SetValue(map[bool]string{true: "canary", false: "stable"}[isCanary])
+			cookie.SetPath("/")
+			cookie.SetHTTPOnly(true)
+			cookie.SetSameSite(fasthttp.CookieSameSiteLaxMode)
+			ctx.Response.Header.SetCookie(cookie)
+			fasthttp.ReleaseCookie(cookie)
+		}
+	}
+	if table := canary.table.Load(); isCanary && table != nil {
+		ctx.Response.Header.Set("X-Canary", "canary")
+		return table
+	}
+	ctx.Response.Header.Set("X-Canary", "stable")
+	return stable
+}
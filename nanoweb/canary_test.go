@@ -0,0 +1,52 @@
+package nanoweb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCanary(t *testing.T) {
+	site := testSite(t, map[string]string{"index.html": "stable"})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("canary"), 0644)
+	site.canary = &Canary{Dir: dir, Percent: 100, Sticky: "cookie"}
+	t.Cleanup(func() { site.canary = nil })
+	if err := site.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		percent int
+		sticky  string
+		cookie  string
+		body    string
+		set     string
+	}{
+		{"new visitor", 100, "cookie", "", "canary", "canary"},
+		{"new visitor outside the percentage", 0, "cookie", "", "stable", "stable"},
+		{"remembered canary", 0, "cookie", "canary", "canary", ""},
+		{"remembered stable", 100, "cookie", "stable", "stable", ""},
+		{"by IP", 100, "ip", "", "canary", ""},
+		{"by IP outside the percentage", 0, "ip", "", "stable", ""},
+	}
+	for _, test := range tests {
+		site.canary.Percent, site.canary.Sticky = test.percent, test.sticky
+		headers := map[string]string{}
+		if test.cookie != "" {
+			headers["Cookie"] = canaryCookie + "=" + test.cookie
+		}
+		ctx := serveWith("/", headers)
+		if body := string(ctx.Response.Body()); body != test.body {
+			t.Errorf("%s: serving %q, want %q", test.name, body, test.body)
+		}
+		if header := string(ctx.Response.Header.Peek("X-Canary")); header != test.body {
+			t.Errorf("%s: X-Canary %q, want %q", test.name, header, test.body)
+		}
+		if set := string(ctx.Response.Header.PeekCookie(canaryCookie)); (set != "") != (test.set != "") || test.set != "" && !strings.HasPrefix(set, canaryCookie+"="+test.set+";") {
+			t.Errorf("%s: Set-Cookie %q, want %s", test.name, set, test.set)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package nanoweb
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// For testing how clients cope with a bad origin: CHAOS=1 adds latency, 5xx
+// responses and dropped connections to a percentage of requests. Built-in
+// /__ endpoints are left alone so health checks keep working.
+var chaosEnabled = getEnv("CHAOS", "0") == "1"
+
+type Chaos struct {
+	MinLatency   time.Duration
+	MaxLatency   time.Duration
+	ErrorPercent float64
+	DropPercent  float64
+}
+
+func getChaos() *Chaos {
+	if !chaosEnabled {
+		return nil
+	}
+	chaos := &Chaos{}
+	var err error
+	min, max, isRange := strings.Cut(getEnv("CHAOS_LATENCY", "0"), "-")
+	if chaos.MinLatency, err = time.ParseDuration(min); err != nil {
+		configError("invalid CHAOS_LATENCY: %s", err)
+		return nil
+	}
+	chaos.MaxLatency = chaos.MinLatency
+	if isRange {
+		if chaos.MaxLatency, err = time.ParseDuration(max); err != nil || chaos.MaxLatency < chaos.MinLatency {
+			configError("invalid CHAOS_LATENCY %q", getEnv("CHAOS_LATENCY", ""))
+			return nil
+		}
+	}
+	chaos.ErrorPercent = getChaosPercent("CHAOS_ERROR_PERCENT")
+	chaos.DropPercent = getChaosPercent("CHAOS_DROP_PERCENT")
+	logf("⇨ chaos: %s-%s latency, %.1f%% errors, %.1f%% dropped connections\n",
+		chaos.MinLatency, chaos.MaxLatency, chaos.ErrorPercent, chaos.DropPercent)
+	return chaos
+}
+
+func getChaosPercent(name string) float64 {
+	percent, err := strconv.ParseFloat(getEnv(name, "0"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		configError("invalid %s %q", name, getEnv(name, ""))
+		return 0
+	}
+	return percent
+}
+
+func (chaos *Chaos) wrap(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if strings.HasPrefix(string(ctx.Path()), "/__") {
+			next(ctx)
+			return
+		}
+		latency := chaos.MinLatency
+		if spread := chaos.MaxLatency - chaos.MinLatency; spread > 0 {
+			latency += time.Duration(rand.Int63n(int64(spread)))
+		}
+		time.Sleep(latency)
+		switch roll := rand.Float64() * 100; {
+		case roll < chaos.DropPercent:
+			ctx.HijackSetNoResponse(true)
+			ctx.Hijack(func(conn net.Conn) {})
+		case roll < chaos.DropPercent+chaos.ErrorPercent:
+			statuses := []int{
+				fasthttp.StatusInternalServerError,
+				fasthttp.StatusBadGateway,
+				fasthttp.StatusServiceUnavailable,
+				fasthttp.StatusGatewayTimeout,
+			}
+			status := statuses[rand.Intn(len(statuses))]
+			ctx.Error(fasthttp.StatusMessage(status), status)
+		default:
+			next(ctx)
+		}
+	}
+}
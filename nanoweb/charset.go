@@ -0,0 +1,38 @@
+package nanoweb
+
+import "strings"
+
+// Text is sent with a charset so browsers don't have to guess. CHARSET is
+// used for every text type (none leaves it off), and CHARSETS overrides it
+// per MIME type, e.g. text/csv=windows-1252.
+var contentTypes = getContentTypes()
+
+var textTypes = []string{"text/html", "text/css", "text/javascript", "text/csv", "text/plain", "application/json", "application/xml", "image/svg+xml"}
+
+func getContentTypes() map[string]string {
+	types := make(map[string]string)
+	if charset := getEnv("CHARSET", "utf-8"); charset != "none" {
+		for _, mimetype := range textTypes {
+			types[mimetype] = mimetype + "; charset=" + charset
+		}
+	}
+	for _, entry := range strings.Split(getEnv("CHARSETS", ""), ",") {
+		mimetype, charset, found := strings.Cut(strings.TrimSpace(entry), "=")
+		switch {
+		case !found || mimetype == "":
+		case charset == "none":
+			delete(types, mimetype)
+		default:
+			types[mimetype] = mimetype + "; charset=" + charset
+		}
+	}
+	return types
+}
+
+// The Content-Type header for a route's MIME type
+func contentTypeHeader(mimetype string) string {
+	if header, ok := contentTypes[mimetype]; ok {
+		return header
+	}
+	return mimetype
+}
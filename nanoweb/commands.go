@@ -0,0 +1,155 @@
+package nanoweb
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const usage = `usage: nano-web [command]
+
+Serves the public dir when run without a command.
+
+commands:
+  init [dir]      scaffold a minimal site with example headers and a Dockerfile
+  manifest [dir]  print every route with its hash, size, MIME type and cache policy as JSON
+  routes [--json] [dir]
+                  print the route table populated from a directory, with each route's source file
+  bench [--duration 5s] [--concurrency 32] [--paths /,/app.js] [url|dir]
+                  measure requests per second and latency against a running server, or an
+                  in-process one serving a directory
+  precompress [dir]
+                  write .gz, .br and .zst copies of compressible files at maximum compression
+  config validate [file] | schema | print-defaults
+                  check a sites file, print its JSON schema or print every setting with its default
+  docker [--out nano-web-image] [--build tag] [dir]
+                  write (or build) a minimal image serving a directory
+  healthcheck     exit 0 if the running server's /__health check passes
+  export [--compressed] dir out
+                  write every file as it would be served, with runtime config applied
+  hash [dir]      rename assets with a hash of their content and rewrite references in HTML and CSS
+  service install [KEY=VALUE...] | uninstall | run
+                  run as a Windows service, configured with the given environment
+  version [--check]
+                  print the version and build details, checking GitHub for a newer release
+  rollback [id]   roll a running server back to the previous (or given) deploy
+  top [--interval 2s] [url]
+                  show live request rates, latency and the hottest routes of a running server
+`
+
+// Run a subcommand if one was given, returning false to start the server
+func RunCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "init":
+		os.Exit(initCommand(args[1:]))
+	case "manifest":
+		os.Exit(manifestCommand(args[1:]))
+	case "routes":
+		os.Exit(routesCommand(args[1:]))
+	case "bench":
+		os.Exit(benchCommand(args[1:]))
+	case "precompress":
+		os.Exit(precompressCommand(args[1:]))
+	case "config":
+		os.Exit(configCommand(args[1:]))
+	case "docker":
+		os.Exit(dockerCommand(args[1:]))
+	case "healthcheck":
+		os.Exit(healthcheckCommand(args[1:]))
+	case "export":
+		os.Exit(exportCommand(args[1:]))
+	case "hash":
+		os.Exit(hashCommand(args[1:]))
+	case "service":
+		os.Exit(serviceCommand(args[1:]))
+	case "rollback":
+		os.Exit(rollbackCommand(args[1:]))
+	case "top":
+		os.Exit(topCommand(args[1:]))
+	case "version", "--version":
+		os.Exit(versionCommand(args[1:]))
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		os.Exit(0)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
+	return true
+}
+
+// A site for commands that work on a directory, defaulting to PUBLIC_DIR.
+// Logging goes to stderr so the command's output can be piped.
+func getCommandSite(args []string) (*Site, error) {
+	logOutput = os.Stderr
+	dir := getPublicDir()
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	return newSite(&Site{
+		Hosts:        []string{"*"},
+		PublicDir:    dir,
+		SpaMode:      getEnv("SPA_MODE", "0") == "1",
+		ConfigPrefix: getEnv("CONFIG_PREFIX", "VITE_"),
+		HeadersFile:  getEnv("HEADERS_FILE", ""),
+		Mounts:       parseMounts(getEnv("MOUNTS", "")),
+	})
+}
+
+// The URL of the running server that commands talk to
+func getServerURL() string {
+	host := loopbackHost(getEnv("BIND", ""))
+	if host == "127.0.0.1" {
+		host = "localhost"
+	}
+	defaultURL := "http://" + net.JoinHostPort(host, getEnv("PORT", "80"))
+	if getEnv("TLS_CERT", "") != "" {
+		defaultURL = "https://" + net.JoinHostPort(host, getEnv("PORT", "80"))
+	}
+	if addr := getEnv("ADMIN_ADDR", ""); addr != "" {
+		// The built-in endpoints are only on the admin listener
+		host, port, _ := net.SplitHostPort(addr)
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+		defaultURL = "http://" + net.JoinHostPort(host, port)
+	}
+	return strings.TrimSuffix(getEnv("NANO_WEB_URL", defaultURL), "/")
+}
+
+// Call an admin endpoint of the running server, printing the response
+func adminRequest(method string, path string, token string) int {
+	req, err := http.NewRequest(method, getServerURL()+path, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	fmt.Println(strings.TrimSpace(string(body)))
+	if res.StatusCode >= 300 {
+		return 1
+	}
+	return 0
+}
+
+func rollbackCommand(args []string) int {
+	path := deployPath + "/rollback"
+	if len(args) > 0 {
+		path += "?id=" + url.QueryEscape(args[0])
+	}
+	return adminRequest("POST", path, getEnv("DEPLOY_TOKEN", ""))
+}
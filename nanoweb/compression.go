@@ -0,0 +1,37 @@
+package nanoweb
+
+import (
+	"path"
+	"strings"
+)
+
+// COMPRESS and NO_COMPRESS override which files are compressed, by extension
+// (".geojson") or MIME type ("application/geo+json")
+var compressionOverrides = getCompressionOverrides()
+
+func getCompressionOverrides() map[string]bool {
+	overrides := make(map[string]bool)
+	for _, name := range []string{"COMPRESS", "NO_COMPRESS"} {
+		compress := name == "COMPRESS"
+		for _, entry := range strings.Split(getEnv(name, ""), ",") {
+			entry = strings.ToLower(strings.TrimSpace(entry))
+			if entry == "" {
+				continue
+			}
+			if previous, exists := overrides[entry]; exists && previous != compress {
+				configError("%s is in both COMPRESS and NO_COMPRESS", entry)
+				continue
+			}
+			overrides[entry] = compress
+		}
+	}
+	return overrides
+}
+
+// Whether a file is worth compressing, going by its name then its MIME type
+func shouldCompress(name string, mimetype string) bool {
+	if compress, ok := compressionOverrides[strings.ToLower(path.Ext(name))]; ok {
+		return compress
+	}
+	return compressedType(mimetype)
+}
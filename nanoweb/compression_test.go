@@ -0,0 +1,25 @@
+package nanoweb
+
+import "testing"
+
+func TestCompressionOverrides(t *testing.T) {
+	previous := configErrors
+	t.Cleanup(func() { configErrors = previous })
+	configErrors = nil
+	t.Setenv("COMPRESS", ".geojson, .WASM")
+	t.Setenv("NO_COMPRESS", "image/svg+xml")
+	overrides := getCompressionOverrides()
+	if len(overrides) != 3 || !overrides[".geojson"] || !overrides[".wasm"] || overrides["image/svg+xml"] {
+		t.Errorf("overrides %v", overrides)
+	}
+	if err := configErr(); err != nil {
+		t.Error(err)
+	}
+
+	// A pattern in both lists is refused, rather than resolved either way
+	t.Setenv("NO_COMPRESS", ".geojson")
+	getCompressionOverrides()
+	if err := configErr(); err == nil || err.Error() != ".geojson is in both COMPRESS and NO_COMPRESS" {
+		t.Errorf("error %v, want .geojson in both", err)
+	}
+}
@@ -0,0 +1,46 @@
+package nanoweb
+
+import (
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// The entity tag of a route as sent with an encoding. Each encoding is its own
+// representation, so gets its own tag.
+func routeETag(route Route, encoding string) string {
+	if encoding == "" {
+		return `"` + route.Hash + `"`
+	}
+	return `"` + route.Hash + "-" + encoding + `"`
+}
+
+// Whether a GET or HEAD request's validators still match, so it can be
+// answered with 304 Not Modified. If-Modified-Since is only considered
+// without If-None-Match.
+func notModified(ctx *fasthttp.RequestCtx, etag string, lastModified string) bool {
+	if !ctx.IsGet() && !ctx.IsHead() {
+		return false
+	}
+	if match := ctx.Request.Header.Peek("If-None-Match"); len(match) > 0 {
+		for _, tag := range strings.Split(string(match), ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := fasthttp.ParseHTTPDate(ctx.Request.Header.Peek("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := fasthttp.ParseHTTPDate([]byte(lastModified))
+	return err == nil && !modified.After(since)
+}
+
+// Answer with 304 Not Modified, keeping the headers already set
+func sendNotModified(ctx *fasthttp.RequestCtx) {
+	ctx.SetStatusCode(fasthttp.StatusNotModified)
+	ctx.Response.SkipBody = true
+}
@@ -0,0 +1,328 @@
+package nanoweb
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+//go:embed sites.schema.json
+var sitesSchema []byte
+
+// The JSON type of each sites file field, matching sites.schema.json
+var siteFieldTypes = map[string]string{
+	"hosts":        "array of strings",
+	"publicDir":    "string",
+	"spaMode":      "boolean",
+	"configPrefix": "string",
+	"headersFile":  "string",
+	"default":      "boolean",
+	"mounts":       "object of strings",
+}
+
+type ConfigVar struct {
+	Name        string
+	Default     string
+	Description string
+}
+
+// Every environment variable, for `config print-defaults`
+var configVars = []ConfigVar{
+	{"PORT", "80", "The port to listen on"},
+	{"BIND", "", "Address to listen on, e.g. 127.0.0.1 or ::1. Empty is every interface"},
+	{"PUBLIC_DIR", "public", "The directory to serve, falling back to dist, build, out or _site"},
+	{"SPA_MODE", "0", "Serve index.html for paths that don't match a file"},
+	{"CONFIG_PREFIX", "VITE_", "Prefix of the environment variables injected into templates"},
+	{"CONFIG_EXCLUDE", "", "Comma separated globs of prefixed variables not to inject"},
+	{"CONFIG_ALLOW", "", "Comma separated globs of the only prefixed variables to inject"},
+	{"MOUNTS", "", "Comma separated /prefix=dir directories served below a URL prefix"},
+	{"INCLUDE_PATHS", "", "Comma separated globs, only matching files are served"},
+	{"EXCLUDE_PATHS", "", "Comma separated globs of files and directories that aren't served"},
+	{"SERVE_HIDDEN", "0", "Serve dotfiles and files that look like secrets"},
+	{"ALLOW_HIDDEN_PATHS", "", "Comma separated globs of hidden files and directories to serve anyway"},
+	{"SOURCEMAPS", "serve", "serve, none to leave out *.map files, or token to need the ADMIN_TOKEN for them"},
+	{"GITIGNORE", "0", "Also leave out files matching a .gitignore in the served directory"},
+	{"MAX_FILE_SIZE", "", "Largest file to hold in memory, e.g. 50MB"},
+	{"MAX_TOTAL_SIZE", "", "Most file content to hold in memory for a site, e.g. 1GB"},
+	{"STREAM_FILE_SIZE", "", "Files larger than this are streamed from disk, e.g. 10MB"},
+	{"MMAP_FILE_SIZE", "", "Files larger than this are memory mapped instead of read, e.g. 1MB"},
+	{"OVERSIZE", "skip", "What to do with files over the size limits: skip, stream or fail"},
+	{"MAX_CACHE_BYTES", "", "Most content per site to hold in memory, keeping the most requested files, e.g. 512MB"},
+	{"MAX_URL_LENGTH", "8192", "Longest request URL, 0 disables"},
+	{"MAX_HEADERS", "100", "Most request headers, 0 disables"},
+	{"MAX_HEADER_SIZE", "4KB", "Largest request line and headers"},
+	{"CONFIG_FILE", "nano-web.yaml", "YAML file of these settings, which the environment overrides"},
+	{"SITES_FILE", "", "JSON file configuring several sites selected by Host (see `nano-web config schema`)"},
+	{"HEADERS_FILE", "", "Path to a _headers file. Defaults to _headers in the public dir"},
+	{"RESCAN_INTERVAL", "0", "How often to reload when files change, e.g. 30s"},
+	{"CONFIGMAP_WATCH", "0", "Reload when a Kubernetes ConfigMap or Secret volume's ..data symlink moves"},
+	{"CONFIGMAP_WATCH_INTERVAL", "2s", "How often the ..data symlink is checked"},
+	{"ASSET_MANIFEST", "", "Manifest of fingerprinted assets to cache forever, found by default, or none"},
+	{"ASSET_MANIFEST_REWRITE", "0", "Set to 1 to point references in HTML at fingerprinted assets"},
+	{"VERSION_QUERY", "", "Comma separated query params, e.g. v, that mark a URL as versioned and cache it forever"},
+	{"BASIC_AUTH", "", "user:pass to protect the site with HTTP Basic Auth"},
+	{"BASIC_AUTH_FILE", "", "htpasswd file (bcrypt, apr1 or SHA) of users to protect the site with"},
+	{"BASIC_AUTH_REALM", "nano-web", "Realm for HTTP Basic Auth"},
+	{"CSP", "", "Content-Security-Policy for HTML pages, {{.Nonce}} is a fresh nonce per request"},
+	{"PERMISSIONS_POLICY", "", "Default Permissions-Policy, overridden per path by the headers file"},
+	{"REFERRER_POLICY", "", "Default Referrer-Policy, overridden per path by the headers file"},
+	{"ERROR_PAGE_404", "/404.html", "Page served with a 404 on misses, when it exists"},
+	{"ERROR_PAGE_500", "/50x.html", "Page served with a 500 when a request panics, when it exists"},
+	{"CHARSET", "utf-8", "Charset sent with text types, or none"},
+	{"CHARSETS", "", "Comma separated MIME type=charset overrides, e.g. text/csv=windows-1252"},
+	{"COMPRESS", "", "Comma separated extensions or MIME types to compress, e.g. .geojson"},
+	{"NO_COMPRESS", "", "Comma separated extensions or MIME types never to compress"},
+	{"LAZY_COMPRESSION", "0", "Set to 1 to compress files on first request instead of at startup"},
+	{"MINIFY", "0", "Set to 1 to minify .css and .js files that aren't already .min."},
+	{"PRECOMPRESSED", "0", "Serve .gz, .br and .zst files written by `nano-web precompress`"},
+	{"PROFILE", "production", "staging disallows robots and sets X-Robots-Tag: noindex"},
+	{"ROBOTS_TXT", "0", "Generate an allow-all robots.txt if there isn't one"},
+	{"SEARCH", "0", "Serve full-text search of HTML pages from /__search?q="},
+	{"EARLY_HINTS", "0", "Send 103 Early Hints for render-blocking resources"},
+	{"LOCALES", "", "Comma separated locale directories negotiated with Accept-Language"},
+	{"DEFAULT_LOCALE", "", "The locale used when nothing matches. Defaults to the first of LOCALES"},
+	{"QUERY_VARY", "", "Comma separated query parameters templated HTML can use as .Query"},
+	{"TRAILING_SLASH", "ignore", "add or remove to redirect directory indexes to one form, or ignore to serve both"},
+	{"LOCALE_REDIRECT", "0", "1 to redirect to localized paths instead of serving them, root to only redirect /"},
+	{"DOWNLOAD_PATHS", "", "Comma separated globs served with Content-Disposition: attachment"},
+	{"ZIP_DOWNLOADS", "0", "Serve a zip of a directory for ?download=zip"},
+	{"WEBDAV", "0", "Answer read-only WebDAV OPTIONS and PROPFIND requests"},
+	{"CROSS_ORIGIN_ISOLATED", "0", "Set the headers needed for SharedArrayBuffer"},
+	{"REPORTS", "0", "Accept CSP and NEL reports at /__reports"},
+	{"REPORTS_RATE", "60", "The most reports accepted per minute"},
+	{"STREAMING", "0", "CORS for audio, video and HLS/DASH players"},
+	{"S3_BUCKET", "", "Serve from an S3 compatible bucket"},
+	{"S3_PREFIX", "", "Only sync objects below this key prefix"},
+	{"S3_REGION", "us-east-1", "Defaults to AWS_REGION"},
+	{"S3_ENDPOINT", "", "Defaults to https://s3.$S3_REGION.amazonaws.com"},
+	{"S3_CACHE_DIR", "", "Where objects are synced to. Defaults to the temp dir"},
+	{"S3_POLL_INTERVAL", "60s", "How often to check the bucket for changes"},
+	{"GIT_REPO", "", "Serve from a git repository"},
+	{"GIT_BRANCH", "main", "The branch to check out"},
+	{"GIT_SUBDIR", "", "Serve a subdirectory of the repository"},
+	{"GIT_CHECKOUT_DIR", "", "Where the repository is checked out. Defaults to the temp dir"},
+	{"GIT_POLL_INTERVAL", "60s", "How often to fetch"},
+	{"GIT_WEBHOOK_SECRET", "", "Enables POST /__git, authenticated by X-Hub-Signature-256"},
+	{"OCI_REF", "", "Serve from an OCI artifact"},
+	{"OCI_SUBDIR", "", "Serve a subdirectory of the artifact"},
+	{"OCI_USERNAME", "", "Registry username"},
+	{"OCI_PASSWORD", "", "Registry password"},
+	{"OCI_INSECURE", "0", "Talk to the registry over plain HTTP"},
+	{"OCI_CACHE_DIR", "", "Where the artifact is unpacked. Defaults to the temp dir"},
+	{"OCI_POLL_INTERVAL", "5m", "How often to check a tag for a new digest"},
+	{"UNPACK_MAX_SIZE", "2GB", "Most a gzipped tarball may unpack to, 0 disables"},
+	{"UNPACK_MAX_FILES", "100000", "Most entries in a gzipped tarball, 0 disables"},
+	{"DEPLOY_TOKEN", "", "Enables the deploy API at /__deploy"},
+	{"DEPLOY_DIR", "", "Where deploys are unpacked. Defaults to the temp dir"},
+	{"DEPLOY_MAX_SIZE", "256MB", "The largest upload accepted"},
+	{"DEPLOY_RETAIN", "5", "How many deploys to keep for rollback, each held in memory"},
+	{"DEPLOY_ID", "", "The X-Deploy-Id sent on responses. Defaults to a hash of the content"},
+	{"SLOTS", "", "Comma separated name=dir blue/green slots"},
+	{"SLOT_ACTIVE", "", "The slot live at startup. Defaults to the first"},
+	{"CANARY_DIR", "", "Serve a percentage of visitors from this directory"},
+	{"CANARY_PERCENT", "10", "The percentage of visitors served the canary"},
+	{"CANARY_STICKY", "cookie", "cookie, or ip to assign by client address"},
+	{"AB_VARIANTS", "", "Comma separated variant subdirectories to split visitors between for HTML"},
+	{"AB_SPLIT", "", "Comma separated weights for AB_VARIANTS. Defaults to an even split"},
+	{"AB_SECRET", "", "Key signing the bucket cookie. Defaults to a random key per process"},
+	{"PREVIEW_DIR", "", "Serve previews from subdirectories of this directory"},
+	{"PREVIEW_HEADER", "X-Preview", "The header selecting a preview"},
+	{"PREVIEW_COOKIE", "nano_preview", "The cookie selecting a preview"},
+	{"PREVIEW_MAX", "20", "How many previews to keep populated"},
+	{"INTEGRITY_MANIFEST", "", "Verify content against this signed manifest"},
+	{"INTEGRITY_SIGNATURE", "", "Defaults to $INTEGRITY_MANIFEST.sig"},
+	{"INTEGRITY_KEY", "", "Base64 ed25519 public key the manifest is signed with"},
+	{"INTEGRITY_MODE", "strict", "strict refuses to serve mismatched content, flag reports it"},
+	{"TLS_CERT", "", "PEM certificate (chain) file to serve HTTPS with"},
+	{"TLS_KEY", "", "PEM private key file for TLS_CERT"},
+	{"TLS_MIN_VERSION", "", "Lowest TLS version to accept: 1.0, 1.1, 1.2 or 1.3"},
+	{"TLS_CIPHERS", "", "Comma separated Go cipher suite names to allow"},
+	{"TLS_OCSP_STAPLING", "0", "Set to 1 to staple OCSP responses"},
+	{"HTTP3", "0", "Set to 1 to also serve HTTP/3 over QUIC (needs TLS)"},
+	{"ADMIN_ADDR", "", "Serve built-in endpoints and pprof on this address instead, e.g. 127.0.0.1:9090"},
+	{"ADMIN_TOKEN", "", "Bearer token for admin endpoints such as /__reload"},
+	{"MISS_CACHE_SIZE", "10000", "How many not found paths to answer early, without logging. 0 turns it off"},
+	{"FOLLOW_SYMLINKS", "0", "Serve symlinks that point outside the public dir"},
+	{"STRICT", "0", "Refuse to start, or to reload, when any file can't be served"},
+	{"HEALTH", "0", "Serve /__health"},
+	{"SELF_CHECK_PATH", "", "A route fetched through the server on an interval to check it's served correctly"},
+	{"SELF_CHECK_INTERVAL", "30s", "How often the self-check runs"},
+	{"HEARTBEAT_URL", "", "GET after every passing self-check, for uptime monitors"},
+	{"STATS", "0", "Serve /__stats and the /__dashboard over it"},
+	{"MANIFEST", "0", "Serve /_manifest"},
+	{"VERSION_ENDPOINT", "0", "Serve /_version"},
+	{"ROUTE_EVENTS_URL", "", "POST added, refreshed and removed routes here as JSON on every reload"},
+	{"METRICS", "", "prometheus to serve /__metrics, pushgateway to push them, or statsd"},
+	{"STATSD_ADDR", "localhost:8125", "Where StatsD metrics are sent"},
+	{"METRICS_PUSH_URL", "", "The Pushgateway group URL, e.g. http://pushgateway:9091/metrics/job/nano-web"},
+	{"METRICS_PUSH_INTERVAL", "15s", "How often metrics are pushed"},
+	{"LUA_SCRIPT", "", "Lua script with on_request and on_response hooks"},
+	{"MIRROR_URL", "", "Copy requests to this origin in the background"},
+	{"MIRROR_PERCENT", "100", "The percentage of requests mirrored"},
+	{"CHAOS", "0", "Inject latency, errors and dropped connections, for testing clients"},
+	{"CHAOS_LATENCY", "0", "Latency added to every request, or a random range such as 100ms-2s"},
+	{"CHAOS_ERROR_PERCENT", "0", "Percentage of requests answered with a random 5xx"},
+	{"CHAOS_DROP_PERCENT", "0", "Percentage of connections dropped without a response"},
+	{"ALERT_WEBHOOK_URL", "", "POST alerts here when 5xx or 404 rates go over their thresholds"},
+	{"ALERT_WINDOW", "1m", "The rolling window alert rates are measured over"},
+	{"ALERT_ERROR_RATE", "5", "The percentage of 5xx responses that alerts"},
+	{"ALERT_NOT_FOUND_RATE", "20", "The percentage of 404 responses that alerts"},
+	{"ALERT_MIN_REQUESTS", "20", "How many requests the window needs before alerting"},
+	{"ALERT_COOLDOWN", "10m", "The least time between alerts of the same kind"},
+	{"ALERT_FORMAT", "", "slack to send Slack messages. Detected for hooks.slack.com"},
+	{"GEOIP_DB", "", "MaxMind country database to tag requests with"},
+	{"GEOIP_ASN_DB", "", "MaxMind ASN database to tag requests with"},
+	{"GEOIP_IP_HEADER", "", "Header to read the client IP from, such as X-Forwarded-For"},
+	{"GEOIP_IP_HOPS", "1", "How many trusted proxies append to GEOIP_IP_HEADER"},
+	{"GEO_ALLOW", "", "Comma separated country codes to serve, others are answered with a 451"},
+	{"GEO_BLOCK", "", "Comma separated country codes answered with a 451"},
+	{"GEOIP_RELOAD_INTERVAL", "1m", "How often to check the GeoIP databases for updates, 0 disables"},
+	{"GEO_REDIRECT", "", "Comma separated country=prefix redirects"},
+	{"EXIT_AFTER", "0", "Shut down after this long, e.g. 30s"},
+	{"EXIT_AFTER_REQUESTS", "0", "Shut down after this many requests"},
+	{"AUDIT_LOG", "", "File, stdout or stderr to log refused requests to as JSON lines"},
+	{"ACCESS_LOG_FORMAT", "text", "ecs to log each request as an Elastic Common Schema JSON document"},
+	{"ANONYMIZE_IP", "0", "Mask the last octet (or 80 bits) of client IPs in logs"},
+	{"ANONYMIZE_USER_AGENT", "0", "Drop OS and device details from user agents in logs"},
+	{"STARTUP_OUTPUT", "text", "json prints the startup summary as JSON on stdout and logs to stderr"},
+	{"NANO_WEB_URL", "", "The server commands talk to. Defaults to http://localhost:$PORT, or ADMIN_ADDR"},
+}
+
+// Invalid settings found as the package reads the environment, returned by
+// NewServer instead of exiting whatever program imported the package
+var configErrors []error
+
+func configError(format string, a ...interface{}) {
+	configErrors = append(configErrors, fmt.Errorf(format, a...))
+}
+
+func configErr() error {
+	return errors.Join(configErrors...)
+}
+
+func configCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: nano-web config validate [file] | schema | print-defaults")
+		return 2
+	}
+	switch args[0] {
+	case "validate":
+		file := getEnv("SITES_FILE", "")
+		if len(args) > 1 {
+			file = args[1]
+		}
+		if file == "" {
+			fmt.Fprintln(os.Stderr, "usage: nano-web config validate file")
+			return 2
+		}
+		problems, err := validateSitesFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", file, problem)
+		}
+		if len(problems) > 0 {
+			return 1
+		}
+		fmt.Println(file, "is valid")
+	case "schema":
+		os.Stdout.Write(sitesSchema)
+	case "print-defaults":
+		for _, config := range configVars {
+			fmt.Printf("# %s\n%s=%s\n\n", config.Description, config.Name, config.Default)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown config command %q\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// The line and column of an offset into a file
+func position(dat []byte, offset int64) string {
+	before := dat[:min(int(offset), len(dat))]
+	line := strings.Count(string(before), "\n") + 1
+	column := len(before) - strings.LastIndex(string(before), "\n")
+	return fmt.Sprintf("%d:%d", line, column)
+}
+
+// Check a sites file, returning every problem with where it is
+func validateSitesFile(file string) ([]string, error) {
+	dat, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var configs []map[string]json.RawMessage
+	if err := json.Unmarshal(dat, &configs); err != nil {
+		var syntaxError *json.SyntaxError
+		var typeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxError):
+			return []string{position(dat, syntaxError.Offset) + ": " + err.Error()}, nil
+		case errors.As(err, &typeError):
+			return []string{position(dat, typeError.Offset) + ": expected an array of site objects"}, nil
+		}
+		return []string{err.Error()}, nil
+	}
+	if len(configs) == 0 {
+		return []string{"no sites configured"}, nil
+	}
+	problems := []string{}
+	defaults := 0
+	for i, config := range configs {
+		location := fmt.Sprintf("[%d]", i)
+		keys := make([]string, 0, len(config))
+		for key := range config {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, known := siteFieldTypes[key]; !known {
+				problems = append(problems, fmt.Sprintf("%s.%s: unknown field", location, key))
+			}
+		}
+		var site Site
+		for _, key := range keys {
+			fieldType, known := siteFieldTypes[key]
+			if !known {
+				continue
+			}
+			if err := json.Unmarshal([]byte(fmt.Sprintf("{%q:%s}", key, config[key])), &site); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.%s: expected %s", location, key, fieldType))
+			}
+		}
+		if site.PublicDir == "" {
+			problems = append(problems, location+".publicDir: required")
+		} else if info, err := os.Stat(site.PublicDir); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("%s.publicDir: directory %q not found", location, site.PublicDir))
+		}
+		for j, host := range site.Hosts {
+			if _, err := compileGlob(strings.ToLower(host)); err != nil || host == "" {
+				problems = append(problems, fmt.Sprintf("%s.hosts[%d]: invalid host pattern %q", location, j, host))
+			}
+		}
+		for _, mount := range site.Mounts {
+			if info, err := os.Stat(mount.Dir); err != nil || !info.IsDir() {
+				problems = append(problems, fmt.Sprintf("%s.mounts[%q]: directory %q not found", location, mount.Prefix, mount.Dir))
+			}
+		}
+		if site.HeadersFile != "" {
+			if _, err := os.Stat(site.HeadersFile); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.headersFile: %q not found", location, site.HeadersFile))
+			}
+		}
+		if site.Default {
+			defaults++
+			if defaults > 1 {
+				problems = append(problems, location+".default: only one site can be the default")
+			}
+		}
+	}
+	return problems, nil
+}
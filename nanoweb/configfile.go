@@ -0,0 +1,102 @@
+package nanoweb
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const configFileName = "nano-web.yaml"
+
+// Settings from nano-web.yaml in the working directory, or CONFIG_FILE. Keys
+// are the environment variables, which take precedence over the file.
+var fileConfig = sync.OnceValue(func() map[string]string {
+	file, set := os.LookupEnv("CONFIG_FILE")
+	if !set {
+		file = configFileName
+	}
+	dat, err := os.ReadFile(file)
+	if os.IsNotExist(err) && !set {
+		return map[string]string{}
+	}
+	if err != nil {
+		configError("couldn't read config file: %s", err)
+		return map[string]string{}
+	}
+	config, err := parseConfigFile(dat)
+	if err != nil {
+		configError("invalid config file %s: %s", file, err)
+		return map[string]string{}
+	}
+	return config
+})
+
+// Parse a YAML map of settings. Booleans become 1 or 0 and lists are comma
+// separated, as they would be in the environment.
+func parseConfigFile(dat []byte) (map[string]string, error) {
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(dat, &values); err != nil {
+		return nil, err
+	}
+	config := make(map[string]string, len(values))
+	for key, value := range values {
+		setting, err := configValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", key, err)
+		}
+		config[key] = setting
+	}
+	return config, nil
+}
+
+func configValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case bool:
+		if value {
+			return "1", nil
+		}
+		return "0", nil
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			setting, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = setting
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		return "", fmt.Errorf("expected a value or list, not a map")
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// A setting from the environment, or the config file
+func lookupEnv(name string) (string, bool) {
+	if value, exists := os.LookupEnv(name); exists {
+		return value, true
+	}
+	value, exists := fileConfig()[name]
+	return value, exists
+}
+
+// Every setting, environment variables over the config file, as KEY=value
+func environ() []string {
+	config := fileConfig()
+	env := make([]string, 0, len(config))
+	for key, value := range config {
+		if _, exists := os.LookupEnv(key); !exists {
+			env = append(env, key+"="+value)
+		}
+	}
+	sort.Strings(env)
+	return append(env, os.Environ()...)
+}
@@ -0,0 +1,39 @@
+package nanoweb
+
+import "testing"
+
+func TestParseConfigFile(t *testing.T) {
+	config, err := parseConfigFile([]byte(`
+SPA_MODE: true
+GITIGNORE: false
+PORT: 8080
+EXCLUDE_PATHS: [/drafts/**, "*.psd"]
+VITE_API_URL: https://api.example.com
+BIND:
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"SPA_MODE":      "1",
+		"GITIGNORE":     "0",
+		"PORT":          "8080",
+		"EXCLUDE_PATHS": "/drafts/**,*.psd",
+		"VITE_API_URL":  "https://api.example.com",
+		"BIND":          "",
+	}
+	if len(config) != len(want) {
+		t.Errorf("%d settings, want %d: %v", len(config), len(want), config)
+	}
+	for key, value := range want {
+		if config[key] != value {
+			t.Errorf("%s = %q, want %q", key, config[key], value)
+		}
+	}
+
+	for _, dat := range []string{"MOUNTS:\n  /docs: /srv/docs\n", "- a\n- b\n", "PORT: [\n"} {
+		if _, err := parseConfigFile([]byte(dat)); err == nil {
+			t.Errorf("%q parsed", dat)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package nanoweb
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Kubernetes ConfigMap and Secret volumes are updated by writing a new
+// timestamped directory and repointing the ..data symlink at it. With
+// CONFIGMAP_WATCH=1 the symlink is polled and the whole site reloaded when it
+// moves, instead of catching files mid-swap.
+var configMapWatch = getEnv("CONFIGMAP_WATCH", "0") == "1"
+
+const configMapData = "..data"
+
+func getConfigMapInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("CONFIGMAP_WATCH_INTERVAL", "2s"))
+	if err != nil || interval <= 0 {
+		configError("invalid CONFIGMAP_WATCH_INTERVAL %q", getEnv("CONFIGMAP_WATCH_INTERVAL", ""))
+		return 2 * time.Second
+	}
+	return interval
+}
+
+// Whether a file system is a ConfigMap or Secret volume, whose .. entries
+// are Kubernetes' own and never served
+func isConfigMapFS(fsys fs.FS) bool {
+	_, err := fs.Stat(fsys, configMapData)
+	return err == nil
+}
+
+// Where the ..data symlink of each of a site's volumes points
+func (site *Site) configMapTargets() map[string]string {
+	targets := make(map[string]string)
+	dirs := []string{site.PublicDir}
+	for _, mount := range site.Mounts {
+		dirs = append(dirs, mount.Dir)
+	}
+	for _, dir := range dirs {
+		if target, err := os.Readlink(filepath.Join(dir, configMapData)); err == nil {
+			targets[dir] = target
+		}
+	}
+	return targets
+}
+
+func watchConfigMaps(interval time.Duration) {
+	watched := make(map[*Site]map[string]string)
+	for _, site := range sites {
+		if site.FS != nil {
+			continue
+		}
+		if targets := site.configMapTargets(); len(targets) > 0 {
+			watched[site] = targets
+		}
+	}
+	if len(watched) == 0 {
+		logln("⇨ CONFIGMAP_WATCH is set but no site is served from a ConfigMap volume")
+		return
+	}
+	for range time.Tick(interval) {
+		for site, previous := range watched {
+			targets := site.configMapTargets()
+			if mapsEqual(targets, previous) {
+				continue
+			}
+			logln("⇨", site.PublicDir, "ConfigMap updated, reloading")
+			watched[site] = targets
+			reloadMu.Lock()
+			site.Reload()
+			reloadMu.Unlock()
+		}
+	}
+}
+
+func mapsEqual(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if b[key] != value {
+			return false
+		}
+	}
+	return true
+}
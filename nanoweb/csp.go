@@ -0,0 +1,70 @@
+package nanoweb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// CSP is sent as the Content-Security-Policy of HTML pages, with {{.Nonce}}
+// replaced by a fresh nonce for every request. Templates get the same nonce
+// as {{.Nonce}}: pages are rendered once with a marker in its place, and the
+// marker is swapped for the nonce as they're served.
+var cspPolicy = getEnv("CSP", "")
+
+var nonceMarker = newNonceMarker()
+
+func newNonceMarker() string {
+	if cspPolicy == "" {
+		return ""
+	}
+	marker := make([]byte, 16)
+	rand.Read(marker)
+	return "nano-web-nonce-" + hex.EncodeToString(marker)
+}
+
+func newNonce() string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(nonce)
+}
+
+// Whether a page was rendered with the nonce marker
+func hasNonce(content []byte) bool {
+	return nonceMarker != "" && bytes.Contains(content, []byte(nonceMarker))
+}
+
+// Send the page's policy with a fresh nonce, returning the nonce
+func setCSP(ctx *fasthttp.RequestCtx) string {
+	nonce := newNonce()
+	ctx.Response.Header.Set("Content-Security-Policy", strings.ReplaceAll(cspPolicy, "{{.Nonce}}", nonce))
+	return nonce
+}
+
+// Serve a page with the nonce in place of the marker. The body is different
+// every time, so it's compressed as it's sent and never cached.
+func serveNonced(ctx *fasthttp.RequestCtx, route Route, nonce string) {
+	content := bytes.ReplaceAll(route.Content.Plain, []byte(nonceMarker), []byte(nonce))
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	if route.compressed() {
+		ctx.Response.Header.Add("Vary", "Accept-Encoding")
+		switch getAcceptedEncoding(ctx) {
+		case "br":
+			ctx.Response.Header.Set("Content-Encoding", "br")
+			content = fasthttp.AppendBrotliBytesLevel(nil, content, fasthttp.CompressBrotliDefaultCompression)
+		case "gzip":
+			ctx.Response.Header.Set("Content-Encoding", "gzip")
+			content = fasthttp.AppendGzipBytesLevel(nil, content, fasthttp.CompressDefaultCompression)
+		}
+	}
+	ctx.Response.Header.SetContentLength(len(content))
+	if ctx.IsHead() {
+		ctx.Response.SkipBody = true
+		return
+	}
+	ctx.Response.SetBodyRaw(content)
+}
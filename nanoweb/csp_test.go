@@ -0,0 +1,57 @@
+package nanoweb
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Each request gets a fresh nonce, the same in the policy and the page
+func TestCSPNonces(t *testing.T) {
+	previousPolicy, previousMarker := cspPolicy, nonceMarker
+	cspPolicy = "script-src 'nonce-{{.Nonce}}'"
+	nonceMarker = newNonceMarker()
+	t.Cleanup(func() { cspPolicy, nonceMarker = previousPolicy, previousMarker })
+	testSite(t, map[string]string{
+		"index.html": `<html><body><script nonce="{{.Nonce}}">run()</script></body></html>`,
+		"plain.html": "<html><body>plain</body></html>",
+	})
+
+	policyNonce := regexp.MustCompile(`^script-src 'nonce-([^']+)'$`)
+	pageNonce := regexp.MustCompile(`<script nonce="([^"]+)">`)
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		ctx := serve("/")
+		policy := policyNonce.FindStringSubmatch(string(ctx.Response.Header.Peek("Content-Security-Policy")))
+		page := pageNonce.FindStringSubmatch(string(ctx.Response.Body()))
+		if policy == nil || page == nil || policy[1] != page[1] {
+			t.Fatalf("policy %v and page %v nonces differ", policy, page)
+		}
+		if seen[policy[1]] {
+			t.Errorf("nonce %s reused", policy[1])
+		}
+		seen[policy[1]] = true
+		if strings.Contains(string(ctx.Response.Body()), nonceMarker) {
+			t.Error("the nonce marker was served")
+		}
+		if cacheControl := string(ctx.Response.Header.Peek("Cache-Control")); cacheControl != "no-store" {
+			t.Errorf("Cache-Control %q, want no-store", cacheControl)
+		}
+	}
+
+	// Compressed as it's sent
+	ctx := serveWith("/", map[string]string{"Accept-Encoding": "gzip"})
+	body, err := ctx.Response.BodyGunzip()
+	if err != nil || pageNonce.FindSubmatch(body) == nil {
+		t.Errorf("gzipped page %q: %v", body, err)
+	}
+
+	// Pages without a nonce get the policy and are cached as usual
+	plain := serve("/plain.html")
+	if policy := string(plain.Response.Header.Peek("Content-Security-Policy")); policyNonce.FindStringSubmatch(policy) == nil {
+		t.Errorf("plain page policy %q", policy)
+	}
+	if cacheControl := string(plain.Response.Header.Peek("Cache-Control")); cacheControl == "no-store" {
+		t.Error("plain page not cached")
+	}
+}
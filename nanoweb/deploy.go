@@ -0,0 +1,303 @@
+package nanoweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const deployPath = "/__deploy"
+
+// Accepts uploaded builds, unpacking each into its own directory under Dir
+// and pointing the Dir/current symlink that the site is served from at it
+type Deployer struct {
+	Dir     string
+	Token   string
+	MaxSize int
+	Retain  int
+
+	mu sync.Mutex
+	// The route tables of retained deploys, for instant rollbacks. Each holds
+	// the whole site in memory, so Retain is what bounds them.
+	snapshots map[string]*RouteTable
+}
+
+var deployer = getDeployer()
+
+func getDeployer() *Deployer {
+	token := getEnv("DEPLOY_TOKEN", "")
+	if token == "" {
+		return nil
+	}
+	maxSize, err := parseSize(getEnv("DEPLOY_MAX_SIZE", "256MB"))
+	if err != nil {
+		configError("invalid DEPLOY_MAX_SIZE: %s", err)
+		return nil
+	}
+	retain, err := strconv.Atoi(getEnv("DEPLOY_RETAIN", "5"))
+	if err != nil || retain < 1 {
+		retain = 5
+	}
+	// Symlink targets are relative to the link, so keep everything absolute
+	dir, err := filepath.Abs(getEnv("DEPLOY_DIR", filepath.Join(os.TempDir(), "nano-web-deploys")))
+	if err != nil {
+		configError("invalid DEPLOY_DIR: %s", err)
+		return nil
+	}
+	return &Deployer{
+		Dir:       dir,
+		Token:     token,
+		MaxSize:   int(maxSize),
+		Retain:    retain,
+		snapshots: make(map[string]*RouteTable),
+	}
+}
+
+// Whether a path is one of the deploy API's, rather than a site path that
+// happens to start the same way
+func isDeployPath(path string) bool {
+	return path == deployPath || strings.HasPrefix(path, deployPath+"/")
+}
+
+// Uploads are the only requests allowed bodies over the default limit, so
+// this is 0 for anything else
+func (deployer *Deployer) bodySize(method string, path string) int {
+	if deployer == nil || method != fasthttp.MethodPost || path != deployPath {
+		return 0
+	}
+	return deployer.MaxSize
+}
+
+// Raise the body limit for uploads once their headers are read
+func (deployer *Deployer) requestConfig(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+	path, _, _ := strings.Cut(string(header.RequestURI()), "?")
+	return fasthttp.RequestConfig{MaxRequestBodySize: deployer.bodySize(string(header.Method()), path)}
+}
+
+// Parse a byte size like 512KB, 256MB or 1GB
+func parseSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		Suffix     string
+		Multiplier int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if trimmed, found := strings.CutSuffix(size, unit.Suffix); found {
+			size, multiplier = strings.TrimSpace(trimmed), unit.Multiplier
+			break
+		}
+	}
+	var value int64
+	if _, err := fmt.Sscan(size, &value); err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return value * multiplier, nil
+}
+
+func (deployer *Deployer) CurrentDir() string {
+	return filepath.Join(deployer.Dir, "current")
+}
+
+// Point current at the initial public dir if nothing has been deployed yet
+func (deployer *Deployer) Init(initialDir string) error {
+	if err := os.MkdirAll(deployer.Dir, 0755); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(deployer.CurrentDir()); err == nil {
+		return nil
+	}
+	initialDir, err := filepath.Abs(initialDir)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(initialDir, deployer.CurrentDir())
+}
+
+// Atomically repoint the current symlink
+func (deployer *Deployer) Activate(target string) error {
+	return replaceSymlink(deployer.CurrentDir(), target)
+}
+
+type DeployRecord struct {
+	ID      string    `json:"id"`
+	Target  string    `json:"target"`
+	Time    time.Time `json:"time"`
+	Current bool      `json:"current"`
+}
+
+func (deployer *Deployer) recordPath(id string) string {
+	return filepath.Join(deployer.Dir, id+".json")
+}
+
+// List retained deploys, oldest first
+func (deployer *Deployer) Records() []DeployRecord {
+	current, _ := os.Readlink(deployer.CurrentDir())
+	paths, _ := filepath.Glob(filepath.Join(deployer.Dir, "*.json"))
+	sort.Strings(paths)
+	records := []DeployRecord{}
+	for _, path := range paths {
+		dat, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var record DeployRecord
+		if err := json.Unmarshal(dat, &record); err != nil {
+			continue
+		}
+		record.Current = record.Target == current
+		records = append(records, record)
+	}
+	return records
+}
+
+// Remove all but the newest Retain deploys, never removing the live one
+func (deployer *Deployer) prune() {
+	records := deployer.Records()
+	for i := 0; i < len(records)-deployer.Retain; i++ {
+		if records[i].Current {
+			continue
+		}
+		logln("⇨ pruning deploy", records[i].ID)
+		os.RemoveAll(filepath.Join(deployer.Dir, records[i].ID))
+		os.Remove(deployer.recordPath(records[i].ID))
+		delete(deployer.snapshots, records[i].ID)
+	}
+}
+
+// Swap a deploy in, reusing its route table snapshot if it's still in memory.
+// If the deploy is refused, e.g. by STRICT, the live one is put back. It holds
+// reloadMu throughout, so a concurrent reload can't swap in the tree from
+// before or during the switch.
+func (deployer *Deployer) activateRecord(site *Site, record DeployRecord) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	previousTarget, _ := os.Readlink(deployer.CurrentDir())
+	previousID := site.deployID.Load()
+	if err := deployer.Activate(record.Target); err != nil {
+		return err
+	}
+	site.SetDeployID(record.ID)
+	if table, exists := deployer.snapshots[record.ID]; exists {
+		site.swapTable(table)
+		return nil
+	}
+	if err := site.Reload(); err != nil {
+		site.deployID.Store(previousID)
+		if previousTarget != "" {
+			deployer.Activate(previousTarget)
+		}
+		return err
+	}
+	deployer.snapshots[record.ID] = site.Table()
+	return nil
+}
+
+func (deployer *Deployer) deploy(ctx *fasthttp.RequestCtx, site *Site) {
+	body := ctx.PostBody()
+	hash := sha256.Sum256(body)
+	id := time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(hash[:4])
+	dir := filepath.Join(deployer.Dir, id)
+	if err := extractTarGz(body, dir); err != nil {
+		os.RemoveAll(dir)
+		ctx.Error("Bad Request: "+err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+	target := dir
+	if subdir := string(ctx.QueryArgs().Peek("subdir")); subdir != "" {
+		joined, err := safeJoin(dir, subdir)
+		if err != nil {
+			os.RemoveAll(dir)
+			ctx.Error("Bad Request: invalid subdir", fasthttp.StatusBadRequest)
+			return
+		}
+		if info, err := os.Stat(joined); err != nil || !info.IsDir() {
+			os.RemoveAll(dir)
+			ctx.Error("Bad Request: subdir isn't a directory in the upload", fasthttp.StatusBadRequest)
+			return
+		}
+		target = joined
+	}
+	record := DeployRecord{ID: id, Target: target, Time: time.Now().UTC()}
+	dat, _ := json.Marshal(record)
+	if err := os.WriteFile(deployer.recordPath(id), dat, 0644); err != nil {
+		logln("⇨ error recording deploy", id, err)
+	}
+	if err := deployer.activateRecord(site, record); err != nil {
+		logln("⇨ error activating deploy", id, err)
+		os.RemoveAll(dir)
+		os.Remove(deployer.recordPath(id))
+		ctx.Error("Unprocessable Entity: "+err.Error(), fasthttp.StatusUnprocessableEntity)
+		return
+	}
+	logln("⇨ deployed", id)
+	deployer.prune()
+
+	writeJSON(ctx, fasthttp.StatusCreated, map[string]interface{}{
+		"id":     id,
+		"routes": len(site.Table().Routes),
+	})
+}
+
+// Roll back to the given deploy, or the one before the live one
+func (deployer *Deployer) rollback(ctx *fasthttp.RequestCtx, site *Site) {
+	records := deployer.Records()
+	id := string(ctx.QueryArgs().Peek("id"))
+	var target *DeployRecord
+	for i := range records {
+		if id != "" && records[i].ID == id {
+			target = &records[i]
+		}
+		if id == "" && records[i].Current && i > 0 {
+			target = &records[i-1]
+		}
+	}
+	if target == nil {
+		ctx.Error("Not Found: no deploy to roll back to", fasthttp.StatusNotFound)
+		return
+	}
+	if err := deployer.activateRecord(site, *target); err != nil {
+		logln("⇨ error rolling back to", target.ID, err)
+		ctx.Error("Internal Server Error", fasthttp.StatusInternalServerError)
+		return
+	}
+	logln("⇨ rolled back to", target.ID)
+	writeJSON(ctx, fasthttp.StatusOK, map[string]interface{}{
+		"id":     target.ID,
+		"routes": len(site.Table().Routes),
+	})
+}
+
+// POST uploads a gzipped tarball of a build, which is only swapped in once
+// it has been fully unpacked. GET lists retained deploys and
+// POST /__deploy/rollback reverts to an earlier one.
+func (deployer *Deployer) handler(ctx *fasthttp.RequestCtx, site *Site) {
+	if !bearerAuthorized(ctx, deployer.Token) {
+		unauthorized(ctx)
+		return
+	}
+	deployer.mu.Lock()
+	defer deployer.mu.Unlock()
+
+	switch action := strings.TrimPrefix(string(ctx.Path()), deployPath); {
+	case action == "" && ctx.IsPost():
+		deployer.deploy(ctx, site)
+	case action == "" && ctx.IsGet():
+		writeJSON(ctx, fasthttp.StatusOK, deployer.Records())
+	case action == "/rollback" && ctx.IsPost():
+		deployer.rollback(ctx, site)
+	case action == "" || action == "/rollback":
+		ctx.Error("Method Not Allowed", fasthttp.StatusMethodNotAllowed)
+	default:
+		ctx.Error("Not Found", fasthttp.StatusNotFound)
+	}
+}
@@ -0,0 +1,127 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Serve the default site from a deployer's current symlink, starting with
+// an initial public dir
+func testDeployer(t *testing.T) *Site {
+	t.Helper()
+	site := testSite(t, map[string]string{"index.html": "initial"})
+	previous := deployer
+	deployer = &Deployer{Dir: filepath.Join(t.TempDir(), "deploys"), Token: "token", MaxSize: 10 << 20, Retain: 5, snapshots: make(map[string]*RouteTable)}
+	t.Cleanup(func() { deployer = previous })
+	if err := deployer.Init(site.PublicDir); err != nil {
+		t.Fatal(err)
+	}
+	site.PublicDir = deployer.CurrentDir()
+	return site
+}
+
+// Upload a build, returning the response status and the deploy's ID
+func upload(t *testing.T, files map[string]string) (int, string) {
+	t.Helper()
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx.Request.SetRequestURI(deployPath)
+	ctx.Request.Header.Set("Authorization", "Bearer token")
+	ctx.Request.SetBody(testTarGz(t, files))
+	handler(ctx)
+	var response struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(ctx.Response.Body(), &response)
+	return ctx.Response.StatusCode(), response.ID
+}
+
+func servedBody() string {
+	return string(serve("/").Response.Body())
+}
+
+func TestDeployAndRollback(t *testing.T) {
+	testDeployer(t)
+	auth := map[string]string{"Authorization": "Bearer token"}
+
+	status, first := upload(t, map[string]string{"index.html": "first"})
+	if status != 201 || servedBody() != "first" {
+		t.Fatalf("first deploy: status %d serving %q", status, servedBody())
+	}
+	status, second := upload(t, map[string]string{"index.html": "second"})
+	if status != 201 || servedBody() != "second" {
+		t.Fatalf("second deploy: status %d serving %q", status, servedBody())
+	}
+
+	// A deploy STRICT refuses puts the live one back
+	previous := strictMode
+	strictMode = true
+	t.Cleanup(func() { strictMode = previous })
+	if status, _ := upload(t, map[string]string{"index.html": "broken", "_redirects": "/only\n"}); status != 422 {
+		t.Errorf("refused deploy: status %d, want 422", status)
+	}
+	if body := servedBody(); body != "second" {
+		t.Errorf("after a refused deploy serving %q", body)
+	}
+	var records []DeployRecord
+	json.Unmarshal(serveMethod("GET", deployPath, auth).Response.Body(), &records)
+	if len(records) != 2 || !records[0].Current && !records[1].Current {
+		t.Errorf("after a refused deploy listing %+v", records)
+	}
+
+	rollback := serveMethod("POST", deployPath+"/rollback?id="+first, auth)
+	if status := rollback.Response.StatusCode(); status != 200 || servedBody() != "first" {
+		t.Errorf("rollback: status %d serving %q", status, servedBody())
+	}
+	// Rolling forward again uses the snapshot
+	if status := serveMethod("POST", deployPath+"/rollback?id="+second, auth).Response.StatusCode(); status != 200 || servedBody() != "second" {
+		t.Errorf("roll forward: status %d serving %q", status, servedBody())
+	}
+
+	tests := []struct {
+		method string
+		uri    string
+		token  string
+		status int
+	}{
+		{"GET", deployPath, "wrong", 401},
+		{"POST", deployPath + "/rollback?id=unknown", "token", 404},
+		{"DELETE", deployPath, "token", 405},
+		{"GET", deployPath + "/other", "token", 404},
+	}
+	for _, test := range tests {
+		ctx := serveMethod(test.method, test.uri, map[string]string{"Authorization": "Bearer " + test.token})
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s %s: status %d, want %d", test.method, test.uri, status, test.status)
+		}
+	}
+}
+
+// A deploy waits for a reload in progress, so the reload can't swap the tree
+// from before the deploy back in after it
+func TestDeployWaitsForReload(t *testing.T) {
+	testDeployer(t)
+	reloadMu.Lock()
+	done := make(chan int)
+	go func() {
+		status, _ := upload(t, map[string]string{"index.html": "deployed"})
+		done <- status
+	}()
+	select {
+	case <-done:
+		reloadMu.Unlock()
+		t.Fatal("deployed during a reload")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if body := servedBody(); body != "initial" {
+		t.Errorf("during a reload serving %q", body)
+	}
+	reloadMu.Unlock()
+	if status := <-done; status != 201 || servedBody() != "deployed" {
+		t.Errorf("after the reload: status %d serving %q", status, servedBody())
+	}
+}
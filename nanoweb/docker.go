@@ -0,0 +1,128 @@
+package nanoweb
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+const imageDockerfile = `FROM scratch
+COPY nano-web /nano-web
+COPY public /public
+ENV PORT=80
+ENV PUBLIC_DIR=/public
+ENV HEALTH=1
+EXPOSE 80
+HEALTHCHECK --interval=30s --timeout=3s CMD ["/nano-web", "healthcheck"]
+ENTRYPOINT ["/nano-web"]
+`
+
+// Write a Docker build context with this binary and a site, optionally
+// building it
+func dockerCommand(args []string) int {
+	flags := flag.NewFlagSet("docker", flag.ContinueOnError)
+	out := flags.String("out", "nano-web-image", "where to write the build context")
+	tag := flags.String("build", "", "build the image with this tag")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	dir := getPublicDir()
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+	if runtime.GOOS != "linux" {
+		fmt.Fprintln(os.Stderr, "images need a linux binary, run the docker command from one built with GOOS=linux")
+		return 1
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.RemoveAll(filepath.Join(*out, "public"))
+	if err := copyFile(binary, filepath.Join(*out, "nano-web"), 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := copyDir(dir, filepath.Join(*out, "public")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.WriteFile(filepath.Join(*out, "Dockerfile"), []byte(imageDockerfile), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *tag == "" {
+		fmt.Printf("wrote %s, build it with:\n  docker build -t my-site %s\n", *out, *out)
+		return 0
+	}
+	cmd := exec.Command("docker", "build", "-t", *tag, *out)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func copyFile(source string, target string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func copyDir(source string, target string) error {
+	return filepath.WalkDir(source, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, name)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return os.MkdirAll(filepath.Join(target, rel), 0755)
+		}
+		return copyFile(name, filepath.Join(target, rel), 0644)
+	})
+}
+
+// Exit 0 if the running server's health check passes, for container
+// HEALTHCHECKs where there's no curl
+func healthcheckCommand(args []string) int {
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Get(getServerURL() + healthPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		fmt.Fprintln(os.Stderr, res.Status, string(body))
+		return 1
+	}
+	return 0
+}
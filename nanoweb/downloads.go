@@ -0,0 +1,85 @@
+package nanoweb
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+type DownloadRule struct {
+	Glob     *regexp.Regexp
+	Filename *template.Template
+}
+
+type DownloadData struct {
+	Path string
+	Name string
+	Stem string
+	Ext  string
+}
+
+// Parse DOWNLOAD_PATHS, a comma separated list of `glob` or
+// `glob=filename template` entries
+func getDownloadRules() []DownloadRule {
+	rules := []DownloadRule{}
+	for _, entry := range strings.Split(getEnv("DOWNLOAD_PATHS", ""), ",") {
+		pattern, filename, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if pattern == "" {
+			continue
+		}
+		glob, err := compileGlob(pattern)
+		if err != nil {
+			logln("⇨ error parsing download path", pattern, err)
+			continue
+		}
+		rule := DownloadRule{Glob: glob}
+		if filename != "" {
+			rule.Filename, err = template.New(pattern).Parse(filename)
+			if err != nil {
+				logln("⇨ error parsing download filename", filename, err)
+				continue
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+var downloadRules = getDownloadRules()
+
+func contentDisposition(filename string) string {
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(filename)
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, quoted, url.PathEscape(filename))
+}
+
+// Precompute a Content-Disposition header for routes matching a download rule
+func applyDownloadRules(urlPath string, route *Route) {
+	for _, rule := range downloadRules {
+		if !rule.Glob.MatchString(urlPath) {
+			continue
+		}
+		name := path.Base(urlPath)
+		filename := name
+		if rule.Filename != nil {
+			ext := path.Ext(name)
+			var b bytes.Buffer
+			err := rule.Filename.Execute(&b, &DownloadData{
+				Path: urlPath,
+				Name: name,
+				Stem: strings.TrimSuffix(name, ext),
+				Ext:  ext,
+			})
+			if err != nil {
+				logln("⇨ error rendering download filename for", urlPath, err)
+			} else {
+				filename = b.String()
+			}
+		}
+		route.Headers = append(route.Headers, Header{Key: "Content-Disposition", Value: contentDisposition(filename)})
+		return
+	}
+}
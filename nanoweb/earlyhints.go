@@ -0,0 +1,112 @@
+package nanoweb
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+var earlyHintsEnabled = getEnv("EARLY_HINTS", "0") == "1"
+
+// Set by listeners that don't write to a raw connection, e.g. HTTP/3, to a
+// func(link string) that sends the interim response their own way
+const earlyHintsUserValue = "nanoweb.earlyHints"
+
+var (
+	headEndRegexp  = regexp.MustCompile(`(?i)</head\s*>`)
+	assetTagRegexp = regexp.MustCompile(`(?is)<(link|script)\b([^>]*)>`)
+	attrRegexp     = regexp.MustCompile(`(?s)([a-zA-Z:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+func parseAttrs(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range attrRegexp.FindAllStringSubmatch(tag, -1) {
+		attrs[strings.ToLower(match[1])] = match[2] + match[3] + match[4]
+	}
+	return attrs
+}
+
+// Resolve an asset reference against the page it appears on, ignoring
+// anything that isn't served from this origin
+func resolveAsset(urlPath string, ref string) (string, bool) {
+	if ref == "" || strings.HasPrefix(ref, "data:") {
+		return "", false
+	}
+	parsed, err := url.Parse(ref)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return "", false
+	}
+	return (&url.URL{Path: urlPath}).ResolveReference(parsed).String(), true
+}
+
+// Find render-blocking stylesheets, scripts and preloaded fonts in the head
+// of an HTML document and turn them into a Link header value
+func preloadLinks(urlPath string, dat []byte) string {
+	head := dat
+	if loc := headEndRegexp.FindIndex(dat); loc != nil {
+		head = dat[:loc[0]]
+	}
+
+	links := []string{}
+	seen := make(map[string]bool)
+	for _, match := range assetTagRegexp.FindAllSubmatch(head, -1) {
+		attrs := parseAttrs(string(match[2]))
+		var ref, params string
+		switch strings.ToLower(string(match[1])) {
+		case "link":
+			ref = attrs["href"]
+			switch strings.ToLower(attrs["rel"]) {
+			case "stylesheet":
+				params = "rel=preload; as=style"
+			case "modulepreload":
+				params = "rel=modulepreload"
+			case "preload":
+				if attrs["as"] == "" {
+					continue
+				}
+				params = "rel=preload; as=" + attrs["as"]
+				if attrs["type"] != "" {
+					params += fmt.Sprintf("; type=%q", attrs["type"])
+				}
+				if _, exists := attrs["crossorigin"]; exists || attrs["as"] == "font" {
+					params += "; crossorigin"
+				}
+			default:
+				continue
+			}
+		case "script":
+			ref = attrs["src"]
+			if attrs["type"] == "module" {
+				params = "rel=modulepreload"
+			} else {
+				params = "rel=preload; as=script"
+			}
+		}
+		target, ok := resolveAsset(urlPath, ref)
+		if !ok || seen[target] {
+			continue
+		}
+		seen[target] = true
+		links = append(links, "<"+target+">; "+params)
+	}
+	return strings.Join(links, ", ")
+}
+
+// Write a 103 Early Hints interim response straight to the connection so the
+// browser can start fetching assets before the final response is written.
+// Only the first request on an HTTP/1.1 connection gets them: fasthttp may
+// still be buffering the response to an earlier, pipelined request, which
+// the interim response would be written ahead of.
+func sendEarlyHints(ctx *fasthttp.RequestCtx, link string) {
+	if send, ok := ctx.UserValue(earlyHintsUserValue).(func(string)); ok {
+		send(link)
+		return
+	}
+	if !ctx.Request.Header.IsHTTP11() || ctx.ConnRequestNum() != 1 {
+		return
+	}
+	ctx.Conn().Write([]byte("HTTP/1.1 103 Early Hints\r\nLink: " + link + "\r\n\r\n"))
+}
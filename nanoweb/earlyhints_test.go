@@ -0,0 +1,49 @@
+package nanoweb
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// Pipelined requests only get early hints ahead of the first response, so
+// they're never written before an earlier response still being buffered
+func TestEarlyHintsPipelined(t *testing.T) {
+	previous := earlyHintsEnabled
+	earlyHintsEnabled = true
+	t.Cleanup(func() { earlyHintsEnabled = previous })
+	testSite(t, map[string]string{
+		"index.html": `<html><head><link rel="stylesheet" href="/app.css"></head><body>home</body></html>`,
+		"app.css":    "body {}",
+	})
+
+	listener := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: handler}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Shutdown() })
+	conn, err := listener.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	conn.Write([]byte(request + request + "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	dat, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := string(dat)
+	if count := strings.Count(output, "HTTP/1.1 200 OK"); count != 3 {
+		t.Fatalf("%d responses, want 3:\n%s", count, output)
+	}
+	if !strings.HasPrefix(output, "HTTP/1.1 103 Early Hints\r\nLink: </app.css>; rel=preload; as=style\r\n\r\n") {
+		t.Errorf("no early hints before the first response:\n%s", output)
+	}
+	if count := strings.Count(output, "103 Early Hints"); count != 1 {
+		t.Errorf("%d early hints, want 1:\n%s", count, output)
+	}
+}
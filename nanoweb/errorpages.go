@@ -0,0 +1,71 @@
+package nanoweb
+
+import (
+	"runtime/debug"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Misses are answered with the site's 404.html when it has one, and panics
+// with 50x.html, templated and compressed like any other page. Either can
+// be moved with ERROR_PAGE_404 and ERROR_PAGE_500.
+var (
+	notFoundPage    = getEnv("ERROR_PAGE_404", "/404.html")
+	serverErrorPage = getEnv("ERROR_PAGE_500", "/50x.html")
+)
+
+// Answer with the error page at path, or plain text if there isn't one
+func serveErrorPage(ctx *fasthttp.RequestCtx, routes Routes, path string, status int) {
+	route, exists := routes[path]
+	if !exists || route.File != "" {
+		// ctx.Error resets the headers, but the response still varies on
+		// what the lookup did, e.g. Accept-Language
+		vary := []string{}
+		for _, value := range ctx.Response.Header.PeekAll("Vary") {
+			vary = append(vary, string(value))
+		}
+		ctx.Error(fasthttp.StatusMessage(status), status)
+		for _, value := range vary {
+			ctx.Response.Header.Add("Vary", value)
+		}
+		return
+	}
+	ctx.SetStatusCode(status)
+	ctx.Response.Header.Set("Content-Type", contentTypeHeader(route.ContentType))
+	ctx.Response.Header.Set("Cache-Control", "no-cache")
+	if cspPolicy != "" && route.ContentType == "text/html" {
+		nonce := setCSP(ctx)
+		if route.nonced {
+			serveNonced(ctx, route, nonce)
+			return
+		}
+	}
+	encoding, content := route.encodedContent(routeEncoding(ctx, route))
+	if encoding != "" {
+		ctx.Response.Header.Set("Content-Encoding", encoding)
+	}
+	if route.compressed() {
+		ctx.Response.Header.Add("Vary", "Accept-Encoding")
+	}
+	ctx.SetBody(content)
+}
+
+func notFound(ctx *fasthttp.RequestCtx, routes Routes) {
+	serveErrorPage(ctx, routes, notFoundPage, fasthttp.StatusNotFound)
+}
+
+// Recover from panics in the handler, logging them and answering with the
+// error page instead of taking the server down
+func recoverPanics(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		defer func() {
+			if err := recover(); err != nil {
+				logln("⇨ panic serving", string(ctx.Path()), err, string(debug.Stack()))
+				ctx.Response.Reset()
+				routes := siteForHost(string(ctx.Host())).Table().Routes
+				serveErrorPage(ctx, routes, serverErrorPage, fasthttp.StatusInternalServerError)
+			}
+		}()
+		next(ctx)
+	}
+}
@@ -0,0 +1,103 @@
+package nanoweb
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A route added, refreshed (its content changed) or removed when a site's
+// route table is swapped, followed by a "swapped" event for the table as a
+// whole
+type RouteEvent struct {
+	Type     string   `json:"type"`
+	Hosts    []string `json:"hosts"`
+	Path     string   `json:"path,omitempty"`
+	Hash     string   `json:"hash,omitempty"`
+	DeployID string   `json:"deployId"`
+}
+
+var routeListeners []func([]RouteEvent)
+var routeListenersMu sync.Mutex
+
+// Call listener with the events for each swap, in the background
+func OnRouteEvents(listener func([]RouteEvent)) {
+	routeListenersMu.Lock()
+	defer routeListenersMu.Unlock()
+	routeListeners = append(routeListeners, listener)
+}
+
+func WithRouteEvents(listener func([]RouteEvent)) Option {
+	return func(server *Server) error {
+		OnRouteEvents(listener)
+		return nil
+	}
+}
+
+// What changed between two tables
+func diffRoutes(hosts []string, previous *RouteTable, next *RouteTable) []RouteEvent {
+	events := []RouteEvent{}
+	for path, route := range next.Routes {
+		event := RouteEvent{Hosts: hosts, Path: path, Hash: route.Hash, DeployID: next.DeployID}
+		if old, exists := previous.Routes[path]; !exists {
+			event.Type = "added"
+		} else if old.Hash != route.Hash {
+			event.Type = "refreshed"
+		} else {
+			continue
+		}
+		events = append(events, event)
+	}
+	for path, route := range previous.Routes {
+		if _, exists := next.Routes[path]; !exists {
+			events = append(events, RouteEvent{Type: "removed", Hosts: hosts, Path: path, Hash: route.Hash, DeployID: next.DeployID})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return append(events, RouteEvent{Type: "swapped", Hosts: hosts, DeployID: next.DeployID})
+}
+
+// Make a table live, telling listeners what changed
+func (site *Site) swapTable(table *RouteTable) {
+	previous := site.table.Swap(table)
+	routeListenersMu.Lock()
+	listeners := routeListeners
+	routeListenersMu.Unlock()
+	if len(listeners) == 0 || previous == table {
+		return
+	}
+	events := diffRoutes(site.Hosts, previous, table)
+	go func() {
+		for _, listener := range listeners {
+			listener(events)
+		}
+	}()
+}
+
+// ROUTE_EVENTS_URL gets each swap's events POSTed as a JSON array, e.g. to
+// purge changed paths from a CDN
+func init() {
+	url := getEnv("ROUTE_EVENTS_URL", "")
+	if url == "" {
+		return
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	OnRouteEvents(func(events []RouteEvent) {
+		body, err := json.Marshal(events)
+		if err != nil {
+			return
+		}
+		res, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			logln("⇨ error sending route events", err)
+			return
+		}
+		res.Body.Close()
+		if res.StatusCode >= 300 {
+			logln("⇨ error sending route events", res.Status)
+		}
+	})
+}
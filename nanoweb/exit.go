@@ -0,0 +1,47 @@
+package nanoweb
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// EXIT_AFTER and EXIT_AFTER_REQUESTS shut the server down cleanly after a
+// duration or a number of requests, for CI pipelines
+func getExitAfter() (time.Duration, int64) {
+	duration, err := time.ParseDuration(getEnv("EXIT_AFTER", "0"))
+	if err != nil || duration < 0 {
+		configError("invalid EXIT_AFTER %q", getEnv("EXIT_AFTER", ""))
+		return 0, 0
+	}
+	requests, err := strconv.ParseInt(getEnv("EXIT_AFTER_REQUESTS", "0"), 10, 64)
+	if err != nil || requests < 0 {
+		configError("invalid EXIT_AFTER_REQUESTS %q", getEnv("EXIT_AFTER_REQUESTS", ""))
+		return 0, 0
+	}
+	return duration, requests
+}
+
+func exitAfter(server *fasthttp.Server) {
+	duration, requests := getExitAfter()
+	if duration > 0 {
+		time.AfterFunc(duration, func() {
+			logln("⇨ exiting after", duration)
+			server.Shutdown()
+		})
+	}
+	if requests > 0 {
+		var count atomic.Int64
+		next := server.Handler
+		server.Handler = func(ctx *fasthttp.RequestCtx) {
+			next(ctx)
+			if count.Add(1) == requests {
+				logln("⇨ exiting after", requests, "requests")
+				// Let this response be written first
+				go server.Shutdown()
+			}
+		}
+	}
+}
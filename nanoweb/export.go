@@ -0,0 +1,64 @@
+package nanoweb
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Write every file as it would be served, with runtime config applied and
+// generated routes included, for hosting somewhere nano-web can't run
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	compressed := flags.Bool("compressed", false, "also write .gz and .br copies")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: nano-web export [--compressed] dir out")
+		return 2
+	}
+	site, err := getCommandSite(flags.Args()[:1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	out := flags.Arg(1)
+	table := site.Build(site.PublicDir)
+	for _, entry := range getManifest(table).Routes {
+		route := table.Routes[entry.Path]
+		target := filepath.Join(out, filepath.FromSlash(strings.TrimPrefix(entry.Path, "/")))
+		files := map[string][]byte{}
+		if route.File == "" {
+			files[target] = route.Content.Plain
+		} else if err := exportFileRoute(route, target); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if *compressed {
+			if encoding, dat := route.encodedContent("gzip"); encoding != "" {
+				files[target+".gz"] = dat
+			}
+			if encoding, dat := route.encodedContent("br"); encoding != "" {
+				files[target+".br"] = dat
+			}
+			if encoding, dat := route.encodedContent("zstd"); encoding != "" {
+				files[target+".zst"] = dat
+			}
+		}
+		for file, dat := range files {
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			if err := os.WriteFile(file, dat, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+	}
+	fmt.Printf("exported %d files to %s\n", len(getManifest(table).Routes), out)
+	return 0
+}
@@ -0,0 +1,82 @@
+package nanoweb
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+var includeGlobs = getPathGlobs("INCLUDE_PATHS")
+var excludeGlobs = getPathGlobs("EXCLUDE_PATHS")
+
+// Parse a comma separated list of path globs, which are relative to the site
+// root whether or not they start with /
+func getPathGlobs(name string) []*regexp.Regexp {
+	globs := []*regexp.Regexp{}
+	for _, pattern := range strings.Split(getEnv(name, ""), ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		glob, err := compileGlob("/" + strings.TrimPrefix(pattern, "/"))
+		if err != nil {
+			logln("⇨ error parsing", name, pattern, err)
+			continue
+		}
+		globs = append(globs, glob)
+	}
+	return globs
+}
+
+func matchesAny(globs []*regexp.Regexp, urlPath string) bool {
+	for _, glob := range globs {
+		if glob.MatchString(urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a file is left out of the routes by INCLUDE_PATHS or EXCLUDE_PATHS
+func excludedFile(urlPath string) bool {
+	if matchesAny(excludeGlobs, urlPath) {
+		return true
+	}
+	return len(includeGlobs) > 0 && !matchesAny(includeGlobs, urlPath)
+}
+
+// Whether a whole directory is excluded, so it isn't walked
+func excludedDir(urlPath string) bool {
+	return matchesAny(excludeGlobs, strings.TrimSuffix(urlPath, "/")+"/")
+}
+
+// Dotfiles and directories (except .well-known) and files that look like
+// keys or databases are never served, unless SERVE_HIDDEN=1 or they match
+// ALLOW_HIDDEN_PATHS globs, so a stray .env or .git can't leak
+var serveHidden = getEnv("SERVE_HIDDEN", "0") == "1"
+var allowHiddenGlobs = getPathGlobs("ALLOW_HIDDEN_PATHS")
+
+var sensitiveNames = []string{"*.pem", "*.key", "*.p12", "*.pfx", "id_rsa*", "id_dsa*", "id_ecdsa*", "id_ed25519*", "*.kdbx", "*.sqlite", "*.sqlite3"}
+
+// Whether a file or directory is hidden by the policy
+func hiddenPath(urlPath string, dir bool) bool {
+	if serveHidden {
+		return false
+	}
+	name := path.Base(urlPath)
+	hidden := strings.HasPrefix(name, ".") && name != ".well-known"
+	if !dir {
+		for _, pattern := range sensitiveNames {
+			if matched, _ := path.Match(pattern, name); matched {
+				hidden = true
+			}
+		}
+	}
+	if !hidden {
+		return false
+	}
+	if dir {
+		urlPath = strings.TrimSuffix(urlPath, "/") + "/"
+	}
+	return !matchesAny(allowHiddenGlobs, urlPath)
+}
@@ -0,0 +1,230 @@
+package nanoweb
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/valyala/fasthttp"
+)
+
+// Tags requests with a country and ASN from MaxMind databases (GEOIP_DB,
+// GEOIP_ASN_DB) for logs and metrics, and blocks or redirects countries.
+// Built-in /__ endpoints are never blocked. The databases are memory mapped,
+// and reopened when they're replaced, e.g. by geoipupdate.
+type GeoIP struct {
+	Country   *maxminddb.Reader
+	ASN       *maxminddb.Reader
+	IPHeader  string
+	Allow     map[string]bool
+	Block     map[string]bool
+	Redirects map[string]string
+
+	// How many trusted proxies appended to IPHeader. The client's address
+	// is this many entries from the right, as anything left of it can be
+	// written by the client.
+	IPHops int
+
+	// Guards the readers, which are unmapped when they're replaced
+	mu    sync.RWMutex
+	files map[string]time.Time
+}
+
+type Geo struct {
+	Country string
+	ASN     uint
+	Org     string
+}
+
+type geoRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN uint   `maxminddb:"autonomous_system_number"`
+	Org string `maxminddb:"autonomous_system_organization"`
+}
+
+const geoUserValue = "nanoweb.geo"
+
+func getGeoIP() *GeoIP {
+	countryDB, asnDB := getEnv("GEOIP_DB", ""), getEnv("GEOIP_ASN_DB", "")
+	if countryDB == "" && asnDB == "" {
+		return nil
+	}
+	geoip := &GeoIP{
+		IPHeader:  getEnv("GEOIP_IP_HEADER", ""),
+		Allow:     getCountries("GEO_ALLOW"),
+		Block:     getCountries("GEO_BLOCK"),
+		Redirects: make(map[string]string),
+		files:     make(map[string]time.Time),
+	}
+	for name, reader := range map[string]**maxminddb.Reader{countryDB: &geoip.Country, asnDB: &geoip.ASN} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			configError("error opening GeoIP database: %s", err)
+			return nil
+		}
+		db, err := maxminddb.Open(name)
+		if err != nil {
+			configError("error opening GeoIP database: %s", err)
+			return nil
+		}
+		*reader = db
+		geoip.files[name] = info.ModTime()
+	}
+	for _, entry := range strings.Split(getEnv("GEO_REDIRECT", ""), ",") {
+		country, target, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if found && country != "" && target != "" {
+			geoip.Redirects[strings.ToUpper(country)] = target
+		}
+	}
+	hops, err := strconv.Atoi(getEnv("GEOIP_IP_HOPS", "1"))
+	if err != nil || hops < 1 {
+		configError("invalid GEOIP_IP_HOPS %q", getEnv("GEOIP_IP_HOPS", ""))
+		return nil
+	}
+	geoip.IPHops = hops
+	if (len(geoip.Allow) > 0 || len(geoip.Block) > 0 || len(geoip.Redirects) > 0) && geoip.Country == nil {
+		configError("GEO_ALLOW, GEO_BLOCK and GEO_REDIRECT need a country database in GEOIP_DB")
+		return nil
+	}
+	interval, err := time.ParseDuration(getEnv("GEOIP_RELOAD_INTERVAL", "1m"))
+	if err != nil || interval < 0 {
+		configError("invalid GEOIP_RELOAD_INTERVAL %q", getEnv("GEOIP_RELOAD_INTERVAL", ""))
+		return nil
+	}
+	if interval > 0 {
+		go geoip.watch(countryDB, asnDB, interval)
+	}
+	return geoip
+}
+
+func getCountries(name string) map[string]bool {
+	countries := make(map[string]bool)
+	for _, country := range strings.Split(getEnv(name, ""), ",") {
+		if country = strings.ToUpper(strings.TrimSpace(country)); country != "" {
+			countries[country] = true
+		}
+	}
+	return countries
+}
+
+// Reopen the databases when their files change
+func (geoip *GeoIP) watch(countryDB string, asnDB string, interval time.Duration) {
+	for range time.Tick(interval) {
+		for name, reader := range map[string]**maxminddb.Reader{countryDB: &geoip.Country, asnDB: &geoip.ASN} {
+			if name == "" {
+				continue
+			}
+			info, err := os.Stat(name)
+			if err != nil || info.ModTime().Equal(geoip.files[name]) {
+				continue
+			}
+			db, err := maxminddb.Open(name)
+			if err != nil {
+				logln("⇨ error reloading GeoIP database", err)
+				continue
+			}
+			geoip.mu.Lock()
+			previous := *reader
+			*reader = db
+			geoip.mu.Unlock()
+			previous.Close()
+			geoip.files[name] = info.ModTime()
+			logln("⇨ reloaded GeoIP database", name)
+		}
+	}
+}
+
+// The client's address from IPHeader, counting IPHops entries from the right
+// across every copy of the header, or the connection's
+func (geoip *GeoIP) clientIP(ctx *fasthttp.RequestCtx) net.IP {
+	if geoip.IPHeader != "" {
+		entries := []string{}
+		for _, value := range ctx.Request.Header.PeekAll(geoip.IPHeader) {
+			entries = append(entries, strings.Split(string(value), ",")...)
+		}
+		if hop := len(entries) - geoip.IPHops; hop >= 0 {
+			if ip := net.ParseIP(strings.TrimSpace(entries[hop])); ip != nil {
+				return ip
+			}
+		}
+	}
+	return ctx.RemoteIP()
+}
+
+func (geoip *GeoIP) Lookup(ip net.IP) Geo {
+	geoip.mu.RLock()
+	defer geoip.mu.RUnlock()
+	var geo Geo
+	var record geoRecord
+	if geoip.Country != nil && geoip.Country.Lookup(ip, &record) == nil {
+		geo.Country = record.Country.ISOCode
+	}
+	record = geoRecord{}
+	if geoip.ASN != nil && geoip.ASN.Lookup(ip, &record) == nil {
+		geo.ASN, geo.Org = record.ASN, record.Org
+	}
+	return geo
+}
+
+// The geo tags of a request, if GeoIP is enabled
+func requestGeo(ctx *fasthttp.RequestCtx) (Geo, bool) {
+	geo, ok := ctx.UserValue(geoUserValue).(Geo)
+	return geo, ok
+}
+
+func (geo Geo) String() string {
+	tags := []string{}
+	if geo.Country != "" {
+		tags = append(tags, "country="+geo.Country)
+	}
+	if geo.ASN != 0 {
+		tags = append(tags, "asn="+strconv.FormatUint(uint64(geo.ASN), 10))
+	}
+	return strings.Join(tags, " ")
+}
+
+// Whether a country is refused. With GEO_ALLOW, addresses without a known
+// country are refused too, unless they're private or loopback.
+func (geoip *GeoIP) blocked(ip net.IP, country string) bool {
+	if len(geoip.Allow) > 0 && !geoip.Allow[country] {
+		return country != "" || !(ip.IsLoopback() || ip.IsPrivate())
+	}
+	return geoip.Block[country]
+}
+
+func (geoip *GeoIP) wrap(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		ip := geoip.clientIP(ctx)
+		geo := geoip.Lookup(ip)
+		ctx.SetUserValue(geoUserValue, geo)
+		path := string(ctx.Path())
+		if strings.HasPrefix(path, "/__") {
+			next(ctx)
+			return
+		}
+		if geoip.blocked(ip, geo.Country) {
+			logln("⇨ blocked request from", geo.Country, path)
+			ctx.Error("Unavailable For Legal Reasons", fasthttp.StatusUnavailableForLegalReasons)
+			auditDenied(ctx, "geo")
+			return
+		}
+		if target, ok := geoip.Redirects[geo.Country]; ok && !strings.HasPrefix(path, target) {
+			location := strings.TrimSuffix(target, "/") + path
+			if query := ctx.URI().QueryString(); len(query) > 0 {
+				location += "?" + string(query)
+			}
+			ctx.Redirect(location, fasthttp.StatusFound)
+			return
+		}
+		next(ctx)
+	}
+}
@@ -0,0 +1,41 @@
+package nanoweb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Only the entries appended by trusted proxies are believed, so a client
+// can't choose its country by sending X-Forwarded-For itself
+func TestGeoIPClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		hops    int
+		headers []string
+		want    string
+	}{
+		{"no header", 1, nil, "10.0.0.1"},
+		{"proxy only", 1, []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed leftmost", 1, []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"spoofed several", 1, []string{"198.51.100.1,198.51.100.2 , 203.0.113.7"}, "203.0.113.7"},
+		{"spoofed in another header", 1, []string{"198.51.100.1", "203.0.113.7"}, "203.0.113.7"},
+		{"two proxies", 2, []string{"198.51.100.1, 203.0.113.7, 192.0.2.9"}, "203.0.113.7"},
+		{"fewer entries than proxies", 2, []string{"203.0.113.7"}, "10.0.0.1"},
+		{"not an address", 1, []string{"198.51.100.1, unknown"}, "10.0.0.1"},
+		{"IPv6", 1, []string{"198.51.100.1, 2001:db8::1"}, "2001:db8::1"},
+	}
+	for _, test := range tests {
+		geoip := &GeoIP{IPHeader: "X-Forwarded-For", IPHops: test.hops}
+		var req fasthttp.Request
+		for _, value := range test.headers {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}, nil)
+		if ip := geoip.clientIP(ctx); !ip.Equal(net.ParseIP(test.want)) {
+			t.Errorf("%s: client IP %s, want %s", test.name, ip, test.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package nanoweb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const gitWebhookPath = "/__git"
+
+// A git repository cloned under a local directory, with the branch checked
+// out next to the clone for the site to be served from
+type GitSource struct {
+	URL           string
+	Branch        string
+	Subdir        string
+	Dir           string
+	WebhookSecret string
+
+	trigger chan struct{}
+}
+
+var gitSource = getGitSource()
+
+func getGitSource() *GitSource {
+	repo := getEnv("GIT_REPO", "")
+	if repo == "" {
+		return nil
+	}
+	return &GitSource{
+		URL:           repo,
+		Branch:        getEnv("GIT_BRANCH", "main"),
+		Subdir:        getEnv("GIT_SUBDIR", ""),
+		Dir:           getEnv("GIT_CHECKOUT_DIR", filepath.Join(os.TempDir(), "nano-web-git")),
+		WebhookSecret: getEnv("GIT_WEBHOOK_SECRET", ""),
+		trigger:       make(chan struct{}, 1),
+	}
+}
+
+// Each commit is checked out into its own worktree, served through the
+// current symlink
+func (source *GitSource) PublicDir() string {
+	return filepath.Join(source.Dir, "current", filepath.FromSlash(source.Subdir))
+}
+
+func (source *GitSource) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", filepath.Join(source.Dir, "repo")}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Remove a worktree that's no longer served, or was left half made
+func (source *GitSource) removeWorktree(dir string) {
+	// git runs in the clone, so relative paths would be taken from there
+	dir, _ = filepath.Abs(dir)
+	if _, err := source.git("worktree", "remove", "--force", dir); err != nil {
+		os.RemoveAll(dir)
+		source.git("worktree", "prune")
+	}
+}
+
+// Fetch the branch and, if it moved, check the new commit out into a worktree
+// of its own before flipping the current symlink over to it, so the tree being
+// served is never changed in place. Returns the checked out commit and whether
+// it changed.
+func (source *GitSource) Sync() (string, bool, error) {
+	repo := filepath.Join(source.Dir, "repo")
+	if _, err := os.Stat(filepath.Join(repo, ".git")); err != nil {
+		if err := os.MkdirAll(repo, 0755); err != nil {
+			return "", false, err
+		}
+		if _, err := source.git("clone", "--depth", "1", "--single-branch", "--no-checkout", "--branch", source.Branch, source.URL, "."); err != nil {
+			return "", false, err
+		}
+	}
+
+	current := filepath.Join(source.Dir, "current")
+	previous, _ := os.Readlink(current)
+	head := strings.TrimPrefix(previous, "checkout-")
+	if _, err := source.git("fetch", "--depth", "1", "origin", source.Branch); err != nil {
+		return head, false, err
+	}
+	fetched, err := source.git("rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return head, false, err
+	}
+	if fetched == head {
+		if _, err := os.Stat(current); err == nil {
+			return head, false, nil
+		}
+	}
+
+	checkout, err := filepath.Abs(filepath.Join(source.Dir, "checkout-"+fetched))
+	if err != nil {
+		return head, false, err
+	}
+	if _, err := os.Stat(checkout); err == nil {
+		source.removeWorktree(checkout)
+	}
+	if _, err := source.git("worktree", "add", "--detach", checkout, fetched); err != nil {
+		source.removeWorktree(checkout)
+		return head, false, err
+	}
+	if err := replaceSymlink(current, filepath.Base(checkout)); err != nil {
+		source.removeWorktree(checkout)
+		return head, false, err
+	}
+	if strings.HasPrefix(previous, "checkout-") && previous != filepath.Base(checkout) {
+		source.removeWorktree(filepath.Join(source.Dir, previous))
+	}
+	return fetched, true, nil
+}
+
+func getGitPollInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("GIT_POLL_INTERVAL", "60s"))
+	if err != nil || interval <= 0 {
+		return 60 * time.Second
+	}
+	return interval
+}
+
+// Fetch on an interval or when the webhook fires, reloading the site when
+// the branch moves
+func (source *GitSource) Watch(site *Site) {
+	ticker := time.NewTicker(getGitPollInterval())
+	for {
+		select {
+		case <-ticker.C:
+		case <-source.trigger:
+		}
+		commit, changed, err := source.Sync()
+		if err != nil {
+			logln("⇨ error syncing git repository", err)
+			continue
+		}
+		if changed {
+			logln("⇨ git", source.Branch, "moved to", commit, "reloading")
+			reloadMu.Lock()
+			err := site.reloadDeploy(commit)
+			reloadMu.Unlock()
+			if err != nil {
+				logln("⇨ error reloading git commit", commit, err)
+			}
+		}
+	}
+}
+
+// Accept a push webhook authenticated by a GitHub style HMAC signature or a
+// bearer token, and trigger a fetch
+func (source *GitSource) webhookHandler(ctx *fasthttp.RequestCtx) {
+	if !ctx.IsPost() {
+		ctx.Error("Method Not Allowed", fasthttp.StatusMethodNotAllowed)
+		ctx.Response.Header.Set("Allow", "POST")
+		return
+	}
+	if !source.authorized(ctx) {
+		ctx.Error("Unauthorized", fasthttp.StatusUnauthorized)
+		auditDenied(ctx, "git_webhook")
+		return
+	}
+	select {
+	case source.trigger <- struct{}{}:
+	default:
+	}
+	ctx.SetStatusCode(fasthttp.StatusAccepted)
+}
+
+func (source *GitSource) authorized(ctx *fasthttp.RequestCtx) bool {
+	if source.WebhookSecret == "" {
+		return false
+	}
+	if signature, found := strings.CutPrefix(string(ctx.Request.Header.Peek("X-Hub-Signature-256")), "sha256="); found {
+		mac := hmac.New(sha256.New, []byte(source.WebhookSecret))
+		mac.Write(ctx.PostBody())
+		expected := hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(signature), []byte(expected))
+	}
+	return bearerAuthorized(ctx, source.WebhookSecret)
+}
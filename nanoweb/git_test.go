@@ -0,0 +1,75 @@
+package nanoweb
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Commit files to a local repository to sync from
+func commitFiles(t *testing.T, repo string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(repo, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{"add", "-A"}, {"commit", "-q", "-m", "update"}} {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s", args[0], out)
+		}
+	}
+}
+
+// Each commit is checked out beside the one being served, never over it
+func TestGitSync(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	origin := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", "-b", "main", origin).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %s", out)
+	}
+	commitFiles(t, origin, map[string]string{"dist/index.html": "v1", "dist/old.html": "old"})
+
+	dir := t.TempDir()
+	source := &GitSource{URL: "file://" + origin, Branch: "main", Subdir: "dist", Dir: dir}
+	first, changed, err := source.Sync()
+	if err != nil || !changed {
+		t.Fatalf("first sync: changed %v, error %v", changed, err)
+	}
+	if dat, _ := os.ReadFile(filepath.Join(source.PublicDir(), "index.html")); string(dat) != "v1" {
+		t.Errorf("index.html: %q, want v1", dat)
+	}
+	if _, changed, err := source.Sync(); err != nil || changed {
+		t.Errorf("unchanged sync: changed %v, error %v", changed, err)
+	}
+
+	// What's served stays as it was while the next commit is checked out
+	served, _ := filepath.EvalSymlinks(filepath.Join(dir, "current"))
+	os.Remove(filepath.Join(origin, "dist", "old.html"))
+	commitFiles(t, origin, map[string]string{"dist/index.html": "v2"})
+	second, changed, err := source.Sync()
+	if err != nil || !changed || second == first {
+		t.Fatalf("second sync: commit %s, changed %v, error %v", second, changed, err)
+	}
+	if dat, _ := os.ReadFile(filepath.Join(source.PublicDir(), "index.html")); string(dat) != "v2" {
+		t.Errorf("index.html: %q, want v2", dat)
+	}
+	if _, err := os.Stat(filepath.Join(source.PublicDir(), "old.html")); !os.IsNotExist(err) {
+		t.Errorf("removed file still checked out: %v", err)
+	}
+	if _, err := os.Stat(served); !os.IsNotExist(err) {
+		t.Errorf("previous checkout left behind: %v", err)
+	}
+
+	// A restart picks up where it left off
+	restarted := &GitSource{URL: "file://" + origin, Branch: "main", Subdir: "dist", Dir: dir}
+	if commit, changed, err := restarted.Sync(); err != nil || changed || commit != second {
+		t.Errorf("sync after restart: commit %s, changed %v, error %v", commit, changed, err)
+	}
+}
@@ -0,0 +1,37 @@
+package nanoweb
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Compile a path glob into a regexp. `**` matches across path segments, `*`
+// matches within a segment, except as the final character where it matches
+// everything below (like Netlify's splat).
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+2 < len(pattern) && pattern[i+1] == '*' && pattern[i+2] == '/' {
+				// Any number of directories, including none
+				b.WriteString("(.*/)?")
+				i += 2
+			} else if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else if i == len(pattern)-1 {
+				b.WriteString(".*")
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,148 @@
+package nanoweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const assetManifestFile = "asset-manifest.json"
+
+// Files that get renamed with a content hash, in the order they're hashed so
+// stylesheets are rewritten before their own hash is taken
+var hashedExts = [][]string{
+	{".js", ".mjs", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".avif", ".woff", ".woff2", ".ttf", ".otf", ".wasm"},
+	{".css"},
+}
+
+var hashedName = regexp.MustCompile(`\.[0-9a-f]{8}\.[a-z0-9]+$`)
+
+var assetReference = regexp.MustCompile(`[^\s"'(),=<>]+\.(?:mjs|js|css|png|jpe?g|gif|svg|webp|avif|woff2?|ttf|otf|wasm)\b`)
+
+// Rename assets with a hash of their content and rewrite references to them
+// in HTML and CSS, writing the renames to asset-manifest.json
+func hashCommand(args []string) int {
+	dir := getPublicDir()
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	renames := make(map[string]string)
+	if dat, err := os.ReadFile(filepath.Join(dir, assetManifestFile)); err == nil {
+		json.Unmarshal(dat, &renames)
+	}
+	for _, exts := range hashedExts {
+		files, err := findFiles(dir, exts...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, name := range files {
+			if hashedName.MatchString(name) {
+				continue
+			}
+			if err := rewriteReferences(dir, name, renames); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			dat, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			hash := sha256.Sum256(dat)
+			ext := path.Ext(name)
+			hashed := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(hash[:])[:8] + ext
+			if err := os.Rename(filepath.Join(dir, name), filepath.Join(dir, hashed)); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			renames[name] = hashed
+			fmt.Println(name, "→", hashed)
+		}
+	}
+	pages, err := findFiles(dir, ".html", ".htm")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, name := range pages {
+		if err := rewriteReferences(dir, name, renames); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	dat, _ := json.MarshalIndent(renames, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, assetManifestFile), append(dat, '\n'), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Slash separated paths below dir with any of the extensions
+func findFiles(dir string, exts ...string) ([]string, error) {
+	files := []string{}
+	err := fs.WalkDir(os.DirFS(dir), ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, ext := range exts {
+			if !entry.IsDir() && strings.EqualFold(path.Ext(name), ext) {
+				files = append(files, name)
+			}
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// Point references to renamed assets in a page or stylesheet at their new
+// names
+func rewriteReferences(dir string, name string, renames map[string]string) error {
+	ext := strings.ToLower(path.Ext(name))
+	if ext != ".css" && ext != ".html" && ext != ".htm" {
+		return nil
+	}
+	file := filepath.Join(dir, name)
+	dat, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	rewritten := rewriteAssetReferences(name, string(dat), renames)
+	if rewritten == string(dat) {
+		return nil
+	}
+	return os.WriteFile(file, []byte(rewritten), 0644)
+}
+
+// Rewrite the references to renamed assets in a file's content, keeping
+// them relative if they were
+func rewriteAssetReferences(name string, content string, renames map[string]string) string {
+	return assetReference.ReplaceAllStringFunc(content, func(ref string) string {
+		if strings.Contains(ref, "://") || strings.HasPrefix(ref, "//") || strings.HasPrefix(ref, "data:") {
+			return ref
+		}
+		target := path.Join(path.Dir(name), ref)
+		if strings.HasPrefix(ref, "/") {
+			target = strings.TrimPrefix(path.Clean(ref), "/")
+		}
+		hashed, renamed := renames[target]
+		if !renamed {
+			return ref
+		}
+		// Manifests from bundlers can move files to another directory
+		if path.Dir(hashed) != path.Dir(target) {
+			return "/" + hashed
+		}
+		return path.Join(path.Dir(ref), path.Base(hashed))
+	})
+}
@@ -0,0 +1,116 @@
+package nanoweb
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+var crossOriginIsolated = getEnv("CROSS_ORIGIN_ISOLATED", "0") == "1"
+
+type Header struct {
+	Key   string
+	Value string
+}
+
+type HeaderRule struct {
+	Pattern string
+	Glob    *regexp.Regexp
+	Headers []Header
+}
+
+// Parse a Netlify style _headers file: a path glob on its own line followed
+// by indented `Key: Value` lines
+func parseHeadersFile(path string) ([]HeaderRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := []HeaderRule{}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed == text {
+			glob, err := compileGlob(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+			}
+			rules = append(rules, HeaderRule{Pattern: trimmed, Glob: glob})
+			continue
+		}
+		key, value, found := strings.Cut(trimmed, ":")
+		if !found || len(rules) == 0 {
+			return nil, fmt.Errorf("%s:%d: expected `Key: Value` below a path", path, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if strings.EqualFold(key, "Referrer-Policy") && !validReferrerPolicy(value) {
+			return nil, fmt.Errorf("%s:%d: unknown Referrer-Policy %s", path, line, value)
+		}
+		rule := &rules[len(rules)-1]
+		rule.Headers = append(rule.Headers, Header{Key: key, Value: value})
+	}
+	return rules, scanner.Err()
+}
+
+func loadHeaderRules(headersFile string) ([]HeaderRule, error) {
+	if _, err := os.Stat(headersFile); err != nil {
+		return nil, nil
+	}
+	rules, err := parseHeadersFile(headersFile)
+	if err != nil {
+		return nil, err
+	}
+	logln("⇨ loaded", len(rules), "header rules from", headersFile)
+	return rules, nil
+}
+
+// Precompute the headers from every matching rule onto the route, then the
+// default policies. Link headers are merged into a single value so they can
+// be sent as early hints.
+func applyHeaderRules(rules []HeaderRule, urlPath string, route *Route) {
+	for _, rule := range rules {
+		if !rule.Glob.MatchString(urlPath) {
+			continue
+		}
+		for _, header := range rule.Headers {
+			if strings.EqualFold(header.Key, "Link") {
+				if route.Link != "" {
+					route.Link += ", "
+				}
+				route.Link += header.Value
+				continue
+			}
+			route.Headers = append(route.Headers, header)
+		}
+	}
+	applyPolicyHeaders(route)
+}
+
+// Headers required for SharedArrayBuffer and WASM threads
+func setCrossOriginIsolationHeaders(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("Cross-Origin-Opener-Policy", "same-origin")
+	ctx.Response.Header.Set("Cross-Origin-Embedder-Policy", "require-corp")
+	ctx.Response.Header.Set("Cross-Origin-Resource-Policy", "same-origin")
+}
+
+// Look up one of the route's precomputed headers
+func (route *Route) getHeader(key string) string {
+	for _, header := range route.Headers {
+		if strings.EqualFold(header.Key, key) {
+			return header.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,38 @@
+package nanoweb
+
+import (
+	"github.com/valyala/fasthttp"
+)
+
+const healthPath = "/__health"
+
+var healthEnabled = getEnv("HEALTH", "0") == "1"
+
+type Health struct {
+	Healthy  bool     `json:"healthy"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+func getHealth() Health {
+	health := Health{Healthy: true}
+	for _, site := range sites {
+		health.Problems = append(health.Problems, site.Table().Problems...)
+	}
+	if result := selfCheckResult.Load(); result != nil && !result.OK {
+		health.Problems = append(health.Problems, "self-check failed: "+result.Error)
+	}
+	if len(health.Problems) > 0 {
+		health.Healthy = false
+	}
+	return health
+}
+
+// 200 when everything's being served as expected, 503 otherwise
+func healthHandler(ctx *fasthttp.RequestCtx) {
+	health := getHealth()
+	status := fasthttp.StatusOK
+	if !health.Healthy {
+		status = fasthttp.StatusServiceUnavailable
+	}
+	writeJSON(ctx, status, health)
+}
@@ -0,0 +1,107 @@
+package nanoweb
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/valyala/fasthttp"
+)
+
+// HTTP3=1 also serves HTTP/3 over QUIC on the same port, advertised to TCP
+// clients with Alt-Svc. Needs TLS_CERT and TLS_KEY. Requests go through the
+// same handler, and are answered from the same routes.
+func (server *Server) startHTTP3() error {
+	_, port, err := net.SplitHostPort(server.Addr)
+	if err != nil {
+		return err
+	}
+	network := listenNetwork("udp", server.Addr)
+	addr, err := net.ResolveUDPAddr(network, server.Addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP(network, addr)
+	if err != nil {
+		return err
+	}
+	handler := server.http.Handler
+	server.h3 = &http3.Server{
+		Addr:           server.Addr,
+		TLSConfig:      http3.ConfigureTLSConfig(server.http.TLSConfig),
+		Handler:        http3Handler(handler, server.http.MaxRequestBodySize),
+		MaxHeaderBytes: server.http.ReadBufferSize,
+	}
+	altSvc := `h3=":` + port + `"; ma=86400`
+	server.http.Handler = func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Set("Alt-Svc", altSvc)
+		handler(ctx)
+	}
+	go func() {
+		server.done <- server.h3.Serve(conn)
+		conn.Close()
+	}()
+	return nil
+}
+
+// Headers that don't exist in HTTP/3
+var hopHeaders = map[string]bool{"Connection": true, "Keep-Alive": true, "Transfer-Encoding": true, "Upgrade": true}
+
+// Serve net/http requests from QUIC with a fasthttp handler
+func http3Handler(handler fasthttp.RequestHandler, maxBodySize int) http.Handler {
+	if maxBodySize <= 0 {
+		maxBodySize = fasthttp.DefaultMaxRequestBodySize
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req fasthttp.Request
+		req.Header.SetMethod(r.Method)
+		req.SetRequestURI(r.URL.RequestURI())
+		req.Header.SetHost(r.Host)
+		for key, values := range r.Header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+		limit := maxBodySize
+		if size := deployer.bodySize(r.Method, r.URL.Path); size > 0 {
+			limit = size
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if len(body) > limit {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		req.SetBody(body)
+		var remote net.Addr
+		if addr, err := net.ResolveUDPAddr("udp", r.RemoteAddr); err == nil {
+			remote = addr
+		}
+		var ctx fasthttp.RequestCtx
+		ctx.Init(&req, remote, nil)
+		ctx.SetUserValue(earlyHintsUserValue, func(link string) {
+			w.Header().Set("Link", link)
+			w.WriteHeader(http.StatusEarlyHints)
+			w.Header().Del("Link")
+		})
+		handler(&ctx)
+		ctx.Response.Header.VisitAll(func(key []byte, value []byte) {
+			if name := string(key); !hopHeaders[name] && !strings.EqualFold(name, "Content-Length") {
+				w.Header().Add(name, string(value))
+			}
+		})
+		if length := ctx.Response.Header.ContentLength(); r.Method == http.MethodHead && length >= 0 {
+			w.Header().Set("Content-Length", strconv.Itoa(length))
+		}
+		w.WriteHeader(ctx.Response.StatusCode())
+		if r.Method != http.MethodHead {
+			ctx.Response.BodyWriteTo(w)
+		}
+	})
+}
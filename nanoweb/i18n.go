@@ -0,0 +1,119 @@
+package nanoweb
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+var locales = getLocales()
+var defaultLocale = getEnv("DEFAULT_LOCALE", firstLocale())
+
+// LOCALE_REDIRECT=1 redirects every path without a locale to its localized
+// one, root only / to the localized root, and 0 serves them in place
+var localeRedirect = getLocaleRedirect()
+
+func getLocales() []string {
+	locales := []string{}
+	for _, locale := range strings.Split(getEnv("LOCALES", ""), ",") {
+		if locale = strings.Trim(strings.TrimSpace(locale), "/"); locale != "" {
+			locales = append(locales, locale)
+		}
+	}
+	return locales
+}
+
+func getLocaleRedirect() string {
+	switch value := getEnv("LOCALE_REDIRECT", "0"); value {
+	case "0", "1", "root":
+		return value
+	default:
+		configError("invalid LOCALE_REDIRECT %q", value)
+		return "0"
+	}
+}
+
+// Whether a request for path should be redirected to its localized path
+// rather than served
+func redirectsLocale(path string) bool {
+	return localeRedirect == "1" || localeRedirect == "root" && path == "/"
+}
+
+func firstLocale() string {
+	if len(locales) == 0 {
+		return ""
+	}
+	return locales[0]
+}
+
+func findLocale(tag string) (string, bool) {
+	for _, locale := range locales {
+		if strings.EqualFold(locale, tag) {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+type languageRange struct {
+	Tag     string
+	Quality float64
+}
+
+// Pick the best configured locale for an Accept-Language header, falling
+// back to the primary subtag (de-AT → de) and then the default locale
+func negotiateLocale(acceptLanguage string) string {
+	ranges := []languageRange{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if tag != "" && quality > 0 {
+			ranges = append(ranges, languageRange{Tag: tag, Quality: quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].Quality > ranges[j].Quality
+	})
+
+	for _, lr := range ranges {
+		if locale, ok := findLocale(lr.Tag); ok {
+			return locale
+		}
+		primary, _, _ := strings.Cut(lr.Tag, "-")
+		if locale, ok := findLocale(primary); ok {
+			return locale
+		}
+		for _, locale := range locales {
+			if localePrimary, _, _ := strings.Cut(locale, "-"); strings.EqualFold(localePrimary, primary) {
+				return locale
+			}
+		}
+	}
+	return defaultLocale
+}
+
+// Map a path without a locale prefix to the negotiated localized route, if
+// one exists. The response varies on Accept-Language either way.
+func localizedPath(ctx *fasthttp.RequestCtx, routes Routes, path string) (string, bool) {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if _, ok := findLocale(segment); ok {
+		return "", false
+	}
+	ctx.Response.Header.Add("Vary", "Accept-Language")
+	locale := negotiateLocale(string(ctx.Request.Header.Peek("Accept-Language")))
+	if locale == "" {
+		return "", false
+	}
+	candidate := "/" + locale + path
+	if _, exists := routes[candidate]; !exists {
+		return "", false
+	}
+	return candidate, true
+}
@@ -0,0 +1,60 @@
+package nanoweb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLocales(t *testing.T) {
+	previous, previousDefault, previousRedirect := locales, defaultLocale, localeRedirect
+	locales, defaultLocale = []string{"en", "de", "pt-BR"}, "en"
+	t.Cleanup(func() { locales, defaultLocale, localeRedirect = previous, previousDefault, previousRedirect })
+	testSite(t, map[string]string{
+		"en/index.html":    "hello",
+		"de/index.html":    "hallo",
+		"pt-BR/index.html": "olá",
+		"en/about.html":    "about",
+		"logo.svg":         "<svg/>",
+	})
+
+	tests := []struct {
+		redirect string
+		uri      string
+		language string
+		status   int
+		body     string
+		location string
+	}{
+		{"0", "/", "de-AT,de;q=0.9", 200, "hallo", ""},
+		{"0", "/", "fr, pt;q=0.8, de;q=0.5", 200, "olá", ""},
+		{"0", "/", "fr", 200, "hello", ""},
+		{"0", "/", "de;q=0, en", 200, "hello", ""},
+		// Paths with a locale, or without a localized copy, are served as is,
+		// and another locale's copy is never a fallback
+		{"0", "/de/", "en", 200, "hallo", ""},
+		{"0", "/logo.svg", "de", 200, "<svg/>", ""},
+		{"0", "/about.html", "en", 200, "about", ""},
+		{"0", "/about.html", "de", 404, "", ""},
+		{"1", "/about.html?x=1", "en", 302, "", "/en/about.html?x=1"},
+		{"root", "/", "de", 302, "", "/de/"},
+		{"root", "/about.html", "en", 200, "about", ""},
+	}
+	for _, test := range tests {
+		localeRedirect = test.redirect
+		name := test.uri + " " + test.language
+		ctx := serveWith(test.uri, map[string]string{"Accept-Language": test.language})
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", name, status, test.status)
+			continue
+		}
+		if test.body != "" && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s: serving %q, want %q", name, ctx.Response.Body(), test.body)
+		}
+		if location := string(ctx.Response.Header.Peek("Location")); !strings.HasSuffix(location, test.location) {
+			t.Errorf("%s: Location %q, want %q", name, location, test.location)
+		}
+		if !strings.HasPrefix(test.uri, "/de/") && !strings.Contains(string(ctx.Response.Header.Peek("Vary")), "Accept-Language") {
+			t.Errorf("%s: doesn't vary on Accept-Language", name)
+		}
+	}
+}
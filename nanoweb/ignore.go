@@ -0,0 +1,119 @@
+package nanoweb
+
+import (
+	"io/fs"
+	"regexp"
+	"strings"
+)
+
+const ignoreFile = ".nanowebignore"
+
+// GITIGNORE=1 also respects a .gitignore in the served directory
+var gitignoreEnabled = getEnv("GITIGNORE", "0") == "1"
+
+type IgnoreRule struct {
+	Pattern *regexp.Regexp
+	Negate  bool
+	DirOnly bool
+}
+
+// Read the gitignore syntax ignore files at the root of a file system
+func loadIgnoreRules(fsys fs.FS) []IgnoreRule {
+	files := []string{ignoreFile}
+	if gitignoreEnabled {
+		files = append(files, ".gitignore")
+	}
+	rules := []IgnoreRule{}
+	for _, file := range files {
+		dat, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(dat), "\n") {
+			if rule, ok := parseIgnoreRule(line); ok {
+				rules = append(rules, rule)
+			}
+		}
+		logln("⇨ ignoring files matching", file)
+	}
+	return rules
+}
+
+func parseIgnoreRule(line string) (IgnoreRule, bool) {
+	line = strings.TrimRight(line, " \r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return IgnoreRule{}, false
+	}
+	rule := IgnoreRule{}
+	if strings.HasPrefix(line, "!") {
+		rule.Negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, "\\")
+	if strings.HasSuffix(line, "/") {
+		rule.DirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// Patterns with a slash are relative to the root, others match at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return IgnoreRule{}, false
+	}
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case strings.HasPrefix(line[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(line[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := strings.Replace(line[i+1:i+end], "!", "^", 1)
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	pattern, err := regexp.Compile(b.String())
+	if err != nil {
+		return IgnoreRule{}, false
+	}
+	rule.Pattern = pattern
+	return rule, true
+}
+
+// Whether a slash separated path relative to the root is ignored. The last
+// matching rule wins, and files in an ignored directory are never seen.
+func ignored(rules []IgnoreRule, name string, isDir bool) bool {
+	if name == ignoreFile {
+		return true
+	}
+	result := false
+	for _, rule := range rules {
+		if rule.DirOnly && !isDir {
+			continue
+		}
+		if rule.Pattern.MatchString(name) {
+			result = !rule.Negate
+		}
+	}
+	return result
+}
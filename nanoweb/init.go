@@ -0,0 +1,104 @@
+package nanoweb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The files `nano-web init` writes, relative to the target dir
+var scaffold = []struct {
+	name    string
+	content string
+}{
+	{"public/index.html", `<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1" />
+    <title>nano-web</title>
+    <link rel="stylesheet" href="/app.css" />
+    <script>
+      window.RUNTIME_ENV = "{{.EscapedJson}}";
+    </script>
+  </head>
+  <body>
+    <h1>Hello from nano-web</h1>
+    <p id="greeting"></p>
+    <script src="/app.js"></script>
+  </body>
+</html>
+`},
+	{"public/app.css", `body {
+  font-family: system-ui, sans-serif;
+  margin: 4rem auto;
+  max-width: 40rem;
+}
+`},
+	{"public/app.js", `let runtimeEnv = {};
+try {
+  runtimeEnv = JSON.parse(window.RUNTIME_ENV || "{}");
+} catch {
+  // not templated
+}
+document.getElementById("greeting").textContent = runtimeEnv.GREETING || "";
+`},
+	{"public/_headers", `# Headers for matching paths, see https://github.com/radiosilence/nano-web#custom-headers
+/*
+  X-Content-Type-Options: nosniff
+  Referrer-Policy: strict-origin-when-cross-origin
+
+# Assets renamed by ` + "`nano-web hash`" + ` never change
+/*.*.css
+  Cache-Control: public, max-age=31536000, immutable
+/*.*.js
+  Cache-Control: public, max-age=31536000, immutable
+`},
+	{"public/_redirects", `# Redirects for paths no file matches, see https://github.com/radiosilence/nano-web#redirects
+/home / 301
+/blog/* /posts/:splat 302
+`},
+	{"nano-web.yaml", `# Settings, named as the environment variables that override them. Run
+# ` + "`nano-web config print-defaults`" + ` to see them all.
+PUBLIC_DIR: public
+SPA_MODE: true
+# Injected into templates such as public/index.html, and can be overridden
+# when deploying
+VITE_GREETING: Configured at runtime
+`},
+	{"Dockerfile", `FROM ghcr.io/radiosilence/nano-web:latest
+COPY ./public /public/
+COPY ./nano-web.yaml /nano-web.yaml
+`},
+	{".dockerignore", `*
+!public
+!nano-web.yaml
+`},
+}
+
+// Scaffold a minimal site, config file and Dockerfile, leaving any existing
+// files alone
+func initCommand(args []string) int {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	for _, file := range scaffold {
+		target := filepath.Join(dir, filepath.FromSlash(file.name))
+		if _, err := os.Stat(target); err == nil {
+			fmt.Println("exists", target)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := os.WriteFile(target, []byte(file.content), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println("created", target)
+	}
+	fmt.Printf("\nrun it from %s with:\n  VITE_GREETING=hello nano-web\n", dir)
+	return 0
+}
@@ -0,0 +1,44 @@
+package nanoweb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The scaffolded config parses, and its site serves with its redirects
+func TestInitScaffold(t *testing.T) {
+	dir := t.TempDir()
+	if code := initCommand([]string{dir}); code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	dat, err := os.ReadFile(filepath.Join(dir, configFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := parseConfigFile(dat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config["SPA_MODE"] != "1" || config["PUBLIC_DIR"] != "public" {
+		t.Errorf("config %v", config)
+	}
+
+	site, err := newSite(&Site{PublicDir: filepath.Join(dir, config["PUBLIC_DIR"])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := site.Build(site.PublicDir)
+	if len(table.errors) > 0 {
+		t.Errorf("errors populating the scaffold: %v", table.errors)
+	}
+	if len(table.Redirects) == 0 {
+		t.Error("no redirects loaded from the scaffold")
+	}
+	if _, exists := table.Routes["/"+redirectsFile]; exists {
+		t.Errorf("%s is served", redirectsFile)
+	}
+	if _, exists := table.Routes["/index.html"]; !exists {
+		t.Error("no index.html")
+	}
+}
@@ -0,0 +1,91 @@
+package nanoweb
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Expected content hashes from a manifest (as printed by `nano-web manifest`)
+// signed with an ed25519 key
+type Integrity struct {
+	Hashes map[string]string
+	Strict bool
+}
+
+func getIntegrity() *Integrity {
+	manifestFile := getEnv("INTEGRITY_MANIFEST", "")
+	if manifestFile == "" {
+		return nil
+	}
+	integrity, err := loadIntegrity(
+		manifestFile,
+		getEnv("INTEGRITY_SIGNATURE", manifestFile+".sig"),
+		getEnv("INTEGRITY_KEY", ""),
+	)
+	if err != nil {
+		configError("error loading integrity manifest: %s", err)
+		return nil
+	}
+	integrity.Strict = getEnv("INTEGRITY_MODE", "strict") != "flag"
+	logln("⇨ verifying content against", manifestFile)
+	return integrity
+}
+
+func loadIntegrity(manifestFile string, signatureFile string, key string) (*Integrity, error) {
+	publicKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("INTEGRITY_KEY must be a base64 ed25519 public key")
+	}
+	dat, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := os.ReadFile(signatureFile)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", signatureFile, err)
+	}
+	if !ed25519.Verify(publicKey, dat, signature) {
+		return nil, fmt.Errorf("bad signature for %s", manifestFile)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(dat, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %s", manifestFile, err)
+	}
+	integrity := &Integrity{Hashes: make(map[string]string)}
+	for _, entry := range manifest.Routes {
+		integrity.Hashes[entry.Path] = entry.Hash
+	}
+	return integrity, nil
+}
+
+// List every route that's missing, unexpected or doesn't match its hash
+func (integrity *Integrity) Verify(table *RouteTable) []string {
+	problems := []string{}
+	seen := make(map[string]bool)
+	for _, entry := range getManifest(table).Routes {
+		seen[entry.Path] = true
+		hash, expected := integrity.Hashes[entry.Path]
+		switch {
+		case !expected:
+			problems = append(problems, "unexpected "+entry.Path)
+		case hash != entry.Hash:
+			problems = append(problems, "modified "+entry.Path)
+		}
+	}
+	for path := range integrity.Hashes {
+		if !seen[path] {
+			problems = append(problems, "missing "+path)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
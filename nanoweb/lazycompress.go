@@ -0,0 +1,94 @@
+package nanoweb
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// With LAZY_COMPRESSION=1 routes are compressed the first time an encoding is
+// asked for, and kept, instead of when the site is populated. Startup is
+// quicker on large sites and memory only goes on encodings clients use.
+var lazyCompression = getEnv("LAZY_COMPRESSION", "0") == "1"
+
+// Compressed encodings of content made on first use. Shared by every copy of
+// a route, as routes are stored by value.
+type lazyContent struct {
+	plain      []byte
+	gzipOnce   sync.Once
+	brotliOnce sync.Once
+	gzip       atomic.Pointer[[]byte]
+	brotli     atomic.Pointer[[]byte]
+}
+
+// The content may be a mapped file, which is left uncompressed if it was
+// truncated underneath its mapping
+func (lazy *lazyContent) Gzip() []byte {
+	lazy.gzipOnce.Do(func() {
+		var dat []byte
+		guardMapped(func() { dat = gzipData(lazy.plain) })
+		lazy.gzip.Store(&dat)
+	})
+	return *lazy.gzip.Load()
+}
+
+func (lazy *lazyContent) Brotli() []byte {
+	lazy.brotliOnce.Do(func() {
+		var dat []byte
+		guardMapped(func() { dat = brotliData(lazy.plain) })
+		lazy.brotli.Store(&dat)
+	})
+	return *lazy.brotli.Load()
+}
+
+// Whether the route has compressed encodings, or will have on first request
+func (route Route) compressed() bool {
+	return route.Content.Gzip != nil || route.Content.Brotli != nil || route.Content.Zstd != nil || route.lazy != nil
+}
+
+// The route's content for an accepted encoding, compressing it first if
+// it's lazy
+func (route Route) encodedContent(acceptedEncoding string) (string, []byte) {
+	content := route.Content
+	if route.lazy != nil {
+		switch acceptedEncoding {
+		case "br":
+			content.Brotli = route.lazy.Brotli()
+		case "gzip":
+			content.Gzip = route.lazy.Gzip()
+		}
+	}
+	return getEncodedContent(acceptedEncoding, content)
+}
+
+// Content-Length of the route in an encoding from encodedContent
+func (route Route) encodedLength(encoding string) int {
+	switch encoding {
+	case "br":
+		if route.lazy != nil {
+			return len(route.lazy.Brotli())
+		}
+		return route.BrotliLen
+	case "gzip":
+		if route.lazy != nil {
+			return len(route.lazy.Gzip())
+		}
+		return route.GzipLen
+	case "zstd":
+		return route.ZstdLen
+	}
+	return route.PlainLen
+}
+
+// Bytes held for each compressed encoding, so far for lazy routes
+func (route Route) compressedSizes() (int, int) {
+	gzip, brotli := len(route.Content.Gzip), len(route.Content.Brotli)
+	if route.lazy != nil {
+		if dat := route.lazy.gzip.Load(); dat != nil {
+			gzip = len(*dat)
+		}
+		if dat := route.lazy.brotli.Load(); dat != nil {
+			brotli = len(*dat)
+		}
+	}
+	return gzip, brotli
+}
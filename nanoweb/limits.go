@@ -0,0 +1,192 @@
+package nanoweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Guardrails against huge files ending up in memory: files over
+// MAX_FILE_SIZE, or past MAX_TOTAL_SIZE for the site, are skipped with a
+// warning, streamed from disk or stop the server starting (OVERSIZE). Files
+// over STREAM_FILE_SIZE are always streamed from disk, as a matter of course.
+var maxFileSize = getSizeLimit("MAX_FILE_SIZE")
+var streamFileSize = getSizeLimit("STREAM_FILE_SIZE")
+var maxTotalSize = getSizeLimit("MAX_TOTAL_SIZE")
+var oversize = getOversize()
+
+func getSizeLimit(name string) int64 {
+	value := getEnv(name, "")
+	if value == "" {
+		return 0
+	}
+	size, err := parseSize(value)
+	if err != nil {
+		configError("invalid %s: %s", name, err)
+		return 0
+	}
+	return size
+}
+
+func getOversize() string {
+	switch value := getEnv("OVERSIZE", "skip"); value {
+	case "skip", "stream", "fail":
+		return value
+	default:
+		configError("invalid OVERSIZE %q", value)
+		return "skip"
+	}
+}
+
+// Decide what to do with a file before reading it into memory, returning
+// false if it should be left out. Files to stream get a disk-backed route.
+func (table *RouteTable) checkSize(site *Site, source string, size int64, onDisk bool) (Route, bool, bool) {
+	if streamFileSize > 0 && size > streamFileSize && onDisk {
+		if route, err := makeFileRoute(source); err == nil {
+			logln("⇨ streaming", source, "from disk,", size, "bytes")
+			return route, true, true
+		}
+	}
+	var problem string
+	switch {
+	case maxFileSize > 0 && size > maxFileSize:
+		problem = fmt.Sprintf("%s is %d bytes, over MAX_FILE_SIZE", source, size)
+	case maxTotalSize > 0 && table.size+size > maxTotalSize:
+		problem = fmt.Sprintf("%s would take the site over MAX_TOTAL_SIZE", source)
+	default:
+		table.size += size
+		return Route{}, false, true
+	}
+	if oversize == "stream" && onDisk {
+		route, err := makeFileRoute(source)
+		if err == nil {
+			logln("⇨ streaming", problem)
+			return route, true, true
+		}
+	}
+	if oversize == "fail" && site.Table().DeployID == "" {
+		logln("⇨ refusing to start,", problem)
+		table.unservable = errors.New(problem)
+		return Route{}, false, false
+	}
+	logln("⇨ skipping", problem)
+	table.Problems = append(table.Problems, "skipped "+problem)
+	return Route{}, false, false
+}
+
+// A route served from disk instead of memory
+func makeFileRoute(source string) (Route, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return Route{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return Route{}, err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return Route{}, err
+	}
+	return Route{
+		File:         source,
+		PlainLen:     int(info.Size()),
+		Hash:         hex.EncodeToString(hash.Sum(nil)),
+		ContentType:  getMimetype(strings.ToLower(filepath.Ext(source))),
+		LastModified: info.ModTime().UTC().Format(http.TimeFormat),
+	}, nil
+}
+
+// Log the biggest files in a table
+func reportLargestRoutes(table *RouteTable) {
+	entries := getManifest(table).Routes
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Size > entries[j].Size })
+	largest := []string{}
+	for i := 0; i < len(entries) && i < 5; i++ {
+		largest = append(largest, fmt.Sprintf("%s (%d bytes)", entries[i].Path, entries[i].Size))
+	}
+	if len(largest) > 0 {
+		logf("⇨ %d bytes in memory, largest: %s\n", table.size, strings.Join(largest, ", "))
+	}
+}
+
+// Write a route's uncompressed content, reading it from disk if needed
+func (route Route) writeTo(w io.Writer) error {
+	if route.File == "" {
+		_, err := w.Write(route.Content.Plain)
+		return err
+	}
+	file, err := os.Open(route.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// A range of an open file, closed once it's been sent
+type fileSection struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// Stream a disk-backed route's file, uncompressed as the ETag is the file's.
+// Unlike fasthttp.ServeFile this leaves the request URI and the precomputed
+// headers alone.
+func serveFile(ctx *fasthttp.RequestCtx, name string, etag string, lastModified string) {
+	file, err := os.Open(name)
+	if err != nil {
+		logln("⇨ error opening", name, err)
+		ctx.Error("Not Found", fasthttp.StatusNotFound)
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		logln("⇨ error opening", name, err)
+		ctx.Error("Not Found", fasthttp.StatusNotFound)
+		return
+	}
+	size := int(info.Size())
+	ctx.Response.Header.Set("Accept-Ranges", "bytes")
+	ctx.Response.Header.SetContentLength(size)
+	if ctx.IsHead() {
+		file.Close()
+		ctx.Response.SkipBody = true
+		return
+	}
+	if serveRange(ctx, size, etag, lastModified, func(start int, end int) {
+		length := end - start + 1
+		ctx.SetBodyStream(fileSection{io.NewSectionReader(file, int64(start), int64(length)), file}, length)
+	}) {
+		if ctx.Response.StatusCode() != fasthttp.StatusPartialContent {
+			file.Close()
+		}
+		return
+	}
+	ctx.SetBodyStream(file, size)
+}
+
+// Copy a disk-backed route to a file
+func exportFileRoute(route Route, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return route.writeTo(file)
+}
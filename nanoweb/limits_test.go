@@ -0,0 +1,72 @@
+package nanoweb
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Files over STREAM_FILE_SIZE are sent from disk with their precomputed
+// headers, and the request is logged with its own path
+func TestStreamedFiles(t *testing.T) {
+	previous := streamFileSize
+	streamFileSize = 4
+	t.Cleanup(func() { streamFileSize = previous })
+	data := "0123456789"
+	site := testSite(t, map[string]string{"video.mp4": data, "50% off.txt": data})
+
+	previousFormat, previousOutput := accessLogFormat, logOutput
+	var logged bytes.Buffer
+	accessLogFormat, logOutput = "ecs", &logged
+	t.Cleanup(func() { accessLogFormat, logOutput = previousFormat, previousOutput })
+
+	tests := []struct {
+		method  string
+		uri     string
+		path    string
+		headers map[string]string
+		status  int
+		body    string
+	}{
+		{"GET", "/video.mp4", "/video.mp4", nil, 200, data},
+		{"GET", "/50%25%20off.txt", "/50% off.txt", nil, 200, data},
+		{"GET", "/video.mp4", "/video.mp4", map[string]string{"Range": "bytes=2-4"}, 206, data[2:5]},
+		{"GET", "/video.mp4", "/video.mp4", map[string]string{"Range": "bytes=20-"}, 416, ""},
+		{"HEAD", "/video.mp4", "/video.mp4", nil, 200, ""},
+	}
+	for _, test := range tests {
+		route := site.Table().Routes[test.path]
+		if route.File == "" {
+			t.Fatalf("%s isn't served from disk", test.path)
+		}
+		logged.Reset()
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.uri)
+		for key, value := range test.headers {
+			ctx.Request.Header.Set(key, value)
+		}
+		observeRequests(handler)(ctx)
+		name := test.method + " " + test.uri
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", name, status, test.status)
+		}
+		if test.status != 416 && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s: body %q, want %q", name, ctx.Response.Body(), test.body)
+		}
+		if test.status != 416 {
+			if contentType := string(ctx.Response.Header.ContentType()); contentType != contentTypeHeader(route.ContentType) {
+				t.Errorf("%s: Content-Type %q, want %q", name, contentType, contentTypeHeader(route.ContentType))
+			}
+		}
+		var entry ecsAccessLog
+		if err := json.Unmarshal(logged.Bytes(), &entry); err != nil {
+			t.Fatalf("%s: access log %q: %s", name, logged.String(), err)
+		}
+		if entry.URL.Path != test.path {
+			t.Errorf("%s: logged path %q, want %q", name, entry.URL.Path, test.path)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package nanoweb
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Request and response hooks from a Lua script (LUA_SCRIPT), for one-off
+// logic such as A/B assignment or unusual redirects.
+//
+// on_request(req) can change req.path, req.headers or req.query before the
+// request is served, or return {status=, headers=, body=} to respond itself.
+// on_response(req, res) can change res.status and res.headers.
+type LuaHooks struct {
+	proto *lua.FunctionProto
+	pool  sync.Pool
+}
+
+func getLuaHooks() *LuaHooks {
+	file := getEnv("LUA_SCRIPT", "")
+	if file == "" {
+		return nil
+	}
+	hooks, err := newLuaHooks(file)
+	if err != nil {
+		configError("error loading %s: %s", file, err)
+		return nil
+	}
+	logln("⇨ loaded Lua hooks from", file)
+	return hooks
+}
+
+func newLuaHooks(file string) (*LuaHooks, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	state := lua.NewState()
+	defer state.Close()
+	fn, err := state.Load(strings.NewReader(string(source)), file)
+	if err != nil {
+		return nil, err
+	}
+	hooks := &LuaHooks{proto: fn.Proto}
+	// Make sure the script runs before serving anything
+	if _, err := hooks.newState(); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// Lua states aren't safe for concurrent use, so each request borrows one
+func (hooks *LuaHooks) newState() (*lua.LState, error) {
+	state := lua.NewState()
+	state.Push(state.NewFunctionFromProto(hooks.proto))
+	if err := state.PCall(0, lua.MultRet, nil); err != nil {
+		state.Close()
+		return nil, err
+	}
+	return state, nil
+}
+
+func (hooks *LuaHooks) getState() *lua.LState {
+	if state, ok := hooks.pool.Get().(*lua.LState); ok {
+		return state
+	}
+	state, err := hooks.newState()
+	if err != nil {
+		logln("⇨ error running Lua script", err)
+		return nil
+	}
+	return state
+}
+
+func (hooks *LuaHooks) wrap(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		state := hooks.getState()
+		if state == nil {
+			next(ctx)
+			return
+		}
+		defer hooks.pool.Put(state)
+		req := requestTable(state, ctx)
+		if fn, ok := state.GetGlobal("on_request").(*lua.LFunction); ok {
+			if err := state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, req); err != nil {
+				logln("⇨ error in on_request", err)
+			} else {
+				ret := state.Get(-1)
+				state.Pop(1)
+				if res, ok := ret.(*lua.LTable); ok {
+					respondFromTable(ctx, res)
+					return
+				}
+				applyRequestTable(ctx, req)
+			}
+		}
+		next(ctx)
+		if fn, ok := state.GetGlobal("on_response").(*lua.LFunction); ok {
+			res := state.NewTable()
+			res.RawSetString("status", lua.LNumber(ctx.Response.StatusCode()))
+			headers := state.NewTable()
+			keys := []string{}
+			ctx.Response.Header.VisitAll(func(key, value []byte) {
+				keys = append(keys, string(key))
+				headers.RawSetString(string(key), lua.LString(value))
+			})
+			res.RawSetString("headers", headers)
+			if err := state.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, req, res); err != nil {
+				logln("⇨ error in on_response", err)
+				return
+			}
+			if status, ok := res.RawGetString("status").(lua.LNumber); ok {
+				ctx.Response.SetStatusCode(int(status))
+			}
+			applyHeaders(&ctx.Response.Header, keys, res.RawGetString("headers"))
+		}
+	}
+}
+
+func requestTable(state *lua.LState, ctx *fasthttp.RequestCtx) *lua.LTable {
+	req := state.NewTable()
+	req.RawSetString("method", lua.LString(ctx.Method()))
+	req.RawSetString("path", lua.LString(ctx.Path()))
+	req.RawSetString("query", lua.LString(ctx.URI().QueryString()))
+	req.RawSetString("host", lua.LString(ctx.Host()))
+	req.RawSetString("ip", lua.LString(ctx.RemoteIP().String()))
+	headers := state.NewTable()
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		headers.RawSetString(strings.ToLower(string(key)), lua.LString(value))
+	})
+	req.RawSetString("headers", headers)
+	cookies := state.NewTable()
+	ctx.Request.Header.VisitAllCookie(func(key, value []byte) {
+		cookies.RawSetString(string(key), lua.LString(value))
+	})
+	req.RawSetString("cookies", cookies)
+	return req
+}
+
+// Rewrite the request with whatever on_request changed
+func applyRequestTable(ctx *fasthttp.RequestCtx, req *lua.LTable) {
+	if path := lua.LVAsString(req.RawGetString("path")); path != "" && path != string(ctx.Path()) {
+		ctx.URI().SetPath(path)
+	}
+	if query := lua.LVAsString(req.RawGetString("query")); query != string(ctx.URI().QueryString()) {
+		ctx.URI().SetQueryString(query)
+	}
+	if headers, ok := req.RawGetString("headers").(*lua.LTable); ok {
+		headers.ForEach(func(key, value lua.LValue) {
+			ctx.Request.Header.Set(lua.LVAsString(key), lua.LVAsString(value))
+		})
+	}
+}
+
+func respondFromTable(ctx *fasthttp.RequestCtx, res *lua.LTable) {
+	status := fasthttp.StatusOK
+	if value, ok := res.RawGetString("status").(lua.LNumber); ok {
+		status = int(value)
+	}
+	ctx.SetStatusCode(status)
+	if headers, ok := res.RawGetString("headers").(*lua.LTable); ok {
+		headers.ForEach(func(key, value lua.LValue) {
+			ctx.Response.Header.Set(lua.LVAsString(key), lua.LVAsString(value))
+		})
+	}
+	ctx.SetBodyString(lua.LVAsString(res.RawGetString("body")))
+}
+
+// Set the headers in the table after on_response, removing any it removed
+func applyHeaders(header *fasthttp.ResponseHeader, keys []string, after lua.LValue) {
+	table, ok := after.(*lua.LTable)
+	if !ok {
+		return
+	}
+	for _, key := range keys {
+		if table.RawGetString(key) == lua.LNil {
+			header.Del(key)
+		}
+	}
+	table.ForEach(func(key, value lua.LValue) {
+		if name := lua.LVAsString(key); !strings.EqualFold(name, "Content-Length") {
+			header.Set(name, lua.LVAsString(value))
+		}
+	})
+}
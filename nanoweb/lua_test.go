@@ -0,0 +1,75 @@
+package nanoweb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+const testLuaScript = `
+function on_request(req)
+  if req.path == "/blocked" then
+    return {status = 403, headers = {["X-Blocked"] = req.headers["x-reason"]}, body = "blocked"}
+  end
+  if req.path == "/old" then
+    req.path = "/new.html"
+  end
+end
+
+function on_response(req, res)
+  res.headers["X-Hooked"] = req.path
+  res.headers["Server"] = nil
+  if req.path == "/new.html" then
+    res.status = 201
+  end
+end
+`
+
+func TestLuaHooks(t *testing.T) {
+	testSite(t, map[string]string{"index.html": "home", "new.html": "new"})
+	script := filepath.Join(t.TempDir(), "hooks.lua")
+	if err := os.WriteFile(script, []byte(testLuaScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hooks, err := newLuaHooks(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped := hooks.wrap(handler)
+
+	tests := []struct {
+		uri     string
+		status  int
+		body    string
+		headers map[string]string
+	}{
+		{"/", 200, "home", map[string]string{"X-Hooked": "/", "Server": ""}},
+		// Rewritten by on_request, then changed by on_response
+		{"/old", 201, "new", map[string]string{"X-Hooked": "/new.html"}},
+		// Answered by on_request without serving anything
+		{"/blocked", 403, "blocked", map[string]string{"X-Blocked": "testing", "X-Hooked": ""}},
+	}
+	for _, test := range tests {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(test.uri)
+		ctx.Request.Header.Set("X-Reason", "testing")
+		wrapped(ctx)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.uri, status, test.status)
+		}
+		if body := string(ctx.Response.Body()); body != test.body {
+			t.Errorf("%s: body %q, want %q", test.uri, body, test.body)
+		}
+		for key, value := range test.headers {
+			if header := string(ctx.Response.Header.Peek(key)); header != value {
+				t.Errorf("%s: %s %q, want %q", test.uri, key, header, value)
+			}
+		}
+	}
+
+	if _, err := newLuaHooks(filepath.Join(t.TempDir(), "missing.lua")); err == nil {
+		t.Error("no error loading a missing script")
+	}
+}
@@ -0,0 +1,74 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/valyala/fasthttp"
+)
+
+const manifestPath = "/_manifest"
+
+var manifestEnabled = getEnv("MANIFEST", "0") == "1"
+
+type ManifestEntry struct {
+	Path         string `json:"path"`
+	ContentType  string `json:"contentType"`
+	Hash         string `json:"hash"`
+	CacheControl string `json:"cacheControl,omitempty"`
+	Size         int    `json:"size"`
+	GzipSize     int    `json:"gzipSize,omitempty"`
+	BrotliSize   int    `json:"brotliSize,omitempty"`
+}
+
+type Manifest struct {
+	DeployID string          `json:"deployId"`
+	Routes   []ManifestEntry `json:"routes"`
+}
+
+// List the files and generated routes in a table, leaving out index aliases
+func getManifest(table *RouteTable) Manifest {
+	manifest := Manifest{DeployID: table.DeployID, Routes: []ManifestEntry{}}
+	for path, route := range table.Routes {
+		if route.Source != "" && !isFileRoute(path, route) {
+			continue
+		}
+		gzip, brotli := route.compressedSizes()
+		manifest.Routes = append(manifest.Routes, ManifestEntry{
+			Path:         path,
+			ContentType:  route.ContentType,
+			Hash:         route.Hash,
+			CacheControl: route.getHeader("Cache-Control"),
+			Size:         route.PlainLen,
+			GzipSize:     gzip,
+			BrotliSize:   brotli,
+		})
+	}
+	sort.Slice(manifest.Routes, func(i, j int) bool {
+		return manifest.Routes[i].Path < manifest.Routes[j].Path
+	})
+	return manifest
+}
+
+func manifestHandler(ctx *fasthttp.RequestCtx, table *RouteTable) {
+	writeJSON(ctx, fasthttp.StatusOK, getManifest(table))
+}
+
+// Print the manifest for a directory without starting the server, so builds
+// can be diffed
+func manifestCommand(args []string) int {
+	site, err := getCommandSite(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(getManifest(site.Build(site.PublicDir))); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
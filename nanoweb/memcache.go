@@ -0,0 +1,195 @@
+package nanoweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MAX_CACHE_BYTES caps how much of each site's file content is held in
+// memory. Files past it are served from disk instead, and every
+// memoryCacheInterval the most requested files are moved into memory and the
+// least requested out, so the hot set stays in memory however big the site.
+var maxCacheBytes = getSizeLimit("MAX_CACHE_BYTES")
+
+const memoryCacheInterval = 10 * time.Second
+
+// Requests for routes that could be in memory, by where they were served from
+var memoryCacheHits, memoryCacheMisses atomic.Int64
+
+// Requests for each file since the last rebalance, decayed so recent
+// requests count for more
+type memoryCache struct {
+	mu   sync.Mutex
+	hits map[string]int64
+}
+
+func newMemoryCache() *memoryCache {
+	if maxCacheBytes == 0 {
+		return nil
+	}
+	return &memoryCache{hits: make(map[string]int64)}
+}
+
+// Count a request for a route
+func (cache *memoryCache) record(route Route) {
+	if cache == nil || !route.verbatim {
+		return
+	}
+	if route.File == "" {
+		memoryCacheHits.Add(1)
+	} else {
+		memoryCacheMisses.Add(1)
+	}
+	cache.mu.Lock()
+	cache.hits[route.Source]++
+	cache.mu.Unlock()
+}
+
+// Bytes a route holds in memory
+func memorySize(route Route) int64 {
+	gzip, brotli := route.compressedSizes()
+	return int64(len(route.Content.Plain) + gzip + brotli + len(route.Content.Zstd))
+}
+
+// Whether a newly populated route fits in the site's budget, counting it if
+// it does
+func (table *RouteTable) admit(route Route) bool {
+	if maxCacheBytes == 0 || !route.verbatim || route.File != "" {
+		return true
+	}
+	size := memorySize(route)
+	if table.cacheBytes+size > maxCacheBytes {
+		return false
+	}
+	table.cacheBytes += size
+	return true
+}
+
+// The route served from its file on disk instead of memory
+func diskRoute(route Route) Route {
+	route.File = route.Source
+	route.Content = Content{}
+	route.GzipLen, route.BrotliLen, route.ZstdLen = 0, 0, 0
+	route.lazy = nil
+	return route
+}
+
+// The route served from memory again, as long as its file hasn't changed
+func memoryRoute(route Route) (Route, bool) {
+	dat, err := os.ReadFile(route.Source)
+	if err != nil {
+		return route, false
+	}
+	hash := sha256.Sum256(dat)
+	if hex.EncodeToString(hash[:]) != route.Hash {
+		return route, false
+	}
+	fresh := makeCompressedRoute(dat, route.ContentType, time.Time{}, shouldCompress(route.Source, route.ContentType))
+	route.File = ""
+	route.Content, route.lazy = fresh.Content, fresh.lazy
+	route.PlainLen, route.GzipLen, route.BrotliLen, route.ZstdLen = fresh.PlainLen, fresh.GzipLen, fresh.BrotliLen, fresh.ZstdLen
+	return route, true
+}
+
+func rebalanceMemoryCaches() {
+	for range time.Tick(memoryCacheInterval) {
+		for _, site := range sites {
+			if site.memory != nil {
+				site.rebalanceMemory()
+			}
+		}
+	}
+}
+
+// Keep the most requested files in memory, within the budget
+func (site *Site) rebalanceMemory() {
+	site.memory.mu.Lock()
+	hits := make(map[string]int64, len(site.memory.hits))
+	for source, count := range site.memory.hits {
+		hits[source] = count
+		if count/2 == 0 {
+			delete(site.memory.hits, source)
+		} else {
+			site.memory.hits[source] = count / 2
+		}
+	}
+	site.memory.mu.Unlock()
+
+	// One route per file, as index pages are routed more than once
+	routes := make(map[string]Route)
+	for _, route := range site.Table().Routes {
+		if route.verbatim {
+			routes[route.Source] = route
+		}
+	}
+	sources := make([]string, 0, len(routes))
+	for source := range routes {
+		sources = append(sources, source)
+	}
+	// Most requested first, and what's in memory first when it's a tie, so
+	// files aren't swapped for no reason
+	sort.Slice(sources, func(i, j int) bool {
+		a, b := sources[i], sources[j]
+		if hits[a] != hits[b] {
+			return hits[a] > hits[b]
+		}
+		return routes[a].File == "" && routes[b].File != ""
+	})
+
+	remaining := maxCacheBytes
+	changed := make(map[string]Route)
+	for _, source := range sources {
+		route := routes[source]
+		if route.File == "" {
+			if size := memorySize(route); size <= remaining {
+				remaining -= size
+			} else {
+				changed[source] = diskRoute(route)
+			}
+			continue
+		}
+		if hits[source] == 0 {
+			continue
+		}
+		if info, err := os.Stat(source); err != nil || info.Size() > remaining {
+			continue
+		}
+		if promoted, ok := memoryRoute(route); ok {
+			if size := memorySize(promoted); size <= remaining {
+				remaining -= size
+				changed[source] = promoted
+			}
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	site.updateRoutes(func(current Routes) {
+		for urlPath, route := range current {
+			if replacement, ok := changed[route.Source]; ok && route.verbatim && route.Hash == replacement.Hash {
+				current[urlPath] = replacement
+			}
+		}
+	})
+}
+
+func writeMemoryCacheMetrics(w io.Writer) {
+	if maxCacheBytes == 0 {
+		return
+	}
+	hits, misses := memoryCacheHits.Load(), memoryCacheMisses.Load()
+	fmt.Fprintln(w, "# TYPE nano_web_memory_cache_requests_total counter")
+	fmt.Fprintf(w, "nano_web_memory_cache_requests_total{result=\"hit\"} %d\n", hits)
+	fmt.Fprintf(w, "nano_web_memory_cache_requests_total{result=\"miss\"} %d\n", misses)
+	if hits+misses > 0 {
+		fmt.Fprintln(w, "# TYPE nano_web_memory_cache_hit_ratio gauge")
+		fmt.Fprintf(w, "nano_web_memory_cache_hit_ratio %g\n", float64(hits)/float64(hits+misses))
+	}
+}
@@ -0,0 +1,27 @@
+package nanoweb
+
+import "github.com/valyala/fasthttp"
+
+// Routes can only be read
+const allowedMethods = "GET, HEAD, OPTIONS"
+
+// Whether the request's method reads the route. OPTIONS is answered with the
+// allowed methods, as a CORS preflight for streamed media too, and anything
+// else gets 405.
+func allowMethod(ctx *fasthttp.RequestCtx, route Route) bool {
+	if ctx.IsGet() || ctx.IsHead() {
+		return true
+	}
+	if ctx.IsOptions() {
+		ctx.Response.Header.Set("Allow", allowedMethods)
+		if streamingEnabled && streamingType(route.ContentType) {
+			setStreamingHeaders(ctx)
+			ctx.Response.Header.Set("Access-Control-Allow-Methods", allowedMethods)
+		}
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+		return false
+	}
+	ctx.Error("Method Not Allowed", fasthttp.StatusMethodNotAllowed)
+	ctx.Response.Header.Set("Allow", allowedMethods)
+	return false
+}
@@ -0,0 +1,52 @@
+package nanoweb
+
+import "testing"
+
+func TestMethods(t *testing.T) {
+	testSite(t, map[string]string{"index.html": "home", "video.mp4": "video"})
+	previous := streamingEnabled
+	streamingEnabled = true
+	t.Cleanup(func() { streamingEnabled = previous })
+
+	tests := []struct {
+		method string
+		uri    string
+		status int
+		body   string
+		allow  string
+		cors   string
+	}{
+		{"GET", "/", 200, "home", "", ""},
+		{"HEAD", "/", 200, "", "", ""},
+		{"OPTIONS", "/", 204, "", allowedMethods, ""},
+		{"OPTIONS", "/video.mp4", 204, "", allowedMethods, allowedMethods},
+		{"POST", "/", 405, "", allowedMethods, ""},
+		{"PUT", "/index.html", 405, "", allowedMethods, ""},
+		{"DELETE", "/video.mp4", 405, "", allowedMethods, ""},
+		{"PATCH", "/", 405, "", allowedMethods, ""},
+	}
+	for _, test := range tests {
+		ctx := serveMethod(test.method, test.uri, nil)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s %s: status %d, want %d", test.method, test.uri, status, test.status)
+		}
+		if allow := string(ctx.Response.Header.Peek("Allow")); allow != test.allow {
+			t.Errorf("%s %s: Allow %q, want %q", test.method, test.uri, allow, test.allow)
+		}
+		if cors := string(ctx.Response.Header.Peek("Access-Control-Allow-Methods")); cors != test.cors {
+			t.Errorf("%s %s: Access-Control-Allow-Methods %q, want %q", test.method, test.uri, cors, test.cors)
+		}
+		if test.status != 405 && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s %s: body %q, want %q", test.method, test.uri, ctx.Response.Body(), test.body)
+		}
+	}
+
+	// HEAD describes the body GET would send, without sending it
+	head := serveMethod("HEAD", "/", nil)
+	if length := head.Response.Header.ContentLength(); length != len("home") {
+		t.Errorf("HEAD: Content-Length %d, want %d", length, len("home"))
+	}
+	if !head.Response.SkipBody {
+		t.Error("HEAD: body not skipped")
+	}
+}
@@ -0,0 +1,288 @@
+package nanoweb
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const metricsPath = "/__metrics"
+
+type RequestMetric struct {
+	Host     string
+	Method   string
+	Status   int
+	Bytes    int
+	Duration time.Duration
+	// Set when GeoIP is enabled
+	Country string
+}
+
+type ReloadMetric struct {
+	Hosts    []string
+	Routes   int
+	Duration time.Duration
+}
+
+// Receives telemetry. Set with METRICS or WithMetrics.
+type MetricsSink interface {
+	// Every request, after the response is ready
+	ObserveRequest(metric RequestMetric)
+	// Whether a request was served from a route ("hit"), the SPA fallback
+	// ("fallback") or not found ("miss")
+	CacheEvent(result string, path string)
+	// A site repopulated
+	ReloadEvent(metric ReloadMetric)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRequest(RequestMetric) {}
+func (noopMetrics) CacheEvent(string, string)    {}
+func (noopMetrics) ReloadEvent(ReloadMetric)     {}
+
+var metrics MetricsSink = getMetricsSink()
+
+// METRICS is prometheus to serve /__metrics, pushgateway to push the same
+// metrics to METRICS_PUSH_URL, or statsd to send to STATSD_ADDR
+func getMetricsSink() MetricsSink {
+	switch sink := getEnv("METRICS", ""); sink {
+	case "":
+		return noopMetrics{}
+	case "prometheus":
+		return newPrometheusMetrics()
+	case "pushgateway":
+		prometheus := newPrometheusMetrics()
+		prometheus.push = true
+		return prometheus
+	case "statsd":
+		statsd, err := newStatsdMetrics(getEnv("STATSD_ADDR", "localhost:8125"))
+		if err != nil {
+			configError("error connecting to statsd: %s", err)
+			return noopMetrics{}
+		}
+		return statsd
+	default:
+		configError("unknown METRICS %q", sink)
+		return noopMetrics{}
+	}
+}
+
+// Send telemetry to a sink instead of the one configured by METRICS
+func WithMetrics(sink MetricsSink) Option {
+	return func(server *Server) error {
+		metrics = sink
+		return nil
+	}
+}
+
+// Bytes in the response body. Streamed files are counted by their
+// Content-Length rather than read into memory.
+func responseSize(ctx *fasthttp.RequestCtx) int {
+	if ctx.Response.IsBodyStream() {
+		return max(ctx.Response.Header.ContentLength(), 0)
+	}
+	return len(ctx.Response.Body())
+}
+
+func observeRequests(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		next(ctx)
+		geo, _ := requestGeo(ctx)
+		duration := time.Since(start)
+		recordRequestStats(ctx.Response.StatusCode(), duration)
+		if accessLogFormat == "ecs" {
+			logECSAccess(ctx, start, duration)
+		}
+		metrics.ObserveRequest(RequestMetric{
+			Host:     string(ctx.Host()),
+			Method:   string(ctx.Method()),
+			Status:   ctx.Response.StatusCode(),
+			Bytes:    responseSize(ctx),
+			Duration: duration,
+			Country:  geo.Country,
+		})
+	}
+}
+
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// Metrics in the Prometheus text format, served from /__metrics
+type PrometheusMetrics struct {
+	mu            sync.Mutex
+	requests      map[string]int64
+	responseBytes int64
+	latency       []int64
+	latencySum    float64
+	latencyCount  int64
+	cache         map[string]int64
+	countries     map[string]int64
+	reloads       int64
+	routes        map[string]int
+	reloadSeconds float64
+	// Pushed to a Pushgateway instead of scraped
+	push bool
+}
+
+// Whether /__metrics is served
+func isPrometheus() bool {
+	prometheus, ok := metrics.(*PrometheusMetrics)
+	return ok && !prometheus.push
+}
+
+// Methods are labelled as sent only if they're standard, so clients can't
+// make up a new series with each request
+func methodLabel(method string) string {
+	switch method {
+	case fasthttp.MethodGet, fasthttp.MethodHead, fasthttp.MethodPost, fasthttp.MethodPut, fasthttp.MethodPatch,
+		fasthttp.MethodDelete, fasthttp.MethodConnect, fasthttp.MethodOptions, fasthttp.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+func newPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		requests:  make(map[string]int64),
+		latency:   make([]int64, len(latencyBuckets)),
+		cache:     make(map[string]int64),
+		countries: make(map[string]int64),
+		routes:    make(map[string]int),
+	}
+}
+
+func (prometheus *PrometheusMetrics) ObserveRequest(metric RequestMetric) {
+	seconds := metric.Duration.Seconds()
+	prometheus.mu.Lock()
+	defer prometheus.mu.Unlock()
+	prometheus.requests[fmt.Sprintf(`method=%q,status="%d"`, methodLabel(metric.Method), metric.Status)]++
+	prometheus.responseBytes += int64(metric.Bytes)
+	for i, bucket := range latencyBuckets {
+		if seconds <= bucket {
+			prometheus.latency[i]++
+		}
+	}
+	prometheus.latencySum += seconds
+	prometheus.latencyCount++
+	if metric.Country != "" {
+		prometheus.countries[metric.Country]++
+	}
+}
+
+func (prometheus *PrometheusMetrics) CacheEvent(result string, path string) {
+	prometheus.mu.Lock()
+	defer prometheus.mu.Unlock()
+	prometheus.cache[result]++
+}
+
+func (prometheus *PrometheusMetrics) ReloadEvent(metric ReloadMetric) {
+	prometheus.mu.Lock()
+	defer prometheus.mu.Unlock()
+	prometheus.reloads++
+	prometheus.routes[strings.Join(metric.Hosts, ",")] = metric.Routes
+	prometheus.reloadSeconds = metric.Duration.Seconds()
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (prometheus *PrometheusMetrics) handler(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("Content-Type", prometheusContentType)
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	prometheus.write(ctx)
+}
+
+const prometheusContentType = "text/plain; version=0.0.4"
+
+// Write the metrics in the text exposition format
+func (prometheus *PrometheusMetrics) write(w io.Writer) {
+	prometheus.mu.Lock()
+	defer prometheus.mu.Unlock()
+	fmt.Fprintln(w, "# TYPE nano_web_requests_total counter")
+	for _, labels := range sortedKeys(prometheus.requests) {
+		fmt.Fprintf(w, "nano_web_requests_total{%s} %d\n", labels, prometheus.requests[labels])
+	}
+	fmt.Fprintln(w, "# TYPE nano_web_response_bytes_total counter")
+	fmt.Fprintf(w, "nano_web_response_bytes_total %d\n", prometheus.responseBytes)
+	fmt.Fprintln(w, "# TYPE nano_web_request_duration_seconds histogram")
+	for i, bucket := range latencyBuckets {
+		fmt.Fprintf(w, "nano_web_request_duration_seconds_bucket{le=\"%g\"} %d\n", bucket, prometheus.latency[i])
+	}
+	fmt.Fprintf(w, "nano_web_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", prometheus.latencyCount)
+	fmt.Fprintf(w, "nano_web_request_duration_seconds_sum %g\n", prometheus.latencySum)
+	fmt.Fprintf(w, "nano_web_request_duration_seconds_count %d\n", prometheus.latencyCount)
+	fmt.Fprintln(w, "# TYPE nano_web_cache_total counter")
+	for _, result := range sortedKeys(prometheus.cache) {
+		fmt.Fprintf(w, "nano_web_cache_total{result=%q} %d\n", result, prometheus.cache[result])
+	}
+	if len(prometheus.countries) > 0 {
+		fmt.Fprintln(w, "# TYPE nano_web_requests_by_country_total counter")
+		for _, country := range sortedKeys(prometheus.countries) {
+			fmt.Fprintf(w, "nano_web_requests_by_country_total{country=%q} %d\n", country, prometheus.countries[country])
+		}
+	}
+	writeDenialMetrics(w)
+	writeMemoryCacheMetrics(w)
+	if result := selfCheckResult.Load(); result != nil {
+		fmt.Fprintln(w, "# TYPE nano_web_self_check_ok gauge")
+		fmt.Fprintf(w, "nano_web_self_check_ok %d\n", map[bool]int{true: 1, false: 0}[result.OK])
+		fmt.Fprintln(w, "# TYPE nano_web_self_check_duration_seconds gauge")
+		fmt.Fprintf(w, "nano_web_self_check_duration_seconds %g\n", result.Duration.Seconds())
+	}
+	fmt.Fprintln(w, "# TYPE nano_web_reloads_total counter")
+	fmt.Fprintf(w, "nano_web_reloads_total %d\n", prometheus.reloads)
+	fmt.Fprintln(w, "# TYPE nano_web_last_reload_duration_seconds gauge")
+	fmt.Fprintf(w, "nano_web_last_reload_duration_seconds %g\n", prometheus.reloadSeconds)
+	fmt.Fprintln(w, "# TYPE nano_web_routes gauge")
+	for _, hosts := range sortedKeys(prometheus.routes) {
+		fmt.Fprintf(w, "nano_web_routes{hosts=%q} %d\n", hosts, prometheus.routes[hosts])
+	}
+}
+
+// Sends StatsD counters and timers over UDP
+type StatsdMetrics struct {
+	conn net.Conn
+}
+
+func newStatsdMetrics(addr string) (*StatsdMetrics, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdMetrics{conn: conn}, nil
+}
+
+func (statsd *StatsdMetrics) send(format string, a ...interface{}) {
+	// Dropped packets are fine
+	fmt.Fprintf(statsd.conn, format, a...)
+}
+
+func (statsd *StatsdMetrics) ObserveRequest(metric RequestMetric) {
+	statsd.send("nano_web.requests.%d:1|c\nnano_web.response_bytes:%d|c\nnano_web.request_duration:%d|ms",
+		metric.Status, metric.Bytes, metric.Duration.Milliseconds())
+	if metric.Country != "" {
+		statsd.send("nano_web.country.%s:1|c", metric.Country)
+	}
+}
+
+func (statsd *StatsdMetrics) CacheEvent(result string, path string) {
+	statsd.send("nano_web.cache.%s:1|c", result)
+}
+
+func (statsd *StatsdMetrics) ReloadEvent(metric ReloadMetric) {
+	statsd.send("nano_web.reloads:1|c\nnano_web.reload_duration:%d|ms\nnano_web.routes:%d|g",
+		metric.Duration.Milliseconds(), metric.Routes)
+}
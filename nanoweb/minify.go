@@ -0,0 +1,40 @@
+package nanoweb
+
+import (
+	"path"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/js"
+)
+
+// MINIFY=1 minifies stylesheets and scripts as routes are populated, for
+// sites served from unbundled sources. Files already named .min. are left
+// alone, and so are files streamed from disk.
+var minifyEnabled = getEnv("MINIFY", "0") == "1"
+
+var minifier = newMinifier()
+
+func newMinifier() *minify.M {
+	m := minify.New()
+	m.AddFunc("text/css", css.Minify)
+	m.AddFunc("text/javascript", js.Minify)
+	return m
+}
+
+// Minify a file's content, or return it as is if it can't be
+func minifyContent(name string, mimetype string, content []byte) []byte {
+	if !minifyEnabled || (mimetype != "text/css" && mimetype != "text/javascript") {
+		return content
+	}
+	if strings.Contains(path.Base(name), ".min.") {
+		return content
+	}
+	minified, err := minifier.Bytes(mimetype, content)
+	if err != nil {
+		logln("⇨ not minifying", name+":", err)
+		return content
+	}
+	return minified
+}
@@ -0,0 +1,91 @@
+package nanoweb
+
+import (
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Copies a sample of requests to another origin in the background, e.g. to
+// compare a new CDN configuration against real traffic. Responses from the
+// mirror are discarded. Only the method, URL and headers are copied, without
+// credentials or cookies, and built-in /__ endpoints aren't mirrored.
+type Mirror struct {
+	Target  *url.URL
+	Percent float64
+	queue   chan *fasthttp.Request
+	client  *fasthttp.Client
+}
+
+func getMirror() *Mirror {
+	target := getEnv("MIRROR_URL", "")
+	if target == "" {
+		return nil
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Host == "" {
+		configError("invalid MIRROR_URL %q", target)
+		return nil
+	}
+	percent, err := strconv.ParseFloat(getEnv("MIRROR_PERCENT", "100"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		configError("invalid MIRROR_PERCENT %q", getEnv("MIRROR_PERCENT", ""))
+		return nil
+	}
+	mirror := &Mirror{
+		Target:  parsed,
+		Percent: percent,
+		// Requests are dropped rather than queued without bound when the
+		// mirror can't keep up
+		queue:  make(chan *fasthttp.Request, 1024),
+		client: &fasthttp.Client{ReadTimeout: 10 * time.Second, WriteTimeout: 10 * time.Second},
+	}
+	for i := 0; i < 8; i++ {
+		go mirror.send()
+	}
+	logf("⇨ mirroring %.1f%% of requests to %s\n", percent, target)
+	return mirror
+}
+
+func (mirror *Mirror) send() {
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+	for req := range mirror.queue {
+		if err := mirror.client.Do(req, res); err != nil {
+			logln("⇨ error mirroring", string(req.URI().Path()), err)
+		}
+		fasthttp.ReleaseRequest(req)
+	}
+}
+
+// Headers left out of mirrored requests: credentials for this server, and
+// the framing of a body that isn't copied
+var mirrorDroppedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Content-Length", "Transfer-Encoding"}
+
+func (mirror *Mirror) wrap(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if !strings.HasPrefix(string(ctx.Path()), "/__") && rand.Float64()*100 < mirror.Percent {
+			req := fasthttp.AcquireRequest()
+			// The header and URI only, as bodies can be large and are
+			// never needed to serve content
+			ctx.Request.Header.CopyTo(&req.Header)
+			for _, header := range mirrorDroppedHeaders {
+				req.Header.Del(header)
+			}
+			req.URI().SetScheme(mirror.Target.Scheme)
+			req.URI().SetHost(mirror.Target.Host)
+			req.UseHostHeader = true
+			req.Header.Set("X-Mirrored", "1")
+			select {
+			case mirror.queue <- req:
+			default:
+				fasthttp.ReleaseRequest(req)
+			}
+		}
+		next(ctx)
+	}
+}
@@ -0,0 +1,49 @@
+package nanoweb
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Mirrored requests don't carry credentials, cookies or bodies, and built-in
+// endpoints aren't mirrored at all
+func TestMirrorCopies(t *testing.T) {
+	target, _ := url.Parse("https://mirror.example.com")
+	mirror := &Mirror{Target: target, Percent: 100, queue: make(chan *fasthttp.Request, 2)}
+	handle := mirror.wrap(func(ctx *fasthttp.RequestCtx) {})
+
+	for _, uri := range []string{"/docs/?q=1", "/__deploy"} {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod("POST")
+		ctx.Request.SetRequestURI(uri)
+		ctx.Request.Header.Set("Authorization", "Bearer secret")
+		ctx.Request.Header.Set("Proxy-Authorization", "Basic c2VjcmV0")
+		ctx.Request.Header.SetCookie("session", "secret")
+		ctx.Request.Header.Set("Accept", "text/html")
+		ctx.Request.SetBodyString("upload")
+		handle(ctx)
+	}
+	if len(mirror.queue) != 1 {
+		t.Fatalf("%d requests mirrored, want 1", len(mirror.queue))
+	}
+	req := <-mirror.queue
+	if uri := req.URI().String(); uri != "https://mirror.example.com/docs/?q=1" {
+		t.Errorf("mirrored to %s", uri)
+	}
+	if method := string(req.Header.Method()); method != "POST" {
+		t.Errorf("method %s, want POST", method)
+	}
+	for _, header := range []string{"Authorization", "Proxy-Authorization", "Cookie"} {
+		if value := req.Header.Peek(header); len(value) > 0 {
+			t.Errorf("%s copied: %q", header, value)
+		}
+	}
+	if accept := string(req.Header.Peek("Accept")); accept != "text/html" {
+		t.Errorf("Accept %q, want text/html", accept)
+	}
+	if body := req.Body(); len(body) > 0 || req.Header.ContentLength() > 0 {
+		t.Errorf("body copied: %q, Content-Length %d", body, req.Header.ContentLength())
+	}
+}
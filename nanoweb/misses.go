@@ -0,0 +1,58 @@
+package nanoweb
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Paths known not to exist are answered before anything else, without
+// logging, so scanners and stale links can't slow down real traffic. Misses
+// are remembered per route table, so a reload forgets them, up to
+// MISS_CACHE_SIZE paths before starting over.
+var missCacheSize = getMissCacheSize()
+
+func getMissCacheSize() int {
+	size, err := strconv.Atoi(getEnv("MISS_CACHE_SIZE", "10000"))
+	if err != nil || size < 0 {
+		logln("⇨ invalid MISS_CACHE_SIZE", getEnv("MISS_CACHE_SIZE", ""))
+		return 0
+	}
+	return size
+}
+
+type missCache struct {
+	mu    sync.RWMutex
+	paths map[string]struct{}
+}
+
+func (cache *missCache) has(path string) bool {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	_, found := cache.paths[path]
+	return found
+}
+
+func (cache *missCache) add(path string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.paths == nil || len(cache.paths) >= missCacheSize {
+		cache.paths = make(map[string]struct{})
+	}
+	cache.paths[path] = struct{}{}
+}
+
+// Whether a site's misses are the same for every request. Canaries,
+// previews, A/B tests, the SPA fallback and LOCALES (through
+// Accept-Language) all depend on the visitor.
+func (site *Site) cachesMisses() bool {
+	return missCacheSize > 0 && !site.SpaMode && site.canary == nil && site.previews == nil && abTest == nil && len(locales) == 0
+}
+
+// Only plain GETs and HEADs are answered from the cache, as a query string
+// can ask for something other than the route, such as a zip download of a
+// directory that has no index
+func cacheableMiss(ctx *fasthttp.RequestCtx) bool {
+	return (ctx.IsGet() || ctx.IsHead()) && len(ctx.URI().QueryString()) == 0
+}
@@ -0,0 +1,54 @@
+package nanoweb
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestMissesNotCachedAcrossLocales(t *testing.T) {
+	previous, previousDefault := locales, defaultLocale
+	locales, defaultLocale = []string{"en", "de"}, "en"
+	t.Cleanup(func() { locales, defaultLocale = previous, previousDefault })
+	testSite(t, map[string]string{"de/about.html": "über"})
+
+	for _, test := range []struct {
+		language string
+		status   int
+	}{
+		{"en", 404},
+		{"en", 404},
+		{"de", 200},
+	} {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/about.html")
+		ctx.Request.Header.Set("Accept-Language", test.language)
+		handler(ctx)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("Accept-Language %s: status %d, want %d", test.language, status, test.status)
+		}
+	}
+}
+
+// A miss for a directory doesn't stop it being downloaded as a zip
+func TestMissesNotCachedForQueries(t *testing.T) {
+	previous := zipDownloadsEnabled
+	zipDownloadsEnabled = true
+	t.Cleanup(func() { zipDownloadsEnabled = previous })
+	testSite(t, map[string]string{"dir/a.txt": "a"})
+
+	for _, test := range []struct {
+		uri    string
+		status int
+	}{
+		{"/dir", 404},
+		{"/dir", 404},
+		{"/dir?download=zip", 200},
+		{"/dir?other=1", 404},
+		{"/dir?download=zip", 200},
+	} {
+		if status := serve(test.uri).Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.uri, status, test.status)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package nanoweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// With MMAP_FILE_SIZE, files larger than it are memory mapped instead of
+// read onto the heap, so big videos and PDFs cost the GC nothing and share
+// the page cache. Smaller files are still copied, as mapping each one costs
+// more than it saves. Responses are streamed from the mapping a buffer at a
+// time rather than copied whole into the response.
+//
+// A file truncated underneath its mapping faults when the missing pages are
+// read. Every read of a mapping goes through guardMapped, so rather than the
+// SIGBUS killing the process the response fails and its connection is
+// closed, until a reload maps the file again. Deploys that replace files or
+// directories rather than changing them in place never see this.
+var mmapFileSize = getMmapFileSize()
+
+// A mapped file, unmapped once no route or response refers to it
+type mappedFile struct {
+	source string
+	data   []byte
+}
+
+func getMmapFileSize() int64 {
+	size := getSizeLimit("MMAP_FILE_SIZE")
+	if size > 0 && !mmapSupported {
+		logln("⇨ MMAP_FILE_SIZE isn't supported on", runtime.GOOS, "so files are read into memory")
+		return 0
+	}
+	return size
+}
+
+func openMappedFile(source string) (*mappedFile, error) {
+	data, err := mmapFile(source)
+	if err != nil {
+		return nil, err
+	}
+	mapped := &mappedFile{source: source, data: data}
+	runtime.SetFinalizer(mapped, func(mapped *mappedFile) {
+		munmapFile(mapped.data)
+	})
+	return mapped, nil
+}
+
+// Whether a file should be mapped rather than read. Only files served as
+// they are on disk can be.
+func shouldMap(source string, size int64, onDisk bool) bool {
+	if mmapFileSize == 0 || size <= mmapFileSize || !onDisk || hasTransformers() {
+		return false
+	}
+	return !templateType(getMimetype(strings.ToLower(filepath.Ext(source))))
+}
+
+// A route whose content is a mapped file
+func makeMappedRoute(source string) (Route, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return Route{}, err
+	}
+	mapped, err := openMappedFile(source)
+	if err != nil {
+		return Route{}, err
+	}
+	mimetype := getMimetype(strings.ToLower(filepath.Ext(source)))
+	route := Route{
+		Content:      Content{Plain: mapped.data},
+		ContentType:  mimetype,
+		LastModified: info.ModTime().UTC().Format(http.TimeFormat),
+		mapped:       mapped,
+	}
+	route.setLengths()
+	var hash [sha256.Size]byte
+	if err := guardMapped(func() { hash = sha256.Sum256(mapped.data) }); err != nil {
+		return Route{}, err
+	}
+	route.Hash = hex.EncodeToString(hash[:])
+	if shouldCompress(source, mimetype) {
+		route.lazy = &lazyContent{plain: mapped.data}
+	}
+	return route, nil
+}
+
+// Run read over mapped memory, turning the fault of a file truncated
+// underneath its mapping into an error instead of a crash
+func guardMapped(read func()) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if _, fault := r.(interface{ Addr() uintptr }); !fault {
+				panic(r)
+			}
+			err = fmt.Errorf("mapped file changed while it was read: %v", r)
+		}
+	}()
+	read()
+	return nil
+}
+
+// Streams part of a mapping into the response, keeping the file mapped until
+// the response is written even if the route table is replaced meanwhile
+type mappedReader struct {
+	mapped *mappedFile
+	data   []byte
+}
+
+func (reader *mappedReader) Read(p []byte) (int, error) {
+	if len(reader.data) == 0 {
+		return 0, io.EOF
+	}
+	var n int
+	if err := guardMapped(func() { n = copy(p, reader.data) }); err != nil {
+		logln("⇨ error reading", reader.mapped.source, err)
+		return 0, err
+	}
+	reader.data = reader.data[n:]
+	return n, nil
+}
+
+// Set content as the response body without copying it, streaming it if it's
+// part of a mapped file
+func setBody(ctx *fasthttp.RequestCtx, mapped *mappedFile, content []byte) {
+	if mapped == nil {
+		ctx.Response.SetBodyRaw(content)
+		return
+	}
+	ctx.Response.SetBodyStream(&mappedReader{mapped: mapped, data: content}, len(content))
+}
@@ -0,0 +1,72 @@
+package nanoweb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testMmapFileSize(t *testing.T, size int64) {
+	t.Helper()
+	if !mmapSupported {
+		t.Skip("memory mapping isn't supported")
+	}
+	previous := mmapFileSize
+	mmapFileSize = size
+	t.Cleanup(func() { mmapFileSize = previous })
+}
+
+// Mapped files are streamed into responses rather than copied into them
+func TestMappedResponses(t *testing.T) {
+	testMmapFileSize(t, 16)
+	video := strings.Repeat("0123456789", 1000)
+	site := testSite(t, map[string]string{"video.mp4": video})
+	if route := site.Table().Routes["/video.mp4"]; route.mapped == nil {
+		t.Fatal("video.mp4 wasn't mapped")
+	}
+
+	ctx := serve("/video.mp4")
+	if !ctx.Response.IsBodyStream() {
+		t.Error("mapped file copied into the response")
+	}
+	if body := string(ctx.Response.Body()); body != video {
+		t.Errorf("body of %d bytes, want %d", len(body), len(video))
+	}
+
+	ctx = serveWith("/video.mp4", map[string]string{"Range": "bytes=10-19"})
+	if status := ctx.Response.StatusCode(); status != 206 {
+		t.Fatalf("range: status %d, want 206", status)
+	}
+	if !ctx.Response.IsBodyStream() {
+		t.Error("mapped range copied into the response")
+	}
+	if body := string(ctx.Response.Body()); body != "0123456789" {
+		t.Errorf("range: body %q", body)
+	}
+}
+
+// A file truncated underneath its mapping fails the response instead of
+// killing the process
+func TestMappedTruncated(t *testing.T) {
+	testMmapFileSize(t, 16)
+	source := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(source, []byte(strings.Repeat("0", 1<<16)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := openMappedFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(source, 0); err != nil {
+		t.Fatal(err)
+	}
+	reader := &mappedReader{mapped: mapped, data: mapped.data}
+	buf := make([]byte, 4096)
+	if _, err := reader.Read(buf); err == nil {
+		t.Error("read a truncated mapping without an error")
+	}
+	if _, err := makeMappedRoute(source); err == nil {
+		t.Error("mapped an empty file")
+	}
+}
@@ -0,0 +1,12 @@
+package nanoweb
+
+import "errors"
+
+// Files are always read into memory on Windows
+const mmapSupported = false
+
+func mmapFile(source string) ([]byte, error) {
+	return nil, errors.New("memory mapping isn't supported on Windows")
+}
+
+func munmapFile(data []byte) {}
@@ -0,0 +1,810 @@
+package nanoweb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/valyala/fasthttp"
+)
+
+type Route struct {
+	Content      Content
+	Hash         string
+	ContentType  string
+	LastModified string
+	Link         string
+	Headers      []Header
+	Source       string
+	// Served straight from disk instead of Content, for oversize files
+	File string
+	// Content-Length of each encoding, set when the route is built. Lazy
+	// routes' compressed lengths are only known once they're compressed.
+	PlainLen  int
+	GzipLen   int
+	BrotliLen int
+	ZstdLen   int
+
+	variants *queryVariants
+	nonced   bool
+	lazy     *lazyContent
+	// Content is the file at Source as is, so can be read back from disk
+	verbatim bool
+	// The memory mapped file Content is, kept alive with the route
+	mapped *mappedFile
+}
+
+type Routes map[string]Route
+
+// Where log lines go. Commands that write their results to stdout move it
+// to stderr.
+var logOutput io.Writer = os.Stdout
+
+func logln(a ...interface{}) {
+	fmt.Fprintln(logOutput, a...)
+}
+
+func logf(format string, a ...interface{}) {
+	fmt.Fprintf(logOutput, format, a...)
+}
+
+func getEnv(name string, fallback string) string {
+	value, exists := lookupEnv(name)
+	if !exists {
+		value = fallback
+	}
+	return value
+}
+
+func getAppEnv(prefix string) map[string]string {
+	appEnv := make(map[string]string)
+	for _, env := range environ() {
+		parts := strings.Split(env, "=")
+		key := parts[0]
+		value := strings.Join(parts[1:], "=")
+		if strings.HasPrefix(key, prefix) && injectedEnv(key) {
+			if looksSecret(key) {
+				logln("⇨ warning:", key, "looks like a secret but is public in every page, leave it out with CONFIG_EXCLUDE")
+			}
+			appEnv[strings.Replace(key, prefix, "", 1)] = value
+		}
+	}
+	return appEnv
+}
+
+func getMimetype(ext string) string {
+	switch ext {
+	case ".html":
+		return "text/html"
+	case ".css":
+		return "text/css"
+	case ".js":
+		return "text/javascript"
+	case ".json":
+		return "application/json"
+	case ".xml":
+		return "application/xml"
+	case ".pdf":
+		return "application/pdf"
+	case ".zip":
+		return "application/zip"
+	case ".doc":
+		return "application/msword"
+	case ".eot":
+		return "application/vnd.ms-fontobject"
+	case ".otf":
+		return "font/otf"
+	case ".ttf":
+		return "font/ttf"
+	case ".woff":
+		return "font/woff"
+	case ".woff2":
+		return "font/woff2"
+	case ".gif":
+		return "image/gif"
+	case ".jpeg":
+		return "image/jpeg"
+	case ".jpg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".svg":
+		return "image/svg+xml"
+	case ".ico":
+		return "image/x-icon"
+	case ".webp":
+		return "image/webp"
+	case ".mp4":
+		return "video/mp4"
+	case ".webm":
+		return "video/webm"
+	case ".wav":
+		return "audio/wav"
+	case ".mp3":
+		return "audio/mpeg"
+	case ".m4a":
+		return "audio/mp4"
+	case ".aac":
+		return "audio/aac"
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".mpd":
+		return "application/dash+xml"
+	case ".ts":
+		return "video/mp2t"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".ogg":
+		return "audio/ogg"
+	case ".csv":
+		return "text/csv"
+	case ".txt":
+		return "text/plain"
+	case ".wasm":
+		return "application/wasm"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+type TemplateData struct {
+	Env         map[string]string      `json:"env"`
+	Json        string                 `json:"json"`
+	EscapedJson string                 `json:"escapedJson"`
+	Data        map[string]interface{} `json:"data"`
+	Bucket      string                 `json:"bucket"`
+	Query       map[string]string      `json:"query"`
+	Nonce       string                 `json:"nonce"`
+}
+
+type Content struct {
+	Plain  []byte
+	Gzip   []byte
+	Brotli []byte
+	// Only from a precompressed copy
+	Zstd []byte
+}
+
+func templateRoute(name string, content string, appEnv map[string]string, query map[string]string) (string, error) {
+	writer := bytes.NewBufferString("")
+	tmpl, err := template.New(name).Parse(content)
+	if err != nil {
+		return "", err
+	}
+	jsonString, err := json.Marshal(appEnv)
+	if err != nil {
+		return "", err
+	}
+	err = tmpl.Execute(writer, &TemplateData{
+		Env:         appEnv,
+		Json:        string(jsonString),
+		EscapedJson: strings.Replace(string(jsonString), "\"", "\\\"", -1),
+		Data:        getTemplateData(),
+		Bucket:      abTest.bucketFor(name),
+		Query:       query,
+		Nonce:       nonceMarker,
+	})
+	if err != nil {
+		return "", err
+	}
+	return writer.String(), nil
+}
+
+func templateType(mimetype string) bool {
+	switch mimetype {
+	case "text/html", "text/css", "text/javascript", "application/json":
+		return true
+	default:
+		return false
+	}
+}
+
+func compressedType(mimetype string) bool {
+	if compress, ok := compressionOverrides[mimetype]; ok {
+		return compress
+	}
+	switch mimetype {
+	case "text/html", "text/css", "text/javascript", "application/json":
+		return true
+	default:
+		return false
+	}
+}
+
+func gzipData(dat []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(dat)
+	w.Close()
+	return b.Bytes()
+}
+
+func brotliData(dat []byte) []byte {
+	var b bytes.Buffer
+	w := brotli.NewWriter(&b)
+	w.Write(dat)
+	w.Close()
+	return b.Bytes()
+
+}
+
+func makeRoute(fsys fs.FS, name string, urlPath string, appEnv map[string]string, assets *AssetManifest) (Route, error) {
+	mimetype := getMimetype(strings.ToLower(path.Ext(name)))
+	dat, err := fs.ReadFile(fsys, name)
+
+	if err != nil {
+		return Route{}, err
+	}
+
+	info, err := fs.Stat(fsys, name)
+
+	if err != nil {
+		return Route{}, err
+	}
+
+	source := dat
+	render := func(query map[string]string) ([]byte, bool, error) {
+		dat := source
+		templated := false
+		if templateType(mimetype) {
+			content, err := templateRoute(name, string(dat), appEnv, query)
+			if err != nil {
+				return nil, false, err
+			}
+			templated = content != string(dat)
+			dat = []byte(content)
+		}
+		if minified := minifyContent(name, mimetype, dat); !bytes.Equal(minified, dat) {
+			templated = true
+			dat = minified
+		}
+		if rewritten := assets.rewrite(urlPath, mimetype, dat); !bytes.Equal(rewritten, dat) {
+			templated = true
+			dat = rewritten
+		}
+		if hasTransformers() {
+			transformed, err := transformContent(urlPath, mimetype, dat)
+			if err != nil {
+				return nil, false, err
+			}
+			templated = templated || !bytes.Equal(transformed, dat)
+			dat = transformed
+		}
+		return dat, templated, nil
+	}
+	dat, templated, err := render(queryValues(nil))
+	if err != nil {
+		return Route{}, err
+	}
+
+	compress := shouldCompress(name, mimetype)
+	if precompressedEnabled && !templated && compress {
+		gzip := readPrecompressed(fsys, name+".gz", info.ModTime())
+		brotli := readPrecompressed(fsys, name+".br", info.ModTime())
+		zstd := readPrecompressed(fsys, name+".zst", info.ModTime())
+		if gzip != nil || brotli != nil || zstd != nil {
+			route := makeCompressedRoute(dat, mimetype, info.ModTime(), false)
+			route.Content.Gzip = gzip
+			route.Content.Brotli = brotli
+			route.Content.Zstd = zstd
+			route.setLengths()
+			route.verbatim = true
+			return route, nil
+		}
+	}
+
+	route := makeCompressedRoute(dat, mimetype, info.ModTime(), compress)
+	route.nonced = mimetype == "text/html" && hasNonce(dat)
+	route.verbatim = !templated
+	if variesOnQuery(mimetype, string(source)) {
+		route.variants = &queryVariants{render: func(query map[string]string) (Route, error) {
+			dat, _, err := render(query)
+			if err != nil {
+				return Route{}, err
+			}
+			variant := makeCompressedRoute(dat, mimetype, info.ModTime(), compress)
+			variant.nonced = hasNonce(dat)
+			return variant, nil
+		}}
+	}
+	return route, nil
+}
+
+// Build a route from in-memory content, compressing it where appropriate
+func makeContentRoute(dat []byte, mimetype string, modTime time.Time) Route {
+	return makeCompressedRoute(dat, mimetype, modTime, compressedType(mimetype))
+}
+
+func makeCompressedRoute(dat []byte, mimetype string, modTime time.Time, compress bool) Route {
+	content := Content{
+		Plain: dat,
+	}
+
+	var lazy *lazyContent
+	if compress && lazyCompression {
+		lazy = &lazyContent{plain: dat}
+	} else if compress {
+		content.Gzip = gzipData(dat)
+		content.Brotli = brotliData(dat)
+	}
+
+	hash := sha256.Sum256(dat)
+	route := Route{
+		Content:      content,
+		Hash:         hex.EncodeToString(hash[:]),
+		ContentType:  mimetype,
+		LastModified: modTime.UTC().Format(http.TimeFormat),
+		lazy:         lazy,
+	}
+	route.setLengths()
+	return route
+}
+
+// Record the length of each encoding in Content
+func (route *Route) setLengths() {
+	route.PlainLen = len(route.Content.Plain)
+	route.GzipLen = len(route.Content.Gzip)
+	route.BrotliLen = len(route.Content.Brotli)
+	route.ZstdLen = len(route.Content.Zstd)
+}
+
+// Walk the site's public dir (or file system) and mounted dirs and create
+// routes for each file
+func populateRoutes(site *Site, table *RouteTable, publicDir string) {
+	headersFile := site.getHeadersFile(publicDir)
+	headerRules, err := loadHeaderRules(headersFile)
+	if err != nil {
+		table.populateError("loading headers file %s: %s", headersFile, err)
+	}
+	fsys := site.FS
+	if fsys == nil {
+		if err := checkDir(publicDir); err != nil {
+			table.unservable = err
+			table.populateError("%s", err)
+			return
+		}
+		fsys = os.DirFS(publicDir)
+	}
+	if table.Redirects, err = loadRedirectRules(fsys, publicDir); err != nil {
+		table.populateError("loading redirects: %s", err)
+	}
+	assets, manifestFile, err := loadAssetManifest(fsys)
+	if err != nil {
+		table.populateError("loading asset manifest %s: %s", manifestFile, err)
+	}
+	populateFS(site, table, headerRules, headersFile, assets, fsys, "", publicDir)
+	for _, mount := range site.Mounts {
+		if err := checkDir(mount.Dir); err != nil {
+			table.unservable = err
+			table.populateError("%s", err)
+			continue
+		}
+		populateFS(site, table, headerRules, headersFile, assets, os.DirFS(mount.Dir), mount.Prefix, mount.Dir)
+	}
+	reportLargestRoutes(table)
+}
+
+func checkDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err == nil && !info.IsDir() {
+		return fmt.Errorf("public directory %s isn't a directory", dir)
+	}
+	if err != nil {
+		cwd, _ := os.Getwd()
+		return fmt.Errorf("public directory %s not found in: %s", dir, cwd)
+	}
+	return nil
+}
+
+// Walk a file system and create routes for each file below the URL prefix.
+// Routes record their source as a path under sourceDir.
+func populateFS(site *Site, table *RouteTable, headerRules []HeaderRule, headersFile string, assets *AssetManifest, fsys fs.FS, prefix string, sourceDir string) {
+	routes := table.Routes
+	ignoreRules := loadIgnoreRules(fsys)
+	configMap := isConfigMapFS(fsys)
+	fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			table.populateError("reading %s: %s", name, err)
+			return nil
+		}
+		if configMap && strings.HasPrefix(name, "..") {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		source := filepath.Join(sourceDir, filepath.FromSlash(name))
+		if entry.IsDir() {
+			if name != "." && (excludedDir(path.Join("/", prefix, name)) || hiddenPath(path.Join("/", prefix, name), true) || ignored(ignoreRules, name, true)) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if (site.FS == nil || prefix != "") && escapesRoot(sourceDir, source, entry) {
+			table.populateError("skipping %s, a symlink outside %s", name, sourceDir)
+			return nil
+		}
+		if filepath.Clean(source) == filepath.Clean(headersFile) || (prefix == "" && name == redirectsFile) || excludedFile(path.Join("/", prefix, name)) || hiddenPath(path.Join("/", prefix, name), false) || excludedSourceMap(name) || ignored(ignoreRules, name, false) {
+			return nil
+		}
+		if precompressedEnabled && isPrecompressed(fsys, name) {
+			return nil
+		}
+		// fs.FS names are always slash separated, whatever the OS
+		urlPath := path.Join("/", prefix, name)
+
+		// Stat follows symlinks, such as the files of a ConfigMap volume
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			table.populateError("reading %s: %s", name, err)
+			return nil
+		}
+		onDisk := site.FS == nil || prefix != ""
+		// Mapped files aren't on the heap, so don't count towards the limits
+		var route Route
+		mapped := false
+		if shouldMap(source, info.Size(), onDisk) {
+			if route, err = makeMappedRoute(source); err == nil {
+				logln("⇨ mapping", source, "into memory,", info.Size(), "bytes")
+				mapped = true
+			} else {
+				logln("⇨ couldn't map", source+", reading it instead:", err)
+			}
+		}
+		if !mapped {
+			var streamed, ok bool
+			route, streamed, ok = table.checkSize(site, source, info.Size(), onDisk)
+			if !ok {
+				return nil
+			}
+			if !streamed {
+				route, err = makeRoute(fsys, name, urlPath, site.AppEnv, assets)
+			}
+		}
+
+		if err != nil {
+			table.populateError("making route for %s: %s", urlPath, err)
+			return nil
+		}
+		route.Source = source
+		// Only files from disk can be read back
+		route.verbatim = route.verbatim && (site.FS == nil || prefix != "")
+
+		if earlyHintsEnabled && route.ContentType == "text/html" {
+			route.Link = preloadLinks(urlPath, route.Content.Plain)
+		}
+		applyHeaderRules(headerRules, urlPath, &route)
+		applyDownloadRules(urlPath, &route)
+		assets.apply(urlPath, &route)
+
+		documentPath := urlPath
+		if entry.Name() == "index.html" {
+			documentPath = strings.TrimSuffix(path.Dir(urlPath), "/") + "/"
+		}
+		if searchEnabled && route.ContentType == "text/html" {
+			table.Search.add(documentPath, route.Content.Plain)
+		}
+		if !table.admit(route) {
+			route = diskRoute(route)
+		}
+
+		routes[urlPath] = route
+		if entry.Name() == "index.html" {
+			indexUrlPath := path.Dir(urlPath)
+			logln("⇨ adding index", indexUrlPath, "→", source)
+			routes[indexUrlPath] = route
+			routes[documentPath] = route
+		}
+		logln("⇨ adding route", urlPath, "→", source)
+
+		return nil
+	})
+}
+
+func getAcceptedEncoding(ctx *fasthttp.RequestCtx) string {
+	acceptEncoding := string(ctx.Request.Header.Peek("Accept-Encoding"))
+	if strings.Contains(acceptEncoding, "br") {
+		return "br"
+	}
+	if strings.Contains(acceptEncoding, "gzip") {
+		return "gzip"
+	}
+	return ""
+}
+
+func getEncodedContent(acceptedEncoding string, content Content) (string, []byte) {
+	switch acceptedEncoding {
+	case "br":
+		if content.Brotli != nil {
+			return "br", content.Brotli
+		} else {
+			return "", content.Plain
+		}
+	case "gzip":
+		if content.Gzip != nil {
+			return "gzip", content.Gzip
+		} else {
+			return "", content.Plain
+		}
+	case "zstd":
+		if content.Zstd != nil {
+			return "zstd", content.Zstd
+		} else {
+			return "", content.Plain
+		}
+	default:
+		return "", content.Plain
+	}
+}
+
+func handler(ctx *fasthttp.RequestCtx) {
+	if !validPath(ctx) {
+		ctx.Error("Bad Request", fasthttp.StatusBadRequest)
+		auditDenied(ctx, "invalid_path")
+		return
+	}
+	if basicAuth != nil && !skipsBasicAuth(string(ctx.Path())) && !basicAuth.Authorized(ctx) {
+		basicAuth.challenge(ctx)
+		return
+	}
+	site := siteForHost(string(ctx.Host()))
+	if site.cachesMisses() && cacheableMiss(ctx) && site.Table().misses.has(string(ctx.Path())) {
+		metrics.CacheEvent("miss", string(ctx.Path()))
+		notFound(ctx, site.Table().Routes)
+		return
+	}
+	// ECS access logs are written once the response is ready
+	if accessLogFormat != "ecs" {
+		if geo, ok := requestGeo(ctx); ok {
+			logln("⇨ request", string(ctx.Path()), geo)
+		} else {
+			logln("⇨ request", string(ctx.Path()))
+		}
+	}
+	table := site.Table()
+	if site.canary != nil {
+		table = site.canary.Assign(ctx, table)
+	}
+	if site.previews != nil {
+		table = site.previews.Select(ctx, site, table)
+	}
+	routes := table.Routes
+	path := string(ctx.Path())
+	if searchEnabled && path == searchPath {
+		searchHandler(ctx, table.Search)
+		return
+	}
+	if adminAddr == "" && builtinHandler(ctx, site, table, path) {
+		return
+	}
+	if reportsEnabled && path == reportsPath {
+		reportsHandler(ctx)
+		return
+	}
+	if webdavEnabled {
+		switch string(ctx.Method()) {
+		case "OPTIONS":
+			// CORS preflights are answered like any other OPTIONS request
+			if len(ctx.Request.Header.Peek("Access-Control-Request-Method")) == 0 {
+				webdavOptions(ctx)
+				return
+			}
+		case "PROPFIND":
+			propfindHandler(ctx, routes, path)
+			return
+		}
+	}
+	if isZipRequest(ctx) {
+		zipHandler(ctx, routes, path)
+		return
+	}
+	if trailingSlash != "ignore" && redirectTrailingSlash(ctx, routes, path) {
+		return
+	}
+	if len(locales) > 0 {
+		if localized, ok := localizedPath(ctx, routes, path); ok {
+			if redirectsLocale(path) {
+				if query := ctx.URI().QueryString(); len(query) > 0 {
+					localized += "?" + string(query)
+				}
+				ctx.Redirect(localized, fasthttp.StatusFound)
+				return
+			}
+			path = localized
+		}
+	}
+	route, exists := routes[path]
+	versioned := exists && hasVersionQuery(ctx)
+	if abTest != nil {
+		route, exists = abTest.Select(ctx, routes, path, route, exists)
+	}
+	if exists && !sourceMapAllowed(ctx, path) {
+		metrics.CacheEvent("miss", path)
+		notFound(ctx, routes)
+		auditDenied(ctx, "source_map")
+		return
+	}
+	if !exists && redirectRules(ctx, table.Redirects, path) {
+		return
+	}
+	if !exists {
+		if site.SpaMode {
+			route, exists = routes["/"]
+			if !exists {
+				metrics.CacheEvent("miss", path)
+				notFound(ctx, routes)
+				return
+			}
+			metrics.CacheEvent("fallback", path)
+		} else {
+			if site.cachesMisses() && cacheableMiss(ctx) && path == string(ctx.Path()) {
+				table.misses.add(path)
+			}
+			metrics.CacheEvent("miss", path)
+			notFound(ctx, routes)
+			return
+		}
+	} else {
+		metrics.CacheEvent("hit", path)
+		recordRouteStats(path)
+	}
+	if !allowMethod(ctx, route) {
+		return
+	}
+	if route.variants != nil {
+		route = route.variants.Select(ctx, route)
+	}
+	site.memory.record(route)
+
+	ctx.Response.Header.Set("Content-Type", contentTypeHeader(route.ContentType))
+	ctx.Response.Header.Set("Server", "nano-web")
+	ctx.Response.Header.Set("Last-Modified", route.LastModified)
+	ctx.Response.Header.Set("X-Deploy-Id", table.DeployID)
+	if route.Link != "" {
+		if earlyHintsEnabled {
+			sendEarlyHints(ctx, route.Link)
+		}
+		ctx.Response.Header.Set("Link", route.Link)
+	}
+	for _, header := range route.Headers {
+		ctx.Response.Header.Add(header.Key, header.Value)
+	}
+	if versioned {
+		ctx.Response.Header.Set("Cache-Control", immutableCacheControl)
+	}
+	if crossOriginIsolated {
+		setCrossOriginIsolationHeaders(ctx)
+	}
+	if isStaging() {
+		ctx.Response.Header.Set("X-Robots-Tag", "noindex, nofollow")
+	}
+	streaming := streamingEnabled && streamingType(route.ContentType)
+	if streaming {
+		setStreamingHeaders(ctx)
+	}
+	if cspPolicy != "" && route.ContentType == "text/html" {
+		nonce := setCSP(ctx)
+		if route.nonced {
+			serveNonced(ctx, route, nonce)
+			return
+		}
+	}
+	if route.File != "" {
+		etag := routeETag(route, "")
+		ctx.Response.Header.Set("ETag", etag)
+		if notModified(ctx, etag, route.LastModified) {
+			sendNotModified(ctx)
+			return
+		}
+		serveFile(ctx, route.File, etag, route.LastModified)
+		return
+	}
+	acceptedEncoding := routeEncoding(ctx, route)
+	encoding, content := route.encodedContent(acceptedEncoding)
+	if route.compressed() {
+		ctx.Response.Header.Add("Vary", "Accept-Encoding")
+	}
+	etag := routeETag(route, encoding)
+	ctx.Response.Header.Set("ETag", etag)
+	if notModified(ctx, etag, route.LastModified) {
+		sendNotModified(ctx)
+		return
+	}
+	if encoding != "" {
+		ctx.Response.Header.Set("Content-Encoding", encoding)
+	}
+	if encoding == "" {
+		ctx.Response.Header.Set("Accept-Ranges", "bytes")
+	}
+	// The length of the negotiated encoding, also for HEAD
+	ctx.Response.Header.SetContentLength(route.encodedLength(encoding))
+	if ctx.IsHead() {
+		ctx.Response.SkipBody = true
+		return
+	}
+	// Only the plain content can be mapped, compressed copies are on the heap
+	mapped := route.mapped
+	if encoding != "" {
+		mapped = nil
+	}
+	if encoding == "" && serveRange(ctx, len(content), etag, route.LastModified, func(start int, end int) {
+		setBody(ctx, mapped, content[start:end+1])
+	}) {
+		return
+	}
+	setBody(ctx, mapped, content)
+}
+
+// Built-in endpoints left out of BASIC_AUTH: the health check, for container
+// and load balancer probes that don't have the password, and those that check
+// a token or signature of their own, so deploy tools and webhooks needn't
+// know it either
+func skipsBasicAuth(path string) bool {
+	if adminAddr != "" {
+		return false
+	}
+	switch {
+	case healthEnabled && path == healthPath:
+	case adminToken != "" && (path == reloadPath || isRoutesPath(path)):
+	case gitSource != nil && path == gitWebhookPath:
+	case deployer != nil && isDeployPath(path):
+	case defaultSite.slots != nil && isSlotsPath(path):
+	default:
+		return false
+	}
+	return true
+}
+
+// Serve the built-in operational endpoints, returning false if the path
+// isn't one. They're served by the admin listener instead when there is one.
+func builtinHandler(ctx *fasthttp.RequestCtx, site *Site, table *RouteTable, path string) bool {
+	switch {
+	case versionEnabled && path == versionPath:
+		versionHandler(ctx)
+		return true
+	case manifestEnabled && path == manifestPath:
+		manifestHandler(ctx, table)
+		return true
+	case path == metricsPath && isPrometheus():
+		metrics.(*PrometheusMetrics).handler(ctx)
+		return true
+	case healthEnabled && path == healthPath:
+		healthHandler(ctx)
+		return true
+	case adminToken != "" && path == reloadPath:
+		reloadHandler(ctx)
+		return true
+	case adminToken != "" && isRoutesPath(path):
+		routesHandler(ctx, site)
+		return true
+	case statsEnabled && path == statsPath:
+		statsHandler(ctx)
+		return true
+	case statsEnabled && path == dashboardPath:
+		dashboardHandler(ctx)
+		return true
+	case gitSource != nil && path == gitWebhookPath:
+		gitSource.webhookHandler(ctx)
+		return true
+	case deployer != nil && isDeployPath(path):
+		deployer.handler(ctx, defaultSite)
+		return true
+	case defaultSite.slots != nil && isSlotsPath(path):
+		defaultSite.slots.handler(ctx, defaultSite)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package nanoweb
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var separatorFiles = map[string]string{
+	"index.html":              "home",
+	"docs/index.html":         "docs",
+	"docs/guide/intro.html":   "intro",
+	"a b/c.html":              "spaced",
+	"assets/js/app.bundle.js": "app",
+}
+
+var separatorRoutes = []string{
+	"/", "/a b/c.html", "/assets/js/app.bundle.js", "/docs", "/docs/", "/docs/guide/intro.html", "/docs/index.html", "/index.html",
+}
+
+func routeKeys(routes Routes) []string {
+	keys := make([]string, 0, len(routes))
+	for key := range routes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// URL paths come out the same however the public dir is written, and never
+// with the OS separator
+func TestPopulateURLPathsFromPublicDirForms(t *testing.T) {
+	site := testSite(t, separatorFiles)
+	dir := site.PublicDir
+	sep := string(filepath.Separator)
+	forms := map[string]string{
+		"as is":              dir,
+		"trailing separator": dir + sep,
+		"trailing slash":     dir + "/",
+		"dot segments":       dir + sep + "." + sep + "docs" + sep + ".." + sep,
+		"slashes":            filepath.ToSlash(dir),
+		"OS separators":      filepath.FromSlash(dir),
+	}
+	// Backslashes only separate directories on Windows. Elsewhere they're
+	// part of a file name, as below.
+	if runtime.GOOS == "windows" {
+		forms["backslashes"] = strings.ReplaceAll(dir, "/", `\`) + `\docs\..\`
+		forms["mixed"] = filepath.ToSlash(dir) + `\.\docs/..\`
+	}
+	for form, publicDir := range forms {
+		table := site.Build(publicDir)
+		keys := routeKeys(table.Routes)
+		if strings.Join(keys, ",") != strings.Join(separatorRoutes, ",") {
+			t.Errorf("%s %q: routes %v, want %v", form, publicDir, keys, separatorRoutes)
+		}
+		for urlPath, route := range table.Routes {
+			if strings.Contains(urlPath, `\`) {
+				t.Errorf("%s: route %q has a backslash", form, urlPath)
+			}
+			want := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(urlPath, "/")))
+			// Directory indexes
+			if path.Ext(urlPath) == "" {
+				want = filepath.Join(want, "index.html")
+			}
+			if filepath.Clean(route.Source) != want {
+				t.Errorf("%s: route %q from %q, want %q", form, urlPath, route.Source, want)
+			}
+		}
+	}
+}
+
+// Backslashes in requests aren't separators, so never find a file by
+// another name, and can't climb out of the root
+func TestLookupWithBackslashes(t *testing.T) {
+	testSite(t, separatorFiles)
+	tests := []struct {
+		uri    string
+		status int
+		body   string
+	}{
+		{"/docs/guide/intro.html", 200, "intro"},
+		{"/docs//guide/./intro.html", 200, "intro"},
+		{"/docs/guide/../guide/intro.html", 200, "intro"},
+		{"/a%20b/c.html", 200, "spaced"},
+		{`/docs\guide\intro.html`, 404, ""},
+		{"/docs%5Cguide%5Cintro.html", 404, ""},
+		{`/docs/guide\intro.html`, 404, ""},
+		{`/docs\guide/intro.html`, 404, ""},
+		{`\docs/index.html`, 404, ""},
+		{`/assets\js/app.bundle.js`, 404, ""},
+		{`/docs\..\index.html`, 404, ""},
+		{`/..\index.html`, 400, ""},
+		{"/%5C..%5C..%5Csecret", 400, ""},
+		{`/docs/..\..\secret`, 400, ""},
+	}
+	for _, test := range tests {
+		ctx := serve(test.uri)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.uri, status, test.status)
+			continue
+		}
+		if test.body != "" && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s: body %q, want %q", test.uri, ctx.Response.Body(), test.body)
+		}
+	}
+}
+
+// Where a backslash can be part of a file name, it stays part of the route
+func TestPopulateBackslashInFileName(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("backslashes separate directories on Windows")
+	}
+	site := testSite(t, map[string]string{"index.html": "home"})
+	if err := os.WriteFile(filepath.Join(site.PublicDir, `odd\name.html`), []byte("odd"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	routes := site.Build(site.PublicDir).Routes
+	if _, exists := routes[`/odd\name.html`]; !exists {
+		t.Errorf("routes %v, want /odd\\name.html", routeKeys(routes))
+	}
+	if _, exists := routes["/odd/name.html"]; exists {
+		t.Error("backslash in a file name treated as a separator")
+	}
+}
+
+// Content-Length comes from the lengths stored when the route was built, the
+// same for HEAD as GET
+func TestContentLengthPerEncoding(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		previous := lazyCompression
+		lazyCompression = lazy
+		site := testSite(t, map[string]string{"app.js": strings.Repeat("console.log('hello');\n", 100)})
+		lazyCompression = previous
+
+		route := site.Table().Routes["/app.js"]
+		if route.PlainLen != len(route.Content.Plain) {
+			t.Errorf("lazy %v: PlainLen %d, want %d", lazy, route.PlainLen, len(route.Content.Plain))
+		}
+		if !lazy && (route.GzipLen != len(route.Content.Gzip) || route.BrotliLen != len(route.Content.Brotli)) {
+			t.Errorf("GzipLen %d and BrotliLen %d, want %d and %d", route.GzipLen, route.BrotliLen, len(route.Content.Gzip), len(route.Content.Brotli))
+		}
+		for _, encoding := range []string{"", "gzip", "br"} {
+			get := &fasthttp.RequestCtx{}
+			get.Request.SetRequestURI("/app.js")
+			get.Request.Header.Set("Accept-Encoding", encoding)
+			handler(get)
+			head := &fasthttp.RequestCtx{}
+			head.Request.SetRequestURI("/app.js")
+			head.Request.Header.SetMethod(fasthttp.MethodHead)
+			head.Request.Header.Set("Accept-Encoding", encoding)
+			handler(head)
+
+			want := route.encodedLength(encoding)
+			if length := get.Response.Header.ContentLength(); length != want || length != len(get.Response.Body()) {
+				t.Errorf("lazy %v, %q: GET Content-Length %d for a %d byte body, want %d", lazy, encoding, length, len(get.Response.Body()), want)
+			}
+			if length := head.Response.Header.ContentLength(); length != want {
+				t.Errorf("lazy %v, %q: HEAD Content-Length %d, want %d", lazy, encoding, length, want)
+			}
+			if len(head.Response.Body()) != 0 {
+				t.Errorf("lazy %v, %q: HEAD has a body", lazy, encoding)
+			}
+		}
+	}
+}
+
+// Conditional requests are answered with 304 when the validators match, with
+// If-None-Match taking precedence over If-Modified-Since
+func TestConditionalRequests(t *testing.T) {
+	site := testSite(t, map[string]string{"app.js": strings.Repeat("console.log('hello');\n", 100)})
+	route := site.Table().Routes["/app.js"]
+	etag := routeETag(route, "")
+	gzipETag := routeETag(route, "gzip")
+	modified, err := fasthttp.ParseHTTPDate([]byte(route.LastModified))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := fasthttp.AppendHTTPDate(nil, modified.Add(-time.Hour))
+	after := fasthttp.AppendHTTPDate(nil, modified.Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		status  int
+	}{
+		{"unconditional", "GET", nil, 200},
+		{"matching tag", "GET", map[string]string{"If-None-Match": etag}, 304},
+		{"weak tag", "GET", map[string]string{"If-None-Match": "W/" + etag}, 304},
+		{"tag in a list", "GET", map[string]string{"If-None-Match": `"other", ` + etag}, 304},
+		{"any tag", "GET", map[string]string{"If-None-Match": "*"}, 304},
+		{"other tag", "GET", map[string]string{"If-None-Match": `"other"`}, 200},
+		{"unquoted tag", "GET", map[string]string{"If-None-Match": route.Hash}, 200},
+		{"HEAD matching tag", "HEAD", map[string]string{"If-None-Match": etag}, 304},
+		{"gzip tag for plain", "GET", map[string]string{"If-None-Match": gzipETag}, 200},
+		{"gzip tag for gzip", "GET", map[string]string{"If-None-Match": gzipETag, "Accept-Encoding": "gzip"}, 304},
+		{"plain tag for gzip", "GET", map[string]string{"If-None-Match": etag, "Accept-Encoding": "gzip"}, 200},
+		{"not modified since", "GET", map[string]string{"If-Modified-Since": route.LastModified}, 304},
+		{"not modified since later", "GET", map[string]string{"If-Modified-Since": string(after)}, 304},
+		{"modified since", "GET", map[string]string{"If-Modified-Since": string(before)}, 200},
+		{"invalid date", "GET", map[string]string{"If-Modified-Since": "yesterday"}, 200},
+		{"tag wins over date", "GET", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": string(after)}, 200},
+		{"matching tag, old date", "GET", map[string]string{"If-None-Match": etag, "If-Modified-Since": string(before)}, 304},
+	}
+	for _, test := range tests {
+		ctx := serveMethod(test.method, "/app.js", test.headers)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, status, test.status)
+			continue
+		}
+		if test.status == 304 {
+			if len(ctx.Response.Body()) != 0 {
+				t.Errorf("%s: 304 with a body", test.name)
+			}
+			if sent := string(ctx.Response.Header.Peek("ETag")); sent == "" {
+				t.Errorf("%s: 304 without an ETag", test.name)
+			}
+		}
+	}
+}
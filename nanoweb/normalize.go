@@ -0,0 +1,32 @@
+package nanoweb
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Routes are looked up by ctx.Path, which fasthttp has already decoded and
+// normalized: percent-encoding, duplicate slashes and dot segments. Paths it
+// would have to clamp to the root, like /../etc/passwd, are rejected instead,
+// along with NUL bytes and invalid percent-encoding.
+func validPath(ctx *fasthttp.RequestCtx) bool {
+	decoded, err := url.PathUnescape(string(ctx.URI().PathOriginal()))
+	if err != nil || strings.ContainsRune(decoded, 0) {
+		return false
+	}
+	depth := 0
+	for _, segment := range strings.FieldsFunc(decoded, func(r rune) bool { return r == '/' || r == '\\' }) {
+		switch segment {
+		case ".":
+		case "..":
+			if depth--; depth < 0 {
+				return false
+			}
+		default:
+			depth++
+		}
+	}
+	return true
+}
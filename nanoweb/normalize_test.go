@@ -0,0 +1,126 @@
+package nanoweb
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestValidPath(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{"/", true},
+		{"/index.html", true},
+		{"/a//b", true},
+		{"/a/./b", true},
+		{"/a/b/../c", true},
+		{"/a/..", true},
+		{"/caf%C3%A9.html", true},
+		{"/a%2Fb", true},
+		{"/a.", true},
+		{"/a/.", true},
+		{"/..", false},
+		{"/../etc/passwd", false},
+		{"/a/../../etc/passwd", false},
+		{"/%2e%2e/etc/passwd", false},
+		{"/%2E%2E%2Fetc%2Fpasswd", false},
+		{"/a%2F..%2F..%2Fx", false},
+		{`/..\x`, false},
+		{"/a%5C..%5C..%5Cx", false},
+		{"/%00", false},
+		{"/a%00.html", false},
+		{"/a%ZZ", false},
+		{"/a%", false},
+	}
+	for _, test := range tests {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(test.uri)
+		if valid := validPath(ctx); valid != test.valid {
+			t.Errorf("%s: valid %v, want %v", test.uri, valid, test.valid)
+		}
+	}
+}
+
+// Requests are decoded and normalized before the route lookup
+func TestLookupNormalizedPaths(t *testing.T) {
+	testSite(t, map[string]string{
+		"café.html":      "café",
+		"a/b.html":       "b",
+		"a/index.html":   "a",
+		"100% real.html": "real",
+	})
+	tests := []struct {
+		uri    string
+		status int
+		body   string
+	}{
+		{"/caf%C3%A9.html", 200, "café"},
+		{"/caf%c3%a9.html", 200, "café"},
+		{"/a//b.html", 200, "b"},
+		{"/a///b.html", 200, "b"},
+		{"/a/./b.html", 200, "b"},
+		{"/x/../a/b.html", 200, "b"},
+		{"/a%2Fb.html", 200, "b"},
+		{"/a%2fb.html", 200, "b"},
+		{"/100%25%20real.html", 200, "real"},
+		{"/a/b.html.", 404, ""},
+		{"/a/b.html..", 404, ""},
+		{"/a./b.html", 404, ""},
+		{"/../a/b.html", 400, ""},
+		{"/%2e%2e/a/b.html", 400, ""},
+		{"/a%2F..%2F..%2Fa/b.html", 400, ""},
+		{"/a/b%00.html", 400, ""},
+		{"/caf%C3.html", 404, ""},
+		{"/a%ZZ", 400, ""},
+	}
+	for _, test := range tests {
+		ctx := serve(test.uri)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.uri, status, test.status)
+			continue
+		}
+		if test.body != "" && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s: body %q, want %q", test.uri, ctx.Response.Body(), test.body)
+		}
+	}
+}
+
+func FuzzValidPath(f *testing.F) {
+	for _, seed := range []string{
+		"/", "/index.html", "/a/b/../c", "/../etc/passwd", "/a/../../etc/passwd", "/%2e%2e/etc/passwd",
+		"/%2e%2e%2fetc%2fpasswd", "/a/%2e%2e/%2e%2e/x", `/..\..\windows`, "/a%5c..%5c..%5cx", "//etc/passwd",
+		"/a/./b", "/%00", "/a%ZZ", "/%252e%252e/x", "/a?b=../../x", "/a#../../x", "http://host/../x",
+	} {
+		f.Add(seed)
+	}
+	root := f.TempDir()
+	f.Fuzz(func(t *testing.T, uri string) {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(uri)
+		if !validPath(ctx) {
+			return
+		}
+		urlPath := string(ctx.Path())
+		if strings.ContainsRune(urlPath, 0) {
+			t.Fatalf("%q: accepted a NUL byte in %q", uri, urlPath)
+		}
+		// Backslashes separate directories on Windows
+		relative := strings.TrimPrefix(strings.ReplaceAll(urlPath, `\`, "/"), "/")
+		if cleaned := path.Clean(relative); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			t.Fatalf("%q: accepted a path that climbs above the root, %q", uri, urlPath)
+		}
+		// What a disk fallback would open
+		local := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(urlPath, "/")))
+		if !under(root, local) {
+			t.Fatalf("%q: %q resolves to %q, outside %q", uri, urlPath, local, root)
+		}
+		if joined, err := safeJoin(root, strings.TrimPrefix(urlPath, "/")); err == nil && !under(root, joined) {
+			t.Fatalf("%q: safeJoin of %q escaped to %q", uri, urlPath, joined)
+		}
+	})
+}
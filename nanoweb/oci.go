@@ -0,0 +1,397 @@
+package nanoweb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const ociTitleAnnotation = "org.opencontainers.image.title"
+const ociManifestAccept = "application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json"
+
+// Site content published to a registry as an OCI artifact (as pushed by
+// `oras push`), pulled into a directory under CacheDir that the
+// CacheDir/current symlink points to
+type OCISource struct {
+	Registry string
+	Name     string
+	Tag      string
+	Digest   string
+	Subdir   string
+	CacheDir string
+	Username string
+	Password string
+	Insecure bool
+
+	client  *http.Client
+	token   string
+	current string
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+var ociSource = getOCISource()
+
+// Parse a reference like ghcr.io/acme/site:v1 or ghcr.io/acme/site@sha256:…
+func parseOCIRef(ref string) (string, string, string, string, error) {
+	registry, rest, found := strings.Cut(ref, "/")
+	if !found || rest == "" {
+		return "", "", "", "", fmt.Errorf("invalid OCI reference %q", ref)
+	}
+	if registry == "docker.io" {
+		registry = "registry-1.docker.io"
+	}
+	name, digest, _ := strings.Cut(rest, "@")
+	tag := ""
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	if tag == "" && digest == "" {
+		tag = "latest"
+	}
+	return registry, name, tag, digest, nil
+}
+
+func getOCISource() *OCISource {
+	ref := getEnv("OCI_REF", "")
+	if ref == "" {
+		return nil
+	}
+	registry, name, tag, digest, err := parseOCIRef(ref)
+	if err != nil {
+		configError("%s", err)
+		return nil
+	}
+	return &OCISource{
+		Registry: registry,
+		Name:     name,
+		Tag:      tag,
+		Digest:   digest,
+		Subdir:   getEnv("OCI_SUBDIR", ""),
+		CacheDir: getEnv("OCI_CACHE_DIR", filepath.Join(os.TempDir(), "nano-web-oci")),
+		Username: getEnv("OCI_USERNAME", ""),
+		Password: getEnv("OCI_PASSWORD", ""),
+		Insecure: getEnv("OCI_INSECURE", "0") == "1",
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (source *OCISource) PublicDir() string {
+	return filepath.Join(source.CacheDir, "current", filepath.FromSlash(source.Subdir))
+}
+
+func (source *OCISource) url(path string) string {
+	scheme := "https"
+	if source.Insecure {
+		scheme = "http"
+	}
+	return scheme + "://" + source.Registry + "/v2/" + source.Name + path
+}
+
+// Exchange a Bearer challenge for a token, using basic auth if configured
+func (source *OCISource) authenticate(challenge string) error {
+	params := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		params[key] = strings.Trim(value, `"`)
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("unsupported auth challenge %q", challenge)
+	}
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", "repository:"+source.Name+":pull")
+	req, err := http.NewRequest("GET", params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if source.Username != "" {
+		req.SetBasicAuth(source.Username, source.Password)
+	}
+	res, err := source.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("token request: %s", res.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return err
+	}
+	source.token = token.Token
+	if source.token == "" {
+		source.token = token.AccessToken
+	}
+	return nil
+}
+
+func (source *OCISource) get(path string, accept string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("GET", source.url(path), nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if source.token != "" {
+			req.Header.Set("Authorization", "Bearer "+source.token)
+		} else if source.Username != "" {
+			req.SetBasicAuth(source.Username, source.Password)
+		}
+		res, err := source.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			res.Body.Close()
+			if err := source.authenticate(res.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("GET %s: %s", path, res.Status)
+		}
+		return res, nil
+	}
+}
+
+func verifyDigest(digest string, dat []byte) error {
+	hash := sha256.Sum256(dat)
+	if actual := "sha256:" + hex.EncodeToString(hash[:]); actual != digest {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+	return nil
+}
+
+// Fetch the manifest, verifying it against the pinned digest if there is one
+func (source *OCISource) manifest() (string, ociManifest, error) {
+	reference := source.Digest
+	if reference == "" {
+		reference = source.Tag
+	}
+	res, err := source.get("/manifests/"+reference, ociManifestAccept)
+	if err != nil {
+		return "", ociManifest{}, err
+	}
+	defer res.Body.Close()
+	dat, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", ociManifest{}, err
+	}
+	hash := sha256.Sum256(dat)
+	digest := "sha256:" + hex.EncodeToString(hash[:])
+	if source.Digest != "" {
+		if err := verifyDigest(source.Digest, dat); err != nil {
+			return "", ociManifest{}, err
+		}
+	}
+	var manifest ociManifest
+	err = json.Unmarshal(dat, &manifest)
+	return digest, manifest, err
+}
+
+// Download a blob, refusing it if the content doesn't match its digest
+func (source *OCISource) blob(layer ociDescriptor) ([]byte, error) {
+	res, err := source.get("/blobs/"+layer.Digest, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	dat, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return dat, verifyDigest(layer.Digest, dat)
+}
+
+// Limits on what a single archive may unpack to, so a small upload or layer
+// can't decompress into enough data or files to fill the disk
+var unpackMaxSize = getUnpackMaxSize()
+var unpackMaxFiles = getIntLimit("UNPACK_MAX_FILES", "100000")
+
+func getUnpackMaxSize() int64 {
+	size, err := parseSize(getEnv("UNPACK_MAX_SIZE", "2GB"))
+	if err != nil {
+		configError("invalid UNPACK_MAX_SIZE: %s", err)
+		return 0
+	}
+	return size
+}
+
+func extractTarGz(dat []byte, dest string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(dat))
+	if err != nil {
+		return err
+	}
+	archive := tar.NewReader(gz)
+	var total int64
+	for files := 1; ; files++ {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if unpackMaxFiles > 0 && files > unpackMaxFiles {
+			return fmt.Errorf("archive has more than UNPACK_MAX_FILES (%d) entries", unpackMaxFiles)
+		}
+		target, err := safeJoin(dest, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			total += header.Size
+			if unpackMaxSize > 0 && total > unpackMaxSize {
+				return fmt.Errorf("archive unpacks to more than UNPACK_MAX_SIZE (%d bytes)", unpackMaxSize)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.Create(target)
+			if err != nil {
+				return err
+			}
+			// The reader stops at the size in the header
+			_, err = io.Copy(file, archive)
+			file.Close()
+			if err != nil {
+				return err
+			}
+			os.Chtimes(target, header.ModTime, header.ModTime)
+		}
+	}
+}
+
+// Pull the artifact if its digest isn't the one being served, staging it off
+// to the side and only swapping the current symlink over to it once every
+// layer has been verified. Returns the manifest digest and whether it changed.
+// The caller records the digest as current once it's served, so one that's
+// refused is pulled again.
+func (source *OCISource) Sync() (string, bool, error) {
+	digest, manifest, err := source.manifest()
+	if err != nil {
+		return "", false, err
+	}
+	if digest == source.current {
+		return digest, false, nil
+	}
+	if err := os.MkdirAll(source.CacheDir, 0755); err != nil {
+		return "", false, err
+	}
+	staging, err := os.MkdirTemp(source.CacheDir, "pull-")
+	if err != nil {
+		return "", false, err
+	}
+	if err := source.pull(manifest, staging); err != nil {
+		os.RemoveAll(staging)
+		return "", false, err
+	}
+
+	current := filepath.Join(source.CacheDir, "current")
+	previous, _ := os.Readlink(current)
+	if err := replaceSymlink(current, filepath.Base(staging)); err != nil {
+		os.RemoveAll(staging)
+		return "", false, err
+	}
+	if previous := filepath.Base(previous); strings.HasPrefix(previous, "pull-") {
+		os.RemoveAll(filepath.Join(source.CacheDir, previous))
+	}
+	return digest, true, nil
+}
+
+// Download and verify every titled layer into dir
+func (source *OCISource) pull(manifest ociManifest, dir string) error {
+	for _, layer := range manifest.Layers {
+		title := layer.Annotations[ociTitleAnnotation]
+		if title == "" {
+			continue
+		}
+		target, err := safeJoin(dir, title)
+		if err != nil {
+			return err
+		}
+		dat, err := source.blob(layer)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(layer.MediaType, "tar+gzip") || layer.Annotations["io.deis.oras.content.unpack"] == "true" {
+			err = extractTarGz(dat, dir)
+		} else if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+			err = os.WriteFile(target, dat, 0644)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getOCIPollInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("OCI_POLL_INTERVAL", "5m"))
+	if err != nil || interval <= 0 {
+		return 5 * time.Minute
+	}
+	return interval
+}
+
+// Poll a tag for new digests and reload the site when it moves. Pinned
+// digests never change, so there's nothing to watch.
+func (source *OCISource) Watch(site *Site) {
+	if source.Digest != "" {
+		return
+	}
+	for range time.Tick(getOCIPollInterval()) {
+		digest, changed, err := source.Sync()
+		if err != nil {
+			logln("⇨ error pulling OCI artifact", err)
+			continue
+		}
+		if changed {
+			logln("⇨", source.Name+":"+source.Tag, "moved to", digest, "reloading")
+			reloadMu.Lock()
+			err := site.reloadDeploy(digest)
+			reloadMu.Unlock()
+			if err != nil {
+				logln("⇨ error reloading OCI artifact", digest, err)
+				continue
+			}
+			source.current = digest
+		}
+	}
+}
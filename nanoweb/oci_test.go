@@ -0,0 +1,50 @@
+package nanoweb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func testTarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		archive.Write([]byte(content))
+	}
+	archive.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// A small archive can't unpack into more than the limits allow
+func TestExtractTarGzLimits(t *testing.T) {
+	previousSize, previousFiles := unpackMaxSize, unpackMaxFiles
+	t.Cleanup(func() { unpackMaxSize, unpackMaxFiles = previousSize, previousFiles })
+	unpackMaxSize, unpackMaxFiles = 1024, 3
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{"within limits", map[string]string{"a.html": "a", "b/c.html": strings.Repeat("c", 1000)}, ""},
+		{"too large", map[string]string{"bomb.bin": strings.Repeat("0", 1025)}, "UNPACK_MAX_SIZE"},
+		{"too large in total", map[string]string{"a.bin": strings.Repeat("0", 600), "b.bin": strings.Repeat("0", 600)}, "UNPACK_MAX_SIZE"},
+		{"too many files", map[string]string{"a": "", "b": "", "c": "", "d": ""}, "UNPACK_MAX_FILES"},
+		{"escaping", map[string]string{"../x": "x"}, "refusing"},
+	}
+	for _, test := range tests {
+		err := extractTarGz(testTarGz(t, test.files), t.TempDir())
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
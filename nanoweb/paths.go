@@ -0,0 +1,59 @@
+package nanoweb
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Symlinks in served directories may only point within them, unless
+// FOLLOW_SYMLINKS=1
+var followSymlinks = getEnv("FOLLOW_SYMLINKS", "0") == "1"
+
+// Join a slash separated name from somewhere untrusted, like an archive or a
+// bucket listing, onto root, refusing anything that would end up outside it
+func safeJoin(root string, name string) (string, error) {
+	local := filepath.FromSlash(name)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("refusing path %q", name)
+	}
+	return filepath.Join(root, local), nil
+}
+
+// Whether name, with every symlink resolved, is still within root
+func withinRoot(root string, name string) bool {
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+// Whether a walked entry is a symlink out of the directory being served
+func escapesRoot(root string, source string, entry fs.DirEntry) bool {
+	return !followSymlinks && entry.Type()&fs.ModeSymlink != 0 && !withinRoot(root, source)
+}
+
+// Atomically point the symlink at link to target, so a directory being
+// served is swapped for another without a moment where it doesn't exist. A
+// real directory at link, left by an older version, is moved out of the way.
+func replaceSymlink(link string, target string) error {
+	if info, err := os.Lstat(link); err == nil && info.IsDir() {
+		if err := os.Rename(link, link+".old"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(link + ".old")
+	}
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, link)
+}
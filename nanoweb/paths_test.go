@@ -0,0 +1,108 @@
+package nanoweb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Whether name is root or below it, both already resolved
+func under(root string, name string) bool {
+	rel, err := filepath.Rel(root, name)
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+func FuzzSafeJoin(f *testing.F) {
+	for _, seed := range []string{
+		"index.html", "a/b/c.txt", "", ".", "..", "../x", "a/../../x", "/etc/passwd",
+		`..\x`, `a\..\..\x`, "C:/x", `C:\x`, "a/./b", "a//b", "x\x00y", "NUL", "a/COM1.txt",
+	} {
+		f.Add(seed)
+	}
+	root := f.TempDir()
+	f.Fuzz(func(t *testing.T, name string) {
+		joined, err := safeJoin(root, name)
+		if err != nil {
+			return
+		}
+		if !under(root, joined) {
+			t.Fatalf("safeJoin(%q) = %q, outside %q", name, joined, root)
+		}
+	})
+}
+
+func FuzzWithinRoot(f *testing.F) {
+	base := f.TempDir()
+	root := filepath.Join(base, "public")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "a"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			f.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(root, "a", "file"), filepath.Join(outside, "secret")} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			f.Fatal(err)
+		}
+	}
+	links := map[string]string{"in": "a", "out": outside, "up": "..", "loop": "loop"}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			f.Skip("symlinks unsupported:", err)
+		}
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		f.Fatal(err)
+	}
+	resolvedOutside, err := filepath.EvalSymlinks(outside)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	for _, seed := range []string{
+		"a/file", "in/file", "in", "out/secret", "out", "up/outside/secret", "up/public/a",
+		"loop", "../outside/secret", "a/../../outside", "in/../a/file", "", ".",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		candidate := filepath.Join(root, filepath.FromSlash(name))
+		if !withinRoot(root, candidate) {
+			return
+		}
+		resolved, err := filepath.EvalSymlinks(candidate)
+		if err != nil {
+			t.Fatalf("withinRoot(%q) with an unresolvable path: %s", name, err)
+		}
+		if !under(resolvedRoot, resolved) || strings.HasPrefix(resolved, resolvedOutside) {
+			t.Fatalf("withinRoot(%q) resolved to %q, outside %q", name, resolved, resolvedRoot)
+		}
+	})
+}
+
+// Swapping the served directory never leaves a moment where it's missing, and
+// replaces a real directory left by an older version
+func TestReplaceSymlink(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "current")
+	if err := os.MkdirAll(filepath.Join(link, "old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"one", "two"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(dir, name, "index.html"), []byte(name), 0644)
+		if err := replaceSymlink(link, name); err != nil {
+			t.Fatal(err)
+		}
+		if dat, err := os.ReadFile(filepath.Join(link, "index.html")); err != nil || string(dat) != name {
+			t.Errorf("served %q, %v, want %q", dat, err, name)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("left behind %v", entries)
+	}
+}
@@ -0,0 +1,56 @@
+package nanoweb
+
+import (
+	"strings"
+)
+
+// PERMISSIONS_POLICY and REFERRER_POLICY are sent with every route that
+// doesn't set its own in the _headers file, so a site can lock down browser
+// features by default and open them up for the paths that embed widgets.
+var permissionsPolicy = getEnv("PERMISSIONS_POLICY", "")
+var referrerPolicy = getReferrerPolicy()
+
+var referrerPolicies = []string{
+	"no-referrer",
+	"no-referrer-when-downgrade",
+	"origin",
+	"origin-when-cross-origin",
+	"same-origin",
+	"strict-origin",
+	"strict-origin-when-cross-origin",
+	"unsafe-url",
+}
+
+func getReferrerPolicy() string {
+	value := getEnv("REFERRER_POLICY", "")
+	if value != "" && !validReferrerPolicy(value) {
+		configError("invalid REFERRER_POLICY %q", value)
+		return ""
+	}
+	return value
+}
+
+// Whether a Referrer-Policy value is a list of known policies. Browsers
+// ignore unknown ones, so a typo would silently fall back to their default.
+func validReferrerPolicy(value string) bool {
+	for _, policy := range strings.Split(value, ",") {
+		known := false
+		for _, name := range referrerPolicies {
+			known = known || strings.TrimSpace(policy) == name
+		}
+		if !known {
+			return false
+		}
+	}
+	return true
+}
+
+// Add the default policies the route's header rules don't override
+func applyPolicyHeaders(route *Route) {
+	if permissionsPolicy != "" && route.getHeader("Permissions-Policy") == "" {
+		route.Headers = append(route.Headers, Header{Key: "Permissions-Policy", Value: permissionsPolicy})
+	}
+	if referrerPolicy != "" && route.getHeader("Referrer-Policy") == "" {
+		route.Headers = append(route.Headers, Header{Key: "Referrer-Policy", Value: referrerPolicy})
+	}
+}
@@ -0,0 +1,170 @@
+package nanoweb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/valyala/fasthttp"
+)
+
+// PRECOMPRESSED uses .gz, .br and .zst files next to the originals (as
+// written by `nano-web precompress`) instead of compressing at startup. zstd
+// is only served from these copies.
+var precompressedEnabled = getEnv("PRECOMPRESSED", "0") == "1"
+
+var precompressedExts = []string{".gz", ".br", ".zst"}
+
+// Whether a file is a precompressed copy of another file in the file system
+func isPrecompressed(fsys fs.FS, name string) bool {
+	for _, ext := range precompressedExts {
+		if original, found := strings.CutSuffix(name, ext); found {
+			_, err := fs.Stat(fsys, original)
+			return err == nil
+		}
+	}
+	return false
+}
+
+// Read a precompressed copy if there's one at least as new as the original
+func readPrecompressed(fsys fs.FS, name string, modTime time.Time) []byte {
+	info, err := fs.Stat(fsys, name)
+	if err != nil || info.ModTime().Before(modTime) {
+		return nil
+	}
+	dat, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil
+	}
+	return dat
+}
+
+type compressor struct {
+	ext   string
+	write func(io.Writer, []byte) error
+}
+
+var compressors = []compressor{
+	{".gz", func(w io.Writer, dat []byte) error {
+		writer, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+		writer.Write(dat)
+		return writer.Close()
+	}},
+	{".br", func(w io.Writer, dat []byte) error {
+		writer := brotli.NewWriterLevel(w, brotli.BestCompression)
+		writer.Write(dat)
+		return writer.Close()
+	}},
+	{".zst", func(w io.Writer, dat []byte) error {
+		writer, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		if err != nil {
+			return err
+		}
+		writer.Write(dat)
+		return writer.Close()
+	}},
+}
+
+// The encoding to serve a route in: zstd if there's a precompressed copy and
+// the client accepts it, otherwise the usual preference
+func routeEncoding(ctx *fasthttp.RequestCtx, route Route) string {
+	if route.Content.Zstd != nil && strings.Contains(string(ctx.Request.Header.Peek("Accept-Encoding")), "zstd") {
+		return "zstd"
+	}
+	return getAcceptedEncoding(ctx)
+}
+
+// Write compressed copies of a file that are missing or older than it,
+// returning how many were written
+func precompressFile(file string) (int, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	var dat []byte
+	written := 0
+	for _, compressor := range compressors {
+		target := file + compressor.ext
+		if targetInfo, err := os.Stat(target); err == nil && !targetInfo.ModTime().Before(info.ModTime()) {
+			continue
+		}
+		if dat == nil {
+			if dat, err = os.ReadFile(file); err != nil {
+				return written, err
+			}
+		}
+		var b bytes.Buffer
+		if err := compressor.write(&b, dat); err != nil {
+			return written, err
+		}
+		// Not worth serving
+		if b.Len() >= len(dat) {
+			os.Remove(target)
+			continue
+		}
+		if err := os.WriteFile(target, b.Bytes(), 0644); err != nil {
+			return written, err
+		}
+		os.Chtimes(target, info.ModTime(), info.ModTime())
+		written++
+	}
+	return written, nil
+}
+
+// Write .gz, .br and .zst copies of every compressible file in a directory
+func precompressCommand(args []string) int {
+	dir := getPublicDir()
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	files := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	written, failed := 0, false
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range files {
+				count, err := precompressFile(file)
+				mu.Lock()
+				written += count
+				if err != nil {
+					fmt.Fprintln(os.Stderr, file, err)
+					failed = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && shouldCompress(file, getMimetype(strings.ToLower(filepath.Ext(file)))) {
+			files <- file
+		}
+		return nil
+	})
+	close(files)
+	wg.Wait()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("wrote %d compressed files in %s\n", written, dir)
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package nanoweb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Only copies in encodings that are served are written, and they're what's
+// served with PRECOMPRESSED
+func TestPrecompressedCopiesServed(t *testing.T) {
+	previous := precompressedEnabled
+	precompressedEnabled = true
+	t.Cleanup(func() { precompressedEnabled = previous })
+	site := testSite(t, map[string]string{"app.js": strings.Repeat("console.log('hello');\n", 100)})
+	file := filepath.Join(site.PublicDir, "app.js")
+
+	written, err := precompressFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != len(precompressedExts) {
+		t.Errorf("wrote %d copies, want %d", written, len(precompressedExts))
+	}
+	entries, err := os.ReadDir(site.PublicDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if ext := filepath.Ext(entry.Name()); ext != ".js" && !slices.Contains(precompressedExts, ext) {
+			t.Errorf("wrote %s, which is never served", entry.Name())
+		}
+	}
+	if written, _ := precompressFile(file); written != 0 {
+		t.Errorf("rewrote %d up to date copies", written)
+	}
+
+	if err := site.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct{ accept, encoding, ext string }{
+		{"br", "br", ".br"},
+		{"gzip", "gzip", ".gz"},
+		{"zstd", "zstd", ".zst"},
+		{"gzip, deflate, br, zstd", "zstd", ".zst"},
+	} {
+		want, err := os.ReadFile(file + test.ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/app.js")
+		ctx.Request.Header.Set("Accept-Encoding", test.accept)
+		handler(ctx)
+		if encoding := string(ctx.Response.Header.ContentEncoding()); encoding != test.encoding {
+			t.Errorf("%s: Content-Encoding %q, want %q", test.accept, encoding, test.encoding)
+		}
+		if !bytes.Equal(ctx.Response.Body(), want) {
+			t.Errorf("%s: not the precompressed copy", test.accept)
+		}
+		if length := ctx.Response.Header.ContentLength(); length != len(want) {
+			t.Errorf("%s: Content-Length %d, want %d", test.accept, length, len(want))
+		}
+	}
+}
+
+// Without a .zst copy, clients that accept zstd get their next preference
+func TestZstdOnlyFromPrecompressedCopies(t *testing.T) {
+	testSite(t, map[string]string{"app.js": strings.Repeat("console.log('hello');\n", 100)})
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/app.js")
+	ctx.Request.Header.Set("Accept-Encoding", "gzip, deflate, br, zstd")
+	handler(ctx)
+	if encoding := string(ctx.Response.Header.ContentEncoding()); encoding != "br" {
+		t.Errorf("Content-Encoding %q, want br", encoding)
+	}
+}
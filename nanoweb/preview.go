@@ -0,0 +1,136 @@
+package nanoweb
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var previewNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Serves previews from subdirectories of Dir, selected by a header or cookie.
+// Preview route tables are built on first use and cached.
+type Previews struct {
+	Dir    string
+	Header string
+	Cookie string
+	Max    int
+
+	mu     sync.Mutex
+	tables map[string]*previewBuild
+}
+
+// A preview's route table, built by the first request for it while any
+// others for it wait
+type previewBuild struct {
+	done  chan struct{}
+	table *RouteTable
+	at    time.Time
+}
+
+func getPreviews() *Previews {
+	dir := getEnv("PREVIEW_DIR", "")
+	if dir == "" {
+		return nil
+	}
+	max, err := strconv.Atoi(getEnv("PREVIEW_MAX", "20"))
+	if err != nil || max <= 0 {
+		configError("invalid PREVIEW_MAX %q", getEnv("PREVIEW_MAX", ""))
+		return nil
+	}
+	return &Previews{
+		Dir:    dir,
+		Header: getEnv("PREVIEW_HEADER", "X-Preview"),
+		Cookie: getEnv("PREVIEW_COOKIE", "nano_preview"),
+		Max:    max,
+		tables: make(map[string]*previewBuild),
+	}
+}
+
+// Forget built previews so they're repopulated on next use
+func (previews *Previews) Reset() {
+	previews.mu.Lock()
+	defer previews.mu.Unlock()
+	previews.tables = make(map[string]*previewBuild)
+}
+
+// The preview's route table, building it if it isn't cached. Names without
+// a directory are turned away before anything is built or evicted, and
+// builds happen outside the lock so other previews are served meanwhile.
+func (previews *Previews) table(site *Site, name string) *RouteTable {
+	previews.mu.Lock()
+	build, exists := previews.tables[name]
+	previews.mu.Unlock()
+	if exists {
+		<-build.done
+		return build.table
+	}
+
+	dir := filepath.Join(previews.Dir, name)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil
+	}
+	previews.mu.Lock()
+	if build, exists = previews.tables[name]; !exists {
+		if len(previews.tables) >= previews.Max {
+			oldest := ""
+			for built, other := range previews.tables {
+				if oldest == "" || other.at.Before(previews.tables[oldest].at) {
+					oldest = built
+				}
+			}
+			delete(previews.tables, oldest)
+		}
+		build = &previewBuild{done: make(chan struct{}), at: time.Now()}
+		previews.tables[name] = build
+	}
+	previews.mu.Unlock()
+	if exists {
+		<-build.done
+		return build.table
+	}
+
+	logln("⇨ populating preview", name, "→", dir)
+	table := site.Build(dir)
+	table.DeployID = table.ContentHash()
+	build.table = table
+	close(build.done)
+	return table
+}
+
+// Pick the preview named by the header, the cookie, or a `?preview=` query
+// (which also sets the cookie so browsers stay on the preview)
+func (previews *Previews) Select(ctx *fasthttp.RequestCtx, site *Site, table *RouteTable) *RouteTable {
+	ctx.Response.Header.Add("Vary", previews.Header)
+	ctx.Response.Header.Add("Vary", "Cookie")
+	name := string(ctx.Request.Header.Peek(previews.Header))
+	if query := ctx.QueryArgs().Peek("preview"); query != nil {
+		name = string(query)
+		cookie := fasthttp.AcquireCookie()
+		cookie.SetKey(previews.Cookie)
+		cookie.SetValue(name)
+		cookie.SetPath("/")
+		cookie.SetHTTPOnly(true)
+		if name == "" {
+			cookie.SetExpire(fasthttp.CookieExpireDelete)
+		}
+		ctx.Response.Header.SetCookie(cookie)
+		fasthttp.ReleaseCookie(cookie)
+	} else if name == "" {
+		name = string(ctx.Request.Header.Cookie(previews.Cookie))
+	}
+	if name == "" || !previewNameRegexp.MatchString(name) {
+		return table
+	}
+	preview := previews.table(site, name)
+	if preview == nil {
+		return table
+	}
+	ctx.Response.Header.Set("X-Preview", name)
+	return preview
+}
@@ -0,0 +1,62 @@
+package nanoweb
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func testPreviews(t *testing.T, names ...string) *Previews {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(dir, name, "index.html"), []byte(name), 0644)
+	}
+	return &Previews{Dir: dir, Header: "X-Preview", Cookie: "nano_preview", Max: 2, tables: make(map[string]*previewBuild)}
+}
+
+// Concurrent requests for a preview share one build, and names that aren't
+// previews are turned away without evicting anything
+func TestPreviewTables(t *testing.T) {
+	site := testSite(t, map[string]string{"index.html": "live"})
+	previews := testPreviews(t, "pr-1", "pr-2", "pr-3")
+
+	tables := make([]*RouteTable, 8)
+	var wg sync.WaitGroup
+	for i := range tables {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tables[i] = previews.table(site, "pr-1")
+		}(i)
+	}
+	wg.Wait()
+	for _, table := range tables {
+		if table == nil || table != tables[0] {
+			t.Fatal("concurrent requests built the preview more than once")
+		}
+	}
+	if route, exists := tables[0].Routes["/"]; !exists || string(route.Content.Plain) != "pr-1" {
+		t.Errorf("preview serves %q", route.Content.Plain)
+	}
+
+	previews.table(site, "pr-2")
+	for _, name := range []string{"unknown", "pr-4"} {
+		if table := previews.table(site, name); table != nil {
+			t.Errorf("%s: built a preview with no directory", name)
+		}
+	}
+	if len(previews.tables) != 2 || previews.tables["pr-1"] == nil || previews.tables["pr-2"] == nil {
+		t.Errorf("unknown previews evicted built ones, left %v", previews.tables)
+	}
+
+	// Past PREVIEW_MAX the oldest is evicted
+	previews.table(site, "pr-3")
+	if len(previews.tables) != 2 || previews.tables["pr-1"] != nil {
+		t.Errorf("kept %d previews, including pr-1: %v", len(previews.tables), previews.tables["pr-1"] != nil)
+	}
+}
@@ -0,0 +1,34 @@
+package nanoweb
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// ANONYMIZE_IP masks client IPs in logs, zeroing the last octet of IPv4
+// addresses and the last 80 bits of IPv6 ones. ANONYMIZE_USER_AGENT drops the
+// parenthesised comments from user agents, which carry OS and device details.
+var anonymizeIP = getEnv("ANONYMIZE_IP", "0") == "1"
+var anonymizeUserAgent = getEnv("ANONYMIZE_USER_AGENT", "0") == "1"
+
+var userAgentComments = regexp.MustCompile(`\s*\([^)]*\)`)
+
+// A client IP as it should appear in logs
+func logIP(ip net.IP) string {
+	if !anonymizeIP {
+		return ip.String()
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// A user agent as it should appear in logs
+func logUserAgent(userAgent string) string {
+	if !anonymizeUserAgent {
+		return userAgent
+	}
+	return strings.TrimSpace(userAgentComments.ReplaceAllString(userAgent, ""))
+}
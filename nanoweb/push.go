@@ -0,0 +1,69 @@
+package nanoweb
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Pushes the metrics to a Prometheus Pushgateway on an interval with
+// METRICS=pushgateway, for servers that can't be scraped
+type MetricsPusher struct {
+	URL      string
+	Interval time.Duration
+
+	metrics *PrometheusMetrics
+	client  *http.Client
+}
+
+func getMetricsPusher() *MetricsPusher {
+	prometheus, ok := metrics.(*PrometheusMetrics)
+	if !ok || !prometheus.push {
+		return nil
+	}
+	url := getEnv("METRICS_PUSH_URL", "")
+	if url == "" {
+		configError("METRICS=pushgateway needs METRICS_PUSH_URL")
+		return nil
+	}
+	interval, err := time.ParseDuration(getEnv("METRICS_PUSH_INTERVAL", "15s"))
+	if err != nil || interval <= 0 {
+		configError("invalid METRICS_PUSH_INTERVAL %q", getEnv("METRICS_PUSH_INTERVAL", ""))
+		return nil
+	}
+	return &MetricsPusher{
+		URL:      url,
+		Interval: interval,
+		metrics:  prometheus,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// PUT replaces everything previously pushed to the group
+func (pusher *MetricsPusher) Push() error {
+	var body bytes.Buffer
+	pusher.metrics.write(&body)
+	req, err := http.NewRequest(http.MethodPut, pusher.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", prometheusContentType)
+	res, err := pusher.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("PUT %s: %s", pusher.URL, res.Status)
+	}
+	return nil
+}
+
+func (pusher *MetricsPusher) Watch() {
+	for range time.Tick(pusher.Interval) {
+		if err := pusher.Push(); err != nil {
+			logln("⇨ error pushing metrics", err)
+		}
+	}
+}
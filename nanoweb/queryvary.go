@@ -0,0 +1,98 @@
+package nanoweb
+
+import (
+	"html"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Routes are looked up by path alone, so /index.html?v=123 is served
+// /index.html. QUERY_VARY lists query parameters that templated HTML can use
+// as .Query.<name> instead, rendered on first request for each combination
+// of values and kept with the route, up to queryVariantLimit of them. Past
+// that, new combinations are served the route as if they had no query, so
+// random queries can't make every request render and compress a page.
+var queryVary = getQueryVary()
+
+const queryVariantLimit = 256
+
+func getQueryVary() []string {
+	params := []string{}
+	for _, param := range strings.Split(getEnv("QUERY_VARY", ""), ",") {
+		if param = strings.TrimSpace(param); param != "" {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// Every QUERY_VARY parameter, empty unless the request has it. Values are
+// HTML escaped, as they're only rendered into HTML.
+func queryValues(args *fasthttp.Args) map[string]string {
+	values := make(map[string]string, len(queryVary))
+	for _, param := range queryVary {
+		values[param] = ""
+		if args != nil {
+			values[param] = html.EscapeString(string(args.Peek(param)))
+		}
+	}
+	return values
+}
+
+type queryVariants struct {
+	render func(query map[string]string) (Route, error)
+
+	mu     sync.Mutex
+	routes map[string]Route
+}
+
+// Whether an HTML template uses the query, so needs rendering per request
+func variesOnQuery(mimetype string, source string) bool {
+	return len(queryVary) > 0 && mimetype == "text/html" && strings.Contains(source, ".Query")
+}
+
+// The route rendered for the request's QUERY_VARY parameters, or the route
+// itself when the request has none of them or the variants are full
+func (variants *queryVariants) Select(ctx *fasthttp.RequestCtx, route Route) Route {
+	args := ctx.QueryArgs()
+	var key strings.Builder
+	varied := false
+	for _, param := range queryVary {
+		value := args.Peek(param)
+		varied = varied || len(value) > 0
+		key.WriteString(param + "=" + string(value) + "&")
+	}
+	if !varied {
+		return route
+	}
+
+	variants.mu.Lock()
+	variant, found := variants.routes[key.String()]
+	full := len(variants.routes) >= queryVariantLimit
+	variants.mu.Unlock()
+	if found {
+		return variant
+	}
+	if full {
+		return route
+	}
+	variant, err := variants.render(queryValues(args))
+	if err != nil {
+		logln("⇨ error rendering", ctx.Path(), "for query", err)
+		return route
+	}
+	variant.Link, variant.Headers, variant.Source = route.Link, route.Headers, route.Source
+	variants.mu.Lock()
+	if variants.routes == nil {
+		variants.routes = make(map[string]Route)
+	}
+	if len(variants.routes) >= queryVariantLimit {
+		variants.mu.Unlock()
+		return route
+	}
+	variants.routes[key.String()] = variant
+	variants.mu.Unlock()
+	return variant
+}
@@ -0,0 +1,88 @@
+package nanoweb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestQueryStringsIgnoredInLookup(t *testing.T) {
+	testSite(t, map[string]string{
+		"index.html":      "home",
+		"docs/index.html": "docs",
+		"app.js":          "app",
+	})
+	tests := []struct {
+		uri    string
+		status int
+		body   string
+	}{
+		{"/index.html", 200, "home"},
+		{"/index.html?v=123", 200, "home"},
+		{"/index.html?", 200, "home"},
+		{"/index.html?v=1&v=2&utm_source=x", 200, "home"},
+		{"/index.html?v=%2F..%2Fsecret", 200, "home"},
+		{"/index.html#top", 200, "home"},
+		{"/index.html?v=1#top", 200, "home"},
+		{"/?v=123", 200, "home"},
+		{"/docs?v=123", 200, "docs"},
+		{"/docs/index.html?v=123", 200, "docs"},
+		{"/app.js?v=abc", 200, "app"},
+		{"/app.js?index.html", 200, "app"},
+		{"/missing?v=123", 404, ""},
+		{"/missing?/index.html", 404, ""},
+	}
+	for _, test := range tests {
+		ctx := serve(test.uri)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.uri, status, test.status)
+			continue
+		}
+		if test.body != "" && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s: body %q, want %q", test.uri, ctx.Response.Body(), test.body)
+		}
+	}
+}
+
+func TestQueryVariants(t *testing.T) {
+	previous := queryVary
+	queryVary = []string{"theme"}
+	t.Cleanup(func() { queryVary = previous })
+	testSite(t, map[string]string{"index.html": "<p>{{.Query.theme}}</p>"})
+
+	tests := []struct {
+		uri  string
+		body string
+	}{
+		{"/", "<p></p>"},
+		{"/?other=1", "<p></p>"},
+		{"/?theme=dark", "<p>dark</p>"},
+		{"/index.html?theme=dark&other=1", "<p>dark</p>"},
+		{"/?theme=%3Cb%3E", "<p>&lt;b&gt;</p>"},
+	}
+	for _, test := range tests {
+		if body := string(serve(test.uri).Response.Body()); body != test.body {
+			t.Errorf("%s: body %q, want %q", test.uri, body, test.body)
+		}
+	}
+}
+
+func TestQueryVariantLimit(t *testing.T) {
+	previous := queryVary
+	queryVary = []string{"theme"}
+	t.Cleanup(func() { queryVary = previous })
+	site := testSite(t, map[string]string{"index.html": "<p>{{.Query.theme}}</p>"})
+
+	for i := 0; i < queryVariantLimit+10; i++ {
+		serve(fmt.Sprintf("/?theme=t%d", i))
+	}
+	variants := site.Table().Routes["/"].variants
+	if count := len(variants.routes); count != queryVariantLimit {
+		t.Fatalf("%d variants kept, want %d", count, queryVariantLimit)
+	}
+	if body := string(serve("/?theme=new").Response.Body()); body != "<p></p>" {
+		t.Errorf("past the limit served %q, want the page without the query", body)
+	}
+	if body := string(serve("/?theme=t0").Response.Body()); body != "<p>t0</p>" {
+		t.Errorf("kept variant served %q", body)
+	}
+}
@@ -0,0 +1,87 @@
+package nanoweb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Parse a single `bytes=` range against a body of the given length. Multiple
+// ranges aren't supported and are served as a full response.
+func parseRange(header string, length int) (int, int, bool, error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+	if first == "" {
+		suffix, err := strconv.Atoi(last)
+		if err != nil || suffix <= 0 || length == 0 {
+			return 0, 0, false, fmt.Errorf("unsatisfiable range %q", header)
+		}
+		if suffix > length {
+			suffix = length
+		}
+		return length - suffix, length - 1, true, nil
+	}
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 0 || start >= length {
+		return 0, 0, false, fmt.Errorf("unsatisfiable range %q", header)
+	}
+	end := length - 1
+	if last != "" {
+		end, err = strconv.Atoi(last)
+		if err != nil || end < start {
+			return 0, 0, false, fmt.Errorf("unsatisfiable range %q", header)
+		}
+		if end >= length {
+			end = length - 1
+		}
+	}
+	return start, end, true, nil
+}
+
+// Whether a Range request's If-Range still matches the representation. An
+// entity tag has to match strongly and a date exactly, otherwise the whole
+// body is sent.
+func ifRangeMatches(ctx *fasthttp.RequestCtx, etag string, lastModified string) bool {
+	condition := string(ctx.Request.Header.Peek("If-Range"))
+	switch {
+	case condition == "":
+		return true
+	case strings.HasPrefix(condition, `"`) || strings.HasPrefix(condition, "W/"):
+		return condition == etag
+	default:
+		return condition == lastModified
+	}
+}
+
+// Send the requested range of a body of the given length with setRange,
+// which is passed its first and last byte. Returns false if the request
+// should get the full body instead.
+func serveRange(ctx *fasthttp.RequestCtx, length int, etag string, lastModified string, setRange func(start int, end int)) bool {
+	header := string(ctx.Request.Header.Peek("Range"))
+	if header == "" || !ctx.IsGet() || !ifRangeMatches(ctx, etag, lastModified) {
+		return false
+	}
+	start, end, ok, err := parseRange(header, length)
+	if err != nil {
+		ctx.Error("Range Not Satisfiable", fasthttp.StatusRequestedRangeNotSatisfiable)
+		ctx.Response.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", length))
+		return true
+	}
+	if !ok {
+		return false
+	}
+	ctx.SetStatusCode(fasthttp.StatusPartialContent)
+	ctx.Response.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, length))
+	// Replacing the length of the whole body, set for HEAD
+	ctx.Response.Header.SetContentLength(end - start + 1)
+	setRange(start, end)
+	return true
+}
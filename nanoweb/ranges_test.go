@@ -0,0 +1,67 @@
+package nanoweb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRanges(t *testing.T) {
+	data := strings.Repeat("0123456789", 10)
+	site := testSite(t, map[string]string{
+		"data.bin": data,
+		"app.js":   strings.Repeat("console.log('hello');\n", 100),
+	})
+	route := site.Table().Routes["/data.bin"]
+	etag := routeETag(route, "")
+
+	tests := []struct {
+		name         string
+		uri          string
+		headers      map[string]string
+		status       int
+		contentRange string
+		body         string
+	}{
+		{"single", "/data.bin", map[string]string{"Range": "bytes=0-9"}, 206, "bytes 0-9/100", data[:10]},
+		{"open ended", "/data.bin", map[string]string{"Range": "bytes=90-"}, 206, "bytes 90-99/100", data[90:]},
+		{"past the end", "/data.bin", map[string]string{"Range": "bytes=95-200"}, 206, "bytes 95-99/100", data[95:]},
+		{"suffix", "/data.bin", map[string]string{"Range": "bytes=-10"}, 206, "bytes 90-99/100", data[90:]},
+		{"suffix longer than the body", "/data.bin", map[string]string{"Range": "bytes=-200"}, 206, "bytes 0-99/100", data},
+		{"start past the end", "/data.bin", map[string]string{"Range": "bytes=100-"}, 416, "bytes */100", ""},
+		{"end before start", "/data.bin", map[string]string{"Range": "bytes=5-2"}, 416, "bytes */100", ""},
+		{"empty suffix", "/data.bin", map[string]string{"Range": "bytes=-0"}, 416, "bytes */100", ""},
+		{"not a number", "/data.bin", map[string]string{"Range": "bytes=a-b"}, 416, "bytes */100", ""},
+		// Multiple ranges and other units aren't supported, so get the whole body
+		{"multiple ranges", "/data.bin", map[string]string{"Range": "bytes=0-1,5-6"}, 200, "", data},
+		{"other unit", "/data.bin", map[string]string{"Range": "items=0-1"}, 200, "", data},
+		{"If-Range matching tag", "/data.bin", map[string]string{"Range": "bytes=0-9", "If-Range": etag}, 206, "bytes 0-9/100", data[:10]},
+		{"If-Range stale tag", "/data.bin", map[string]string{"Range": "bytes=0-9", "If-Range": `"stale"`}, 200, "", data},
+		{"If-Range weak tag", "/data.bin", map[string]string{"Range": "bytes=0-9", "If-Range": "W/" + etag}, 200, "", data},
+		{"If-Range matching date", "/data.bin", map[string]string{"Range": "bytes=0-9", "If-Range": route.LastModified}, 206, "bytes 0-9/100", data[:10]},
+		{"If-Range other date", "/data.bin", map[string]string{"Range": "bytes=0-9", "If-Range": "Mon, 01 Jan 2001 00:00:00 GMT"}, 200, "", data},
+		// Ranges are only served from the plain content
+		{"compressed", "/app.js", map[string]string{"Range": "bytes=0-9", "Accept-Encoding": "gzip"}, 200, "", ""},
+	}
+	for _, test := range tests {
+		ctx := serveWith(test.uri, test.headers)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, status, test.status)
+			continue
+		}
+		if contentRange := string(ctx.Response.Header.Peek("Content-Range")); contentRange != test.contentRange {
+			t.Errorf("%s: Content-Range %q, want %q", test.name, contentRange, test.contentRange)
+		}
+		if test.body != "" && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s: body %q, want %q", test.name, ctx.Response.Body(), test.body)
+		}
+		if test.status == 206 && ctx.Response.Header.ContentLength() != len(test.body) {
+			t.Errorf("%s: Content-Length %d, want %d", test.name, ctx.Response.Header.ContentLength(), len(test.body))
+		}
+	}
+
+	// HEAD describes the whole body
+	ctx := serveMethod("HEAD", "/data.bin", map[string]string{"Range": "bytes=0-9"})
+	if status := ctx.Response.StatusCode(); status != 200 || len(ctx.Response.Body()) != 0 {
+		t.Errorf("HEAD: status %d with a %d byte body, want 200 with none", status, len(ctx.Response.Body()))
+	}
+}
@@ -0,0 +1,98 @@
+package nanoweb
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const redirectsFile = "_redirects"
+
+type RedirectRule struct {
+	From   string
+	To     string
+	Status int
+}
+
+// Parse a Netlify style _redirects file: `/from /to [status]` on each line.
+// A trailing * in from matches the rest of the path, which replaces :splat
+// in to.
+func parseRedirectsFile(fsys fs.FS, name string) ([]RedirectRule, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := []RedirectRule{}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 || !strings.HasPrefix(fields[0], "/") {
+			return nil, fmt.Errorf("%s:%d: expected `/from /to [status]`", name, line)
+		}
+		rule := RedirectRule{From: fields[0], To: fields[1], Status: fasthttp.StatusMovedPermanently}
+		if len(fields) == 3 {
+			rule.Status, err = strconv.Atoi(fields[2])
+			if err != nil || !redirectStatus(rule.Status) {
+				return nil, fmt.Errorf("%s:%d: unsupported status %s", name, line, fields[2])
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+func redirectStatus(status int) bool {
+	switch status {
+	case fasthttp.StatusMovedPermanently, fasthttp.StatusFound, fasthttp.StatusSeeOther,
+		fasthttp.StatusTemporaryRedirect, fasthttp.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+func loadRedirectRules(fsys fs.FS, publicDir string) ([]RedirectRule, error) {
+	if _, err := fs.Stat(fsys, redirectsFile); err != nil {
+		return nil, nil
+	}
+	rules, err := parseRedirectsFile(fsys, redirectsFile)
+	if err != nil {
+		return nil, err
+	}
+	logln("⇨ loaded", len(rules), "redirects from", filepath.Join(publicDir, redirectsFile))
+	return rules, nil
+}
+
+// Redirect a path no file matched with the first matching rule, returning
+// false if none does
+func redirectRules(ctx *fasthttp.RequestCtx, rules []RedirectRule, path string) bool {
+	for _, rule := range rules {
+		to := rule.To
+		if prefix, found := strings.CutSuffix(rule.From, "*"); found {
+			splat, matched := strings.CutPrefix(path, prefix)
+			if !matched {
+				continue
+			}
+			to = strings.ReplaceAll(to, ":splat", splat)
+		} else if path != rule.From {
+			continue
+		}
+		if query := ctx.URI().QueryString(); len(query) > 0 && !strings.Contains(to, "?") {
+			to += "?" + string(query)
+		}
+		ctx.Redirect(to, rule.Status)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package nanoweb
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRedirects(t *testing.T) {
+	testSite(t, map[string]string{
+		"index.html":    "home",
+		"posts/a.html":  "a",
+		"old/kept.html": "kept",
+		redirectsFile: `# comment
+/home / 301
+/old/* /posts/:splat 302
+/external https://example.com/?from=nano-web 308
+`,
+	})
+	tests := []struct {
+		uri      string
+		status   int
+		location string
+	}{
+		{"/home", 301, "/"},
+		{"/home?x=1", 301, "/?x=1"},
+		{"/old/a.html", 302, "/posts/a.html"},
+		{"/old/deep/b.html?y=2", 302, "/posts/deep/b.html?y=2"},
+		// Files win over rules
+		{"/old/kept.html", 200, ""},
+		{"/external?x=1", 308, "https://example.com/?from=nano-web"},
+		{"/homepage", 404, ""},
+		{"/" + redirectsFile, 404, ""},
+	}
+	for _, test := range tests {
+		ctx := serve(test.uri)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.uri, status, test.status)
+			continue
+		}
+		// Local targets are made absolute, with the request's (empty) host
+		location := strings.TrimPrefix(string(ctx.Response.Header.Peek("Location")), "http://")
+		if test.location != "" && location != test.location {
+			t.Errorf("%s: redirected to %q, want %q", test.uri, location, test.location)
+		}
+	}
+}
+
+func TestParseRedirectsFile(t *testing.T) {
+	for _, content := range []string{
+		"/a",
+		"/a /b 301 extra",
+		"a /b",
+		"/a /b 200",
+		"/a /b permanent",
+	} {
+		fsys := fstest.MapFS{redirectsFile: {Data: []byte(content)}}
+		if _, err := parseRedirectsFile(fsys, redirectsFile); err == nil {
+			t.Errorf("%q parsed", content)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package nanoweb
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/valyala/fasthttp"
+)
+
+const reloadPath = "/__reload"
+
+var reloadMu sync.Mutex
+
+// Repopulate every site, one reload at a time, returning the errors of those
+// that kept their previous table
+func reloadSites() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	var errs []error
+	for _, site := range sites {
+		if err := site.Reload(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reload on SIGHUP
+func watchReloadSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		logln("⇨ reloading on SIGHUP")
+		reloadSites()
+	}
+}
+
+// POST /__reload repopulates every site, responding with their stats, or
+// with why a site kept its previous table
+func reloadHandler(ctx *fasthttp.RequestCtx) {
+	if !bearerAuthorized(ctx, adminToken) {
+		unauthorized(ctx)
+		return
+	}
+	if !ctx.IsPost() {
+		ctx.Error("Method Not Allowed", fasthttp.StatusMethodNotAllowed)
+		ctx.Response.Header.Set("Allow", "POST")
+		return
+	}
+	logln("⇨ reloading on request")
+	if err := reloadSites(); err != nil {
+		logln("⇨ error reloading", err)
+		ctx.Error("Unprocessable Entity: "+err.Error(), fasthttp.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(ctx, fasthttp.StatusOK, getStats())
+}
@@ -0,0 +1,40 @@
+package nanoweb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadHandler(t *testing.T) {
+	site := testSite(t, map[string]string{"index.html": "before"})
+	previous := adminToken
+	adminToken = "token"
+	t.Cleanup(func() { adminToken = previous })
+	auth := map[string]string{"Authorization": "Bearer token"}
+
+	os.WriteFile(filepath.Join(site.PublicDir, "index.html"), []byte("after"), 0644)
+	if status := serveMethod("POST", "/__reload", auth).Response.StatusCode(); status != 200 {
+		t.Errorf("reload: status %d, want 200", status)
+	}
+	if body := string(serve("/").Response.Body()); body != "after" {
+		t.Errorf("after reloading serving %q", body)
+	}
+
+	// A refused reload is reported, and the previous table kept
+	os.RemoveAll(site.PublicDir)
+	if status := serveMethod("POST", "/__reload", auth).Response.StatusCode(); status != 422 {
+		t.Errorf("refused reload: status %d, want 422", status)
+	}
+	if body := string(serve("/").Response.Body()); body != "after" {
+		t.Errorf("after a refused reload serving %q", body)
+	}
+
+	get := serveMethod("GET", "/__reload", auth)
+	if status, allow := get.Response.StatusCode(), string(get.Response.Header.Peek("Allow")); status != 405 || allow != "POST" {
+		t.Errorf("GET: status %d with Allow %q, want 405 with POST", status, allow)
+	}
+	if status := serveMethod("POST", "/__reload", nil).Response.StatusCode(); status != 401 {
+		t.Errorf("without a token: status %d, want 401", status)
+	}
+}
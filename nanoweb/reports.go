@@ -0,0 +1,143 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const reportsPath = "/__reports"
+const maxReportSize = 64 * 1024
+
+var reportsEnabled = getEnv("REPORTS", "0") == "1"
+
+// Token bucket shared by all reporting clients
+type RateLimiter struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newRateLimiter(perMinute int) *RateLimiter {
+	capacity := float64(perMinute)
+	return &RateLimiter{rate: capacity / 60, capacity: capacity, tokens: capacity, last: time.Now()}
+}
+
+func (limiter *RateLimiter) Allow() bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.capacity {
+		limiter.tokens = limiter.capacity
+	}
+	limiter.last = now
+	if limiter.tokens < 1 {
+		return false
+	}
+	limiter.tokens--
+	return true
+}
+
+func getReportsRate() int {
+	rate, err := strconv.Atoi(getEnv("REPORTS_RATE", "60"))
+	if err != nil || rate <= 0 {
+		return 60
+	}
+	return rate
+}
+
+var reportsLimiter = newRateLimiter(getReportsRate())
+
+type ReportEvent struct {
+	Event     string          `json:"event"`
+	Time      string          `json:"time"`
+	Type      string          `json:"type"`
+	URL       string          `json:"url,omitempty"`
+	UserAgent string          `json:"userAgent,omitempty"`
+	RemoteIP  string          `json:"remoteIp"`
+	Body      json.RawMessage `json:"body"`
+}
+
+func logEvent(event interface{}) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		logln("⇨ error encoding event", err)
+		return
+	}
+	logln(string(line))
+}
+
+// Accept CSP violation reports (report-uri) and Reporting API batches
+// (report-to, including NEL) and log each one as a structured event
+func reportsHandler(ctx *fasthttp.RequestCtx) {
+	if !ctx.IsPost() {
+		ctx.Error("Method Not Allowed", fasthttp.StatusMethodNotAllowed)
+		ctx.Response.Header.Set("Allow", "POST")
+		return
+	}
+	if len(ctx.PostBody()) > maxReportSize {
+		ctx.Error("Request Entity Too Large", fasthttp.StatusRequestEntityTooLarge)
+		auditDenied(ctx, "report_size")
+		return
+	}
+	if !reportsLimiter.Allow() {
+		ctx.Error("Too Many Requests", fasthttp.StatusTooManyRequests)
+		auditDenied(ctx, "report_rate")
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	remoteIP := logIP(ctx.RemoteIP())
+	contentType, _, _ := strings.Cut(string(ctx.Request.Header.ContentType()), ";")
+	switch strings.TrimSpace(contentType) {
+	case "application/csp-report":
+		var report struct {
+			Body json.RawMessage `json:"csp-report"`
+		}
+		if err := json.Unmarshal(ctx.PostBody(), &report); err != nil || report.Body == nil {
+			ctx.Error("Bad Request", fasthttp.StatusBadRequest)
+			return
+		}
+		logEvent(ReportEvent{
+			Event:     "report",
+			Time:      now,
+			Type:      "csp-violation",
+			UserAgent: logUserAgent(string(ctx.UserAgent())),
+			RemoteIP:  remoteIP,
+			Body:      report.Body,
+		})
+	case "application/reports+json":
+		var reports []struct {
+			Type      string          `json:"type"`
+			URL       string          `json:"url"`
+			UserAgent string          `json:"user_agent"`
+			Body      json.RawMessage `json:"body"`
+		}
+		if err := json.Unmarshal(ctx.PostBody(), &reports); err != nil {
+			ctx.Error("Bad Request", fasthttp.StatusBadRequest)
+			return
+		}
+		for _, report := range reports {
+			logEvent(ReportEvent{
+				Event:     "report",
+				Time:      now,
+				Type:      report.Type,
+				URL:       report.URL,
+				UserAgent: logUserAgent(report.UserAgent),
+				RemoteIP:  remoteIP,
+				Body:      report.Body,
+			})
+		}
+	default:
+		ctx.Error("Unsupported Media Type", fasthttp.StatusUnsupportedMediaType)
+		return
+	}
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
@@ -0,0 +1,163 @@
+package nanoweb
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Caps on what a request may carry, as nothing served needs much. Headers
+// past MAX_HEADER_SIZE (which includes the URL) are refused with a 431 as
+// they're read, longer URLs than MAX_URL_LENGTH with a 414, more than
+// MAX_HEADERS headers with a 431, and GET, HEAD and OPTIONS requests with a
+// body, or bodies over the limit, with a 413 before the body is read.
+var maxURLLength = getIntLimit("MAX_URL_LENGTH", "8192")
+var maxHeaders = getIntLimit("MAX_HEADERS", "100")
+var maxHeaderSize = getMaxHeaderSize()
+
+func getIntLimit(name string, fallback string) int {
+	limit, err := strconv.Atoi(getEnv(name, fallback))
+	if err != nil || limit < 0 {
+		configError("invalid %s %q", name, getEnv(name, ""))
+		return 0
+	}
+	return limit
+}
+
+func getMaxHeaderSize() int64 {
+	size, err := parseSize(getEnv("MAX_HEADER_SIZE", "4KB"))
+	if err != nil {
+		configError("invalid MAX_HEADER_SIZE: %s", err)
+		return 0
+	}
+	return size
+}
+
+// Refuse requests over the limits before they're handled
+func limitRequests(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		switch {
+		case maxURLLength > 0 && len(ctx.RequestURI()) > maxURLLength:
+			ctx.Error("URI Too Long", fasthttp.StatusRequestURITooLong)
+			auditDenied(ctx, "url_length")
+		case maxHeaders > 0 && ctx.Request.Header.Len() > maxHeaders:
+			ctx.Error("Request Header Fields Too Large", fasthttp.StatusRequestHeaderFieldsTooLarge)
+			auditDenied(ctx, "header_count")
+		default:
+			next(ctx)
+		}
+	}
+}
+
+// Whether a request has a body, either with a length or chunked (-1)
+func hasBody(header *fasthttp.RequestHeader) bool {
+	length := header.ContentLength()
+	return length > 0 || length == -1
+}
+
+// The largest body a request may have
+func bodyLimit(method string, path string) int {
+	if size := deployer.bodySize(method, path); size > 0 {
+		return size
+	}
+	return fasthttp.DefaultMaxRequestBodySize
+}
+
+// The rule a body breaks, from the headers alone
+func refusedBody(header *fasthttp.RequestHeader, path string) string {
+	if !hasBody(header) {
+		return ""
+	}
+	if header.IsGet() || header.IsHead() || header.IsOptions() {
+		return "unexpected_body"
+	}
+	if header.ContentLength() > bodyLimit(string(header.Method()), path) {
+		return "body_size"
+	}
+	return ""
+}
+
+// Clients waiting on Expect: 100-continue are refused before sending a body
+func continueBody(header *fasthttp.RequestHeader) bool {
+	uri := fasthttp.AcquireURI()
+	defer fasthttp.ReleaseURI(uri)
+	if err := uri.Parse(nil, header.RequestURI()); err != nil {
+		header.SetConnectionClose()
+		return false
+	}
+	if refusedBody(header, string(uri.Path())) == "" {
+		return true
+	}
+	// fasthttp skips the handler for the rest of a connection once a
+	// continue has been refused
+	header.SetConnectionClose()
+	return false
+}
+
+// Bodies are streamed in rather than read with the headers, so they can be
+// refused from the headers alone, with no more than fasthttp's 8KB prefetch
+// read. Everything else's body is read into memory, up to the limit, before
+// anything handles the request. Refused bodies are left unread, so their
+// connections are closed.
+func limitBodies(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if rule := refusedBody(&ctx.Request.Header, string(ctx.Path())); rule != "" {
+			refuseBody(ctx, rule)
+			return
+		}
+		if stream := ctx.RequestBodyStream(); stream != nil {
+			limit := bodyLimit(string(ctx.Method()), string(ctx.Path()))
+			body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+			switch {
+			case err != nil:
+				ctx.Error("Bad Request", fasthttp.StatusBadRequest)
+				ctx.SetConnectionClose()
+				observeRefused(ctx)
+				return
+			case len(body) > limit:
+				refuseBody(ctx, "body_size")
+				return
+			}
+			ctx.Request.SetBody(body)
+		}
+		next(ctx)
+	}
+}
+
+func refuseBody(ctx *fasthttp.RequestCtx, rule string) {
+	ctx.Error("Content Too Large", fasthttp.StatusRequestEntityTooLarge)
+	ctx.SetConnectionClose()
+	auditDenied(ctx, rule)
+	observeRefused(ctx)
+}
+
+// Answer requests fasthttp couldn't read as it would, but counted in the
+// metrics like any other response
+func requestErrorHandler(ctx *fasthttp.RequestCtx, err error) {
+	var small *fasthttp.ErrSmallBuffer
+	var netErr *net.OpError
+	switch {
+	case errors.As(err, &small):
+		ctx.Error("Request Header Fields Too Large", fasthttp.StatusRequestHeaderFieldsTooLarge)
+		auditDenied(ctx, "header_size")
+	case errors.As(err, &netErr) && netErr.Timeout():
+		ctx.Error("Request Timeout", fasthttp.StatusRequestTimeout)
+	default:
+		ctx.Error("Error when parsing request", fasthttp.StatusBadRequest)
+	}
+	observeRefused(ctx)
+}
+
+// Count a request answered before it reached the handlers
+func observeRefused(ctx *fasthttp.RequestCtx) {
+	recordRequestStats(ctx.Response.StatusCode(), 0)
+	metrics.ObserveRequest(RequestMetric{
+		Host:   string(ctx.Host()),
+		Method: string(ctx.Method()),
+		Status: ctx.Response.StatusCode(),
+		Bytes:  responseSize(ctx),
+	})
+}
@@ -0,0 +1,130 @@
+package nanoweb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// Serve raw requests through limitBodies, answering with the body length
+func limitedServer(t *testing.T) *fasthttputil.InmemoryListener {
+	t.Helper()
+	listener := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{
+		Handler: limitBodies(func(ctx *fasthttp.RequestCtx) {
+			fmt.Fprintf(ctx, "%d", len(ctx.PostBody()))
+		}),
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+		ContinueHandler:              continueBody,
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Shutdown() })
+	return listener
+}
+
+func roundTrip(t *testing.T, conn net.Conn, request string) *fasthttp.Response {
+	t.Helper()
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+	response := &fasthttp.Response{}
+	if err := response.Read(bufio.NewReader(conn)); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestRefusedBody(t *testing.T) {
+	previous := deployer
+	deployer = &Deployer{MaxSize: 10 << 20}
+	t.Cleanup(func() { deployer = previous })
+
+	tests := []struct {
+		method string
+		path   string
+		length int
+		rule   string
+	}{
+		{"GET", "/", 0, ""},
+		{"GET", "/", 1, "unexpected_body"},
+		{"HEAD", "/", -1, "unexpected_body"},
+		{"OPTIONS", "/", 10, "unexpected_body"},
+		{"POST", "/", fasthttp.DefaultMaxRequestBodySize, ""},
+		{"POST", "/", fasthttp.DefaultMaxRequestBodySize + 1, "body_size"},
+		{"POST", "/", -1, ""},
+		{"POST", deployPath, 10 << 20, ""},
+		{"POST", deployPath, 10<<20 + 1, "body_size"},
+		{"PUT", deployPath, fasthttp.DefaultMaxRequestBodySize + 1, "body_size"},
+		{"POST", deployPath + "/rollback", fasthttp.DefaultMaxRequestBodySize + 1, "body_size"},
+		{"POST", deployPath + "X", fasthttp.DefaultMaxRequestBodySize + 1, "body_size"},
+		{"POST", deployPath + "s/upload", fasthttp.DefaultMaxRequestBodySize + 1, "body_size"},
+	}
+	for _, test := range tests {
+		header := &fasthttp.RequestHeader{}
+		header.SetMethod(test.method)
+		header.SetContentLength(test.length)
+		if rule := refusedBody(header, test.path); rule != test.rule {
+			t.Errorf("%s %s with %d: %q, want %q", test.method, test.path, test.length, rule, test.rule)
+		}
+	}
+}
+
+func TestLimitBodies(t *testing.T) {
+	listener := limitedServer(t)
+	chunked := fmt.Sprintf("%x\r\n%s\r\n0\r\n\r\n", fasthttp.DefaultMaxRequestBodySize+1, strings.Repeat("a", fasthttp.DefaultMaxRequestBodySize+1))
+	tests := []struct {
+		name    string
+		request string
+		status  int
+		body    string
+	}{
+		{"small body", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 3\r\n\r\nabc", 200, "3"},
+		{"chunked body", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n", 200, "3"},
+		{"large body", fmt.Sprintf("POST / HTTP/1.1\r\nHost: x\r\nContent-Length: %d\r\n\r\n", 1<<20) + strings.Repeat("a", 1<<20), 200, fmt.Sprint(1 << 20)},
+		// Only the first of 100MB is sent, so these must be refused unread
+		{"GET body", "GET / HTTP/1.1\r\nHost: x\r\nContent-Length: 100000000\r\n\r\n" + strings.Repeat("a", 16<<10), 413, ""},
+		{"too large", "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 100000000\r\n\r\n" + strings.Repeat("a", 16<<10), 413, ""},
+		{"chunked too large", "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n" + chunked, 413, ""},
+		{"continue refused", "POST / HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\nContent-Length: 100000000\r\n\r\n", 417, ""},
+	}
+	for _, test := range tests {
+		conn, err := listener.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := roundTrip(t, conn, test.request)
+		if status := response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, status, test.status)
+		} else if test.body != "" && string(response.Body()) != test.body {
+			t.Errorf("%s: body %q, want %q", test.name, response.Body(), test.body)
+		}
+		// Refused bodies are left on the connection, so it mustn't be reused
+		if test.status != 200 && !response.ConnectionClose() {
+			t.Errorf("%s: connection kept open", test.name)
+		}
+		if test.status == 200 {
+			if next := roundTrip(t, conn, "GET / HTTP/1.1\r\nHost: x\r\n\r\n"); next.StatusCode() != 200 || string(next.Body()) != "0" {
+				t.Errorf("%s: next request got %d %q", test.name, next.StatusCode(), next.Body())
+			}
+		}
+		conn.Close()
+	}
+}
+
+// MAX_HEADER_SIZE defaults to the documented 4KB itself
+func TestMaxHeaderSizeDefault(t *testing.T) {
+	if size := getMaxHeaderSize(); size != 4<<10 {
+		t.Errorf("MAX_HEADER_SIZE defaults to %d bytes, want 4KB", size)
+	}
+	t.Setenv("MAX_HEADER_SIZE", "16KB")
+	if size := getMaxHeaderSize(); size != 16<<10 {
+		t.Errorf("MAX_HEADER_SIZE=16KB gives %d bytes", size)
+	}
+}
@@ -0,0 +1,73 @@
+package nanoweb
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RESCAN_INTERVAL reloads sites whose files have changed on a timer, e.g. when
+// content is rsynced into the public dir
+func getRescanInterval() time.Duration {
+	interval, err := time.ParseDuration(getEnv("RESCAN_INTERVAL", "0"))
+	if err != nil || interval < 0 {
+		configError("invalid RESCAN_INTERVAL %q", getEnv("RESCAN_INTERVAL", ""))
+		return 0
+	}
+	return interval
+}
+
+// A hash over the name, size and modification time of every file a site is
+// populated from
+func (site *Site) fingerprint() string {
+	hash := sha256.New()
+	dirs := []string{site.PublicDir}
+	for _, mount := range site.Mounts {
+		dirs = append(dirs, mount.Dir)
+	}
+	for _, dir := range dirs {
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			fmt.Fprintln(hash, dir, err)
+			continue
+		}
+		filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+			if info, err := entry.Info(); err == nil {
+				fmt.Fprintln(hash, name, info.Size(), info.ModTime().UnixNano())
+			}
+			return nil
+		})
+	}
+	if info, err := os.Stat(site.getHeadersFile(site.PublicDir)); err == nil {
+		fmt.Fprintln(hash, info.Size(), info.ModTime().UnixNano())
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+func rescanSites(interval time.Duration) {
+	fingerprints := make(map[*Site]string)
+	for _, site := range sites {
+		if site.FS == nil {
+			fingerprints[site] = site.fingerprint()
+		}
+	}
+	for range time.Tick(interval) {
+		for site, previous := range fingerprints {
+			fingerprint := site.fingerprint()
+			if fingerprint == previous {
+				continue
+			}
+			logln("⇨", site.PublicDir, "changed, reloading")
+			fingerprints[site] = fingerprint
+			reloadMu.Lock()
+			site.Reload()
+			reloadMu.Unlock()
+		}
+	}
+}
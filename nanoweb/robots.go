@@ -0,0 +1,27 @@
+package nanoweb
+
+import "time"
+
+const robotsAllowAll = "User-agent: *\nDisallow:\n"
+const robotsDisallowAll = "User-agent: *\nDisallow: /\n"
+
+var profile = getEnv("PROFILE", "production")
+
+func isStaging() bool {
+	return profile == "staging"
+}
+
+// Generate a robots.txt if the public dir doesn't have one. Staging always
+// gets a disallow-all robots.txt so previews never get indexed by accident.
+func populateRobots(routes Routes) {
+	if isStaging() {
+		logln("⇨ adding route /robots.txt → generated (staging)")
+		routes["/robots.txt"] = makeContentRoute([]byte(robotsDisallowAll), "text/plain", time.Now())
+		return
+	}
+	if _, exists := routes["/robots.txt"]; exists || getEnv("ROBOTS_TXT", "0") != "1" {
+		return
+	}
+	logln("⇨ adding route /robots.txt → generated")
+	routes["/robots.txt"] = makeContentRoute([]byte(robotsAllowAll), "text/plain", time.Now())
+}
@@ -0,0 +1,70 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+type RouteInfo struct {
+	Path         string `json:"path"`
+	Source       string `json:"source,omitempty"`
+	ContentType  string `json:"contentType"`
+	CacheControl string `json:"cacheControl,omitempty"`
+	Size         int    `json:"size"`
+	GzipSize     int    `json:"gzipSize,omitempty"`
+	BrotliSize   int    `json:"brotliSize,omitempty"`
+}
+
+// Every route in a table, including index aliases and generated routes
+func getRouteInfo(table *RouteTable) []RouteInfo {
+	infos := []RouteInfo{}
+	for path, route := range table.Routes {
+		gzip, brotli := route.compressedSizes()
+		infos = append(infos, RouteInfo{
+			Path:         path,
+			Source:       route.Source,
+			ContentType:  route.ContentType,
+			CacheControl: route.getHeader("Cache-Control"),
+			Size:         route.PlainLen,
+			GzipSize:     gzip,
+			BrotliSize:   brotli,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Path < infos[j].Path
+	})
+	return infos
+}
+
+// Populate a directory and print the route table it makes
+func routesCommand(args []string) int {
+	flags := flag.NewFlagSet("routes", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print JSON instead of a table")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	site, err := getCommandSite(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	infos := getRouteInfo(site.Build(site.PublicDir))
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(infos)
+		return 0
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "PATH\tSOURCE\tTYPE\tSIZE\tGZIP\tBROTLI\tCACHE-CONTROL")
+	for _, info := range infos {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n", info.Path, info.Source, info.ContentType,
+			info.Size, info.GzipSize, info.BrotliSize, info.CacheControl)
+	}
+	writer.Flush()
+	return 0
+}
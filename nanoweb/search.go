@@ -0,0 +1,170 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"html"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/valyala/fasthttp"
+)
+
+const searchPath = "/__search"
+const searchSnippetRunes = 160
+
+var searchEnabled = getEnv("SEARCH", "0") == "1"
+
+var (
+	titleRegexp  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	ignoreRegexp = regexp.MustCompile(`(?is)<(script|style|noscript|template)[^>]*>.*?</(script|style|noscript|template)>`)
+	tagRegexp    = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRegexp  = regexp.MustCompile(`\s+`)
+)
+
+type searchDocument struct {
+	Path  string
+	Title string
+	Text  string
+}
+
+type SearchIndex struct {
+	documents []searchDocument
+	terms     map[string]map[int]int
+}
+
+type SearchResult struct {
+	Title   string  `json:"title"`
+	Path    string  `json:"path"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+func newSearchIndex() *SearchIndex {
+	return &SearchIndex{terms: make(map[string]map[int]int)}
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Strip markup from an HTML document, returning its title and visible text
+func extractText(dat []byte) (string, string) {
+	title := ""
+	if match := titleRegexp.FindSubmatch(dat); match != nil {
+		title = strings.TrimSpace(html.UnescapeString(string(match[1])))
+	}
+	text := titleRegexp.ReplaceAll(dat, nil)
+	text = ignoreRegexp.ReplaceAll(text, nil)
+	text = tagRegexp.ReplaceAll(text, []byte(" "))
+	return title, strings.TrimSpace(spaceRegexp.ReplaceAllString(html.UnescapeString(string(text)), " "))
+}
+
+func (index *SearchIndex) add(path string, dat []byte) {
+	title, text := extractText(dat)
+	if title == "" {
+		title = path
+	}
+	doc := len(index.documents)
+	index.documents = append(index.documents, searchDocument{Path: path, Title: title, Text: text})
+	for _, term := range tokenize(title + " " + text) {
+		postings, exists := index.terms[term]
+		if !exists {
+			postings = make(map[int]int)
+			index.terms[term] = postings
+		}
+		postings[doc]++
+	}
+}
+
+// Rank documents by tf-idf over the query terms
+func (index *SearchIndex) search(query string, limit int) []SearchResult {
+	terms := tokenize(query)
+	scores := make(map[int]float64)
+	for _, term := range terms {
+		postings := index.terms[term]
+		if len(postings) == 0 {
+			continue
+		}
+		idf := math.Log(1 + float64(len(index.documents))/float64(len(postings)))
+		for doc, count := range postings {
+			scores[doc] += (1 + math.Log(float64(count))) * idf
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for doc, score := range scores {
+		document := index.documents[doc]
+		results = append(results, SearchResult{
+			Title:   document.Title,
+			Path:    document.Path,
+			Snippet: snippet(document.Text, terms),
+			Score:   math.Round(score*1000) / 1000,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// Cut a window of text around the first occurrence of any of the terms
+func snippet(text string, terms []string) string {
+	runes := []rune(text)
+	lower := strings.ToLower(text)
+	start := 0
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 {
+			start = len([]rune(lower[:i])) - searchSnippetRunes/4
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > len(runes) {
+		start = len(runes)
+	}
+	end := start + searchSnippetRunes
+	if end > len(runes) {
+		end = len(runes)
+	}
+	result := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(runes) {
+		result += "…"
+	}
+	return result
+}
+
+func searchHandler(ctx *fasthttp.RequestCtx, searchIndex *SearchIndex) {
+	query := string(ctx.QueryArgs().Peek("q"))
+	limit, err := strconv.Atoi(string(ctx.QueryArgs().Peek("limit")))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 10
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"query":   query,
+		"results": searchIndex.search(query, limit),
+	})
+	if err != nil {
+		ctx.Error("Internal Server Error", fasthttp.StatusInternalServerError)
+		return
+	}
+	ctx.Response.Header.Set("Content-Type", "application/json")
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	ctx.SetBody(body)
+}
@@ -0,0 +1,57 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	previous := searchEnabled
+	searchEnabled = true
+	t.Cleanup(func() { searchEnabled = previous })
+	testSite(t, map[string]string{
+		"index.html":       "<html><head><title>Home</title></head><body>Welcome to the bakery</body></html>",
+		"bread/index.html": "<html><head><title>Bread</title></head><body>Sourdough bread, bread and more bread</body></html>",
+		"cakes.html":       "<html><head><title>Cakes</title><script>var bread = 1</script></head><body>Cakes and one bread roll</body></html>",
+		"app.js":           "bread",
+	})
+
+	tests := []struct {
+		uri   string
+		paths []string
+	}{
+		// Ranked by how often the term appears, not counting scripts or
+		// files that aren't pages
+		{"/__search?q=bread", []string{"/bread/", "/cakes.html"}},
+		{"/__search?q=BAKERY", []string{"/"}},
+		{"/__search?q=bread&limit=1", []string{"/bread/"}},
+		{"/__search?q=croissant", nil},
+		{"/__search", nil},
+	}
+	for _, test := range tests {
+		ctx := serve(test.uri)
+		if contentType := string(ctx.Response.Header.ContentType()); contentType != "application/json" {
+			t.Errorf("%s: Content-Type %q", test.uri, contentType)
+		}
+		var response struct {
+			Results []SearchResult `json:"results"`
+		}
+		if err := json.Unmarshal(ctx.Response.Body(), &response); err != nil {
+			t.Fatalf("%s: %s", test.uri, err)
+		}
+		paths := []string{}
+		for _, result := range response.Results {
+			paths = append(paths, result.Path)
+		}
+		if len(paths) != len(test.paths) {
+			t.Errorf("%s: results %v, want %v", test.uri, paths, test.paths)
+			continue
+		}
+		for i := range paths {
+			if paths[i] != test.paths[i] {
+				t.Errorf("%s: results %v, want %v", test.uri, paths, test.paths)
+				break
+			}
+		}
+	}
+}
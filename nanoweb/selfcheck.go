@@ -0,0 +1,135 @@
+package nanoweb
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// SELF_CHECK_PATH is fetched through the server's own listener on an
+// interval, checking the status and that the content matches its route, so
+// silent breakage shows up in /__health and metrics. HEARTBEAT_URL is pinged
+// after every passing check, for uptime monitors that alert on silence.
+type SelfCheck struct {
+	URL       string
+	Path      string
+	Interval  time.Duration
+	Heartbeat string
+
+	probeClient *http.Client
+	client      *http.Client
+}
+
+type SelfCheckResult struct {
+	OK       bool          `json:"ok"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+var selfCheckResult atomic.Pointer[SelfCheckResult]
+
+func getSelfCheck(addr string, https bool) *SelfCheck {
+	path := getEnv("SELF_CHECK_PATH", "")
+	if path == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(getEnv("SELF_CHECK_INTERVAL", "30s"))
+	if err != nil || interval <= 0 {
+		configError("invalid SELF_CHECK_INTERVAL %q", getEnv("SELF_CHECK_INTERVAL", ""))
+		return nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		configError("can't self-check %s: %s", addr, err)
+		return nil
+	}
+	host = loopbackHost(host)
+	check := &SelfCheck{
+		URL:       "http://" + net.JoinHostPort(host, port),
+		Path:      path,
+		Interval:  interval,
+		Heartbeat: getEnv("HEARTBEAT_URL", ""),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	check.probeClient = check.client
+	if https {
+		// The certificate is for the public name, not the loopback address
+		check.URL = "https://" + net.JoinHostPort(host, port)
+		check.probeClient = &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		}
+	}
+	return check
+}
+
+func (check *SelfCheck) Run() SelfCheckResult {
+	start := time.Now()
+	err := check.probe()
+	result := SelfCheckResult{OK: err == nil, Time: start, Duration: time.Since(start)}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (check *SelfCheck) probe() error {
+	req, err := http.NewRequest(http.MethodGet, check.URL+check.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+	if basicAuth != nil {
+		req.Header.Set("Authorization", basicAuth.internal)
+	}
+	res, err := check.probeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", check.Path, res.Status)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, res.Body); err != nil {
+		return err
+	}
+	// Only the default build can be checked, not a canary or preview
+	table := defaultSite.Table()
+	route, exists := table.Routes[check.Path]
+	if exists && res.Header.Get("X-Deploy-Id") == table.DeployID && hex.EncodeToString(hash.Sum(nil)) != route.Hash {
+		return fmt.Errorf("GET %s: content doesn't match deploy %s", check.Path, table.DeployID)
+	}
+	return nil
+}
+
+func (check *SelfCheck) Watch() {
+	for {
+		result := check.Run()
+		if !result.OK {
+			logln("⇨ self-check failed:", result.Error)
+		} else if previous := selfCheckResult.Load(); previous != nil && !previous.OK {
+			logln("⇨ self-check passing again")
+		}
+		selfCheckResult.Store(&result)
+		if statsd, ok := metrics.(*StatsdMetrics); ok {
+			statsd.send("nano_web.self_check.ok:%d|g\nnano_web.self_check_duration:%d|ms",
+				map[bool]int{true: 1, false: 0}[result.OK], result.Duration.Milliseconds())
+		}
+		if result.OK && check.Heartbeat != "" {
+			if res, err := check.client.Get(check.Heartbeat); err != nil {
+				logln("⇨ error sending heartbeat", err)
+			} else {
+				res.Body.Close()
+			}
+		}
+		time.Sleep(check.Interval)
+	}
+}
@@ -0,0 +1,360 @@
+package nanoweb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/valyala/fasthttp"
+)
+
+// Serves sites from memory. Sites and their routes are shared by the
+// package, so there's one Server per process.
+type Server struct {
+	Addr string
+	// Serve the built-in endpoints here instead of on Addr
+	AdminAddr string
+	// Serve HTTPS on Addr with this certificate and key
+	TLSCert string
+	TLSKey  string
+	// TLS versions, cipher suites and OCSP stapling, Go defaults when nil
+	TLSPolicy *TLSPolicy
+	// Also serve HTTP/3 over QUIC, which needs TLS
+	HTTP3 bool
+	Sites []*Site
+	http  *fasthttp.Server
+	admin *fasthttp.Server
+	h3    *http3.Server
+	done  chan error
+	// Background work configured by the environment, started with the server
+	rescanInterval    time.Duration
+	configMapInterval time.Duration
+	check             *SelfCheck
+	pusher            *MetricsPusher
+}
+
+type Option func(*Server) error
+
+// Listen on addr, e.g. ":8080" or "[::1]:8080". Defaults to "$BIND:$PORT"
+func WithAddr(addr string) Option {
+	return func(server *Server) error {
+		server.Addr = addr
+		return nil
+	}
+}
+
+// Serve the built-in endpoints and pprof on a separate address, e.g.
+// "127.0.0.1:9090". Defaults to $ADMIN_ADDR
+func WithAdminAddr(addr string) Option {
+	return func(server *Server) error {
+		server.AdminAddr = addr
+		return nil
+	}
+}
+
+// Serve HTTPS with a PEM certificate (chain) and key file. Defaults to
+// $TLS_CERT and $TLS_KEY
+func WithTLS(certFile string, keyFile string) Option {
+	return func(server *Server) error {
+		server.TLSCert = certFile
+		server.TLSKey = keyFile
+		return nil
+	}
+}
+
+// Restrict TLS versions and cipher suites, or staple OCSP responses.
+// Defaults to $TLS_MIN_VERSION, $TLS_CIPHERS and $TLS_OCSP_STAPLING
+func WithTLSPolicy(policy TLSPolicy) Option {
+	return func(server *Server) error {
+		server.TLSPolicy = &policy
+		return nil
+	}
+}
+
+// Also serve HTTP/3 on the same port. Defaults to $HTTP3
+func WithHTTP3() Option {
+	return func(server *Server) error {
+		server.HTTP3 = true
+		return nil
+	}
+}
+
+// Serve these sites instead of the ones configured by the environment. The
+// first is the default unless another has Default set.
+func WithSites(sites ...*Site) Option {
+	return func(server *Server) error {
+		for _, site := range sites {
+			if _, err := newSite(site); err != nil {
+				return err
+			}
+		}
+		server.Sites = append(server.Sites, sites...)
+		return nil
+	}
+}
+
+// Wrap the request handler, e.g. to add middleware
+func WithMiddleware(wrap func(fasthttp.RequestHandler) fasthttp.RequestHandler) Option {
+	return func(server *Server) error {
+		server.http.Handler = wrap(server.http.Handler)
+		return nil
+	}
+}
+
+func NewServer(options ...Option) (*Server, error) {
+	server := &Server{
+		Addr:      getBindAddr(),
+		AdminAddr: getEnv("ADMIN_ADDR", ""),
+		TLSCert:   getEnv("TLS_CERT", ""),
+		TLSKey:    getEnv("TLS_KEY", ""),
+		HTTP3:     getEnv("HTTP3", "0") == "1",
+		http:      &fasthttp.Server{Handler: observeRequests(limitRequests(handler))},
+		admin:     &fasthttp.Server{Handler: adminHandler},
+		done:      make(chan error, 2),
+	}
+	server.http.ErrorHandler = requestErrorHandler
+	server.http.ReadBufferSize = int(maxHeaderSize)
+	// Bodies are read by limitBodies once their headers have been checked
+	server.http.StreamRequestBody = true
+	server.http.DisablePreParseMultipartForm = true
+	server.http.ContinueHandler = continueBody
+	policy, err := getTLSPolicy()
+	if err != nil {
+		return nil, err
+	}
+	server.TLSPolicy = policy
+	if err := configErr(); err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		if err := option(server); err != nil {
+			return nil, err
+		}
+	}
+	if len(server.Sites) == 0 {
+		loaded, err := loadSites()
+		if err != nil {
+			return nil, err
+		}
+		server.Sites = loaded
+	}
+	if (server.TLSCert == "") != (server.TLSKey == "") {
+		return nil, errors.New("TLS needs both a certificate and a key")
+	}
+	if server.HTTP3 && server.TLSCert == "" {
+		return nil, errors.New("HTTP/3 needs TLS_CERT and TLS_KEY")
+	}
+	sites = server.Sites
+	defaultSite = getDefaultSite(sites)
+	adminAddr = server.AdminAddr
+	server.configure()
+	if err := configErr(); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// Set up what the environment configures beyond the sites: the default
+// site's integrity manifest, canary, previews and slots, the middleware
+// around the request handler and the background work Start begins
+func (server *Server) configure() {
+	defaultSite.integrity = getIntegrity()
+	defaultSite.canary = getCanary()
+	defaultSite.previews = getPreviews()
+	if slots := getSlots(); slots != nil {
+		slots.Start(defaultSite)
+	}
+	if deployer != nil {
+		server.admin.HeaderReceived = deployer.requestConfig
+	}
+	if mirror := getMirror(); mirror != nil {
+		server.http.Handler = mirror.wrap(server.http.Handler)
+	}
+	if hooks := getLuaHooks(); hooks != nil {
+		server.http.Handler = hooks.wrap(server.http.Handler)
+	}
+	if chaos := getChaos(); chaos != nil {
+		server.http.Handler = chaos.wrap(server.http.Handler)
+	}
+	if alerts := getAlerts(); alerts != nil {
+		server.http.Handler = alerts.wrap(server.http.Handler)
+	}
+	if geoip := getGeoIP(); geoip != nil {
+		server.http.Handler = geoip.wrap(server.http.Handler)
+	}
+	exitAfter(server.http)
+	server.rescanInterval = getRescanInterval()
+	server.configMapInterval = getConfigMapInterval()
+	server.check = getSelfCheck(server.Addr, server.TLSCert != "")
+	server.pusher = getMetricsPusher()
+}
+
+// Fetch the content from the bucket, git repository or OCI artifact the
+// environment configures, before the sites are first populated
+func syncSources() error {
+	if bucketSource != nil {
+		logln("⇨ syncing bucket", bucketSource.Bucket, "→", bucketSource.CacheDir)
+		if _, err := bucketSource.Sync(); err != nil {
+			return fmt.Errorf("syncing bucket %s: %w", bucketSource.Bucket, err)
+		}
+	}
+	if gitSource != nil {
+		logln("⇨ checking out", gitSource.URL, gitSource.Branch, "→", gitSource.Dir)
+		commit, _, err := gitSource.Sync()
+		if err != nil {
+			return fmt.Errorf("checking out git repository: %w", err)
+		}
+		defaultSite.SetDeployID(commit)
+	}
+	if ociSource != nil {
+		logln("⇨ pulling", ociSource.Registry+"/"+ociSource.Name, "→", ociSource.CacheDir)
+		digest, _, err := ociSource.Sync()
+		if err != nil {
+			return fmt.Errorf("pulling OCI artifact: %w", err)
+		}
+		ociSource.current = digest
+		defaultSite.SetDeployID(digest)
+	}
+	if deployID := getEnv("DEPLOY_ID", ""); deployID != "" {
+		defaultSite.SetDeployID(deployID)
+	}
+	return nil
+}
+
+// Start the background work configured by the environment: watching content
+// sources, rescanning, rebalancing the memory cache, self checks and pushing
+// metrics
+func (server *Server) watch() {
+	if bucketSource != nil {
+		go bucketSource.Watch(defaultSite)
+	}
+	if gitSource != nil {
+		go gitSource.Watch(defaultSite)
+	}
+	if ociSource != nil {
+		go ociSource.Watch(defaultSite)
+	}
+	if maxCacheBytes > 0 {
+		go rebalanceMemoryCaches()
+	}
+	if server.rescanInterval > 0 {
+		go rescanSites(server.rescanInterval)
+	}
+	if configMapWatch {
+		go watchConfigMaps(server.configMapInterval)
+	}
+	if server.check != nil {
+		go server.check.Watch()
+	}
+	if server.pusher != nil {
+		go server.pusher.Watch()
+	}
+}
+
+// Sync the content sources, populate the sites and start listening, serving
+// in the background. Sites that can't be populated, e.g. in STRICT mode, stop
+// it starting.
+func (server *Server) Start() error {
+	if err := syncSources(); err != nil {
+		return err
+	}
+	if err := reloadSites(); err != nil {
+		return err
+	}
+	listener, err := net.Listen(listenNetwork("tcp", server.Addr), server.Addr)
+	if err != nil {
+		return err
+	}
+	if server.AdminAddr != "" {
+		adminListener, err := net.Listen(listenNetwork("tcp", server.AdminAddr), server.AdminAddr)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		go func() {
+			server.done <- server.admin.Serve(adminListener)
+		}()
+	}
+	if server.TLSCert != "" {
+		config, err := server.tlsConfig()
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		server.http.TLSConfig = config
+	}
+	server.http.Handler = recoverPanics(limitBodies(server.http.Handler))
+	if server.HTTP3 {
+		if err := server.startHTTP3(); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	go func() {
+		if server.TLSCert != "" {
+			server.done <- server.http.ServeTLS(listener, "", "")
+		} else {
+			server.done <- server.http.Serve(listener)
+		}
+	}()
+	server.watch()
+	return nil
+}
+
+// Wait for the server to stop
+func (server *Server) Wait() error {
+	return <-server.done
+}
+
+// Stop accepting connections and wait for open ones to finish
+func (server *Server) Shutdown(ctx context.Context) error {
+	if server.h3 != nil {
+		server.h3.Close()
+	}
+	if server.AdminAddr != "" {
+		if err := server.admin.ShutdownWithContext(ctx); err != nil {
+			return err
+		}
+	}
+	return server.http.ShutdownWithContext(ctx)
+}
+
+func (server *Server) listenAddrs() []string {
+	addrs := []string{server.Addr}
+	if server.HTTP3 {
+		addrs[0] += " (https, h3)"
+	} else if server.TLSCert != "" {
+		addrs[0] += " (https)"
+	}
+	if server.AdminAddr != "" {
+		addrs = append(addrs, server.AdminAddr+" (admin)")
+	}
+	return addrs
+}
+
+// Start a server configured by the environment, reloading on SIGHUP, and
+// serve until it stops
+func Serve() {
+	server, err := NewServer()
+	if err != nil {
+		logln("⇨ error configuring server", err)
+		os.Exit(-1)
+	}
+	if err := server.Start(); err != nil {
+		logln("⇨ error starting server", err)
+		os.Exit(-1)
+	}
+	go watchReloadSignal()
+	printStartupSummary(server.listenAddrs())
+	server.Wait()
+	// Push once more so short-lived runs aren't lost
+	if server.pusher != nil {
+		if err := server.pusher.Push(); err != nil {
+			logln("⇨ error pushing metrics", err)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package nanoweb
+
+import (
+	"fmt"
+	"os"
+)
+
+func serviceCommand(args []string) int {
+	fmt.Fprintln(os.Stderr, "services are only supported on Windows, use systemd or similar elsewhere")
+	return 1
+}
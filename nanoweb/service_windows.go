@@ -0,0 +1,145 @@
+package nanoweb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "nano-web"
+
+// `service install [KEY=VALUE...]` registers a service that runs with the
+// given environment, `service uninstall` removes it and `service run` is what
+// the service manager starts
+func serviceCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: nano-web service install [KEY=VALUE...] | uninstall | run")
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "install":
+		err = installService(args[1:])
+	case "uninstall":
+		err = uninstallService()
+	case "run":
+		err = runService()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown service command %q\n", args[0])
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func installService(env []string) error {
+	for _, entry := range env {
+		if !strings.Contains(entry, "=") {
+			return fmt.Errorf("expected KEY=VALUE, got %q", entry)
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+	manager, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+	service, err := manager.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "nano-web",
+		Description: "Serves static sites",
+		StartType:   mgr.StartAutomatic,
+	}, "service", "run")
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	if len(env) > 0 {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+serviceName, registry.SET_VALUE)
+		if err != nil {
+			return err
+		}
+		defer key.Close()
+		if err := key.SetStringsValue("Environment", env); err != nil {
+			return err
+		}
+	}
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		service.Delete()
+		return err
+	}
+	fmt.Println("installed service", serviceName)
+	return nil
+}
+
+func uninstallService() error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer manager.Disconnect()
+	service, err := manager.OpenService(serviceName)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	if err := service.Delete(); err != nil {
+		return err
+	}
+	eventlog.Remove(serviceName)
+	fmt.Println("uninstalled service", serviceName)
+	return nil
+}
+
+// Sends log lines to the event log
+type eventLogWriter struct {
+	log *eventlog.Log
+}
+
+func (writer eventLogWriter) Write(p []byte) (int, error) {
+	return len(p), writer.log.Info(1, strings.TrimSpace(string(p)))
+}
+
+type windowsService struct{}
+
+func (windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	go Serve()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			status <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			logln("⇨ stopping service")
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+func runService() error {
+	log, err := eventlog.Open(serviceName)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	logOutput = eventLogWriter{log}
+	return svc.Run(serviceName, windowsService{})
+}
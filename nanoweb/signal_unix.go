@@ -0,0 +1,11 @@
+//go:build !windows
+
+package nanoweb
+
+import (
+	"os"
+	"syscall"
+)
+
+// Switches to the next slot
+var slotSignal os.Signal = syscall.SIGUSR1
@@ -0,0 +1,6 @@
+package nanoweb
+
+import "os"
+
+// Windows has no SIGUSR1, so slots are only switched through /__slots
+var slotSignal os.Signal
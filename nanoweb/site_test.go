@@ -0,0 +1,149 @@
+package nanoweb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Serve files from a temporary public dir as the only site
+func testSite(t *testing.T, files map[string]string) *Site {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	site, err := newSite(&Site{PublicDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := site.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	previousSites, previousDefault := sites, defaultSite
+	sites, defaultSite = []*Site{site}, site
+	t.Cleanup(func() {
+		sites, defaultSite = previousSites, previousDefault
+	})
+	return site
+}
+
+// Handle a GET for uri
+func serve(uri string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI(uri)
+	handler(ctx)
+	return ctx
+}
+
+// Handle a GET for uri with the given request headers
+func serveWith(uri string, headers map[string]string) *fasthttp.RequestCtx {
+	return serveMethod(fasthttp.MethodGet, uri, headers)
+}
+
+// Handle a request for uri with any method and the given request headers
+func serveMethod(method string, uri string, headers map[string]string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(uri)
+	for key, value := range headers {
+		ctx.Request.Header.Set(key, value)
+	}
+	handler(ctx)
+	return ctx
+}
+
+// A site that can't be populated before anything has been served returns an
+// error for the caller, rather than exiting whatever program embeds it
+func TestReloadUnservableReturnsError(t *testing.T) {
+	site, err := newSite(&Site{PublicDir: filepath.Join(t.TempDir(), "missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := site.Reload(); err == nil {
+		t.Error("no error reloading a missing public dir")
+	}
+	if routes := site.Table().Routes; len(routes) != 0 {
+		t.Errorf("served %d routes from a missing public dir", len(routes))
+	}
+}
+
+func TestNewServerReturnsConfigErrors(t *testing.T) {
+	previous := configErrors
+	t.Cleanup(func() { configErrors = previous })
+	configErrors = nil
+	configError("invalid %s %q", "TRAILING_SLASH", "sometimes")
+	if _, err := NewServer(WithSites(&Site{PublicDir: t.TempDir()})); err == nil || err.Error() != `invalid TRAILING_SLASH "sometimes"` {
+		t.Errorf("error %v, want invalid TRAILING_SLASH", err)
+	}
+}
+
+// A source's new deploy ID is only stamped on the site if its reload succeeds
+func TestReloadDeploy(t *testing.T) {
+	site := testSite(t, map[string]string{"index.html": "home"})
+	if err := site.reloadDeploy("first"); err != nil || site.Table().DeployID != "first" {
+		t.Fatalf("reload: error %v, deploy %s", err, site.Table().DeployID)
+	}
+	os.RemoveAll(site.PublicDir)
+	if err := site.reloadDeploy("second"); err == nil {
+		t.Error("no error reloading a missing public dir")
+	}
+	if id := *site.deployID.Load(); id != "first" || site.Table().DeployID != "first" {
+		t.Errorf("after a refused reload stamped %s, serving %s", id, site.Table().DeployID)
+	}
+}
+
+// Embedding gets the features the environment configures, as the command does
+func TestNewServerConfiguresEnvFeatures(t *testing.T) {
+	previousSites, previousDefault := sites, defaultSite
+	t.Cleanup(func() { sites, defaultSite = previousSites, previousDefault })
+	dir := t.TempDir()
+	t.Setenv("SLOTS", "blue="+dir)
+	t.Setenv("CANARY_DIR", dir)
+	server, err := NewServer(WithSites(&Site{PublicDir: dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Sites[0].slots == nil || server.Sites[0].canary == nil {
+		t.Errorf("slots %v and canary %v not set up", server.Sites[0].slots, server.Sites[0].canary)
+	}
+}
+
+// Invalid feature settings stop the server starting rather than falling back
+func TestFeatureConfigErrors(t *testing.T) {
+	previous := configErrors
+	t.Cleanup(func() { configErrors = previous })
+	tests := []struct {
+		env map[string]string
+		get func() bool
+		err string
+	}{
+		{map[string]string{"CANARY_DIR": "canary", "CANARY_STICKY": "session"}, func() bool { return getCanary() == nil }, `invalid CANARY_STICKY "session"`},
+		{map[string]string{"CANARY_DIR": "canary", "CANARY_PERCENT": "110"}, func() bool { return getCanary() == nil }, `invalid CANARY_PERCENT "110", must be between 0 and 100`},
+		{map[string]string{"AB_VARIANTS": "a,b", "AB_SPLIT": "90,x"}, func() bool { return getABTest() == nil }, `invalid AB_SPLIT weight "x"`},
+		{map[string]string{"AB_VARIANTS": "a,b", "AB_SPLIT": "0,0"}, func() bool { return getABTest() == nil }, "AB_SPLIT gives every variant a weight of 0"},
+		{map[string]string{"PREVIEW_DIR": "previews", "PREVIEW_MAX": "0"}, func() bool { return getPreviews() == nil }, `invalid PREVIEW_MAX "0"`},
+	}
+	for _, test := range tests {
+		t.Run(test.err, func(t *testing.T) {
+			configErrors = nil
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			if !test.get() {
+				t.Error("configured anyway")
+			}
+			if err := configErr(); err == nil || err.Error() != test.err {
+				t.Errorf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package nanoweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// A site served by this process, selected by the request Host. Without a
+// SITES_FILE there's a single default site configured from the environment.
+type Site struct {
+	Hosts        []string `json:"hosts"`
+	PublicDir    string   `json:"publicDir"`
+	SpaMode      bool     `json:"spaMode"`
+	ConfigPrefix string   `json:"configPrefix"`
+	HeadersFile  string   `json:"headersFile"`
+	Default      bool     `json:"default"`
+	Mounts       Mounts   `json:"mounts"`
+
+	// Serve from a file system (such as an embed.FS) instead of PublicDir
+	FS fs.FS `json:"-"`
+
+	AppEnv    map[string]string `json:"-"`
+	table     atomic.Pointer[RouteTable]
+	deployID  atomic.Pointer[string]
+	slots     *Slots
+	canary    *Canary
+	previews  *Previews
+	integrity *Integrity
+	virtual   virtualRoutes
+	hostGlobs []*regexp.Regexp
+	memory    *memoryCache
+}
+
+// Everything built when populating a site, swapped in as a whole so requests
+// never see a partially populated site
+type RouteTable struct {
+	Routes   Routes
+	Search   *SearchIndex
+	DeployID string
+	// Anything wrong with the content, reported by the health check
+	Problems []string
+	// Bytes of file content held in memory
+	size int64
+	// Bytes of content counted against MAX_CACHE_BYTES while populating
+	cacheBytes int64
+	// Errors populating the table, which STRICT refuses to serve
+	errors []string
+	// Why the table is never served: a public dir or mount that couldn't be
+	// read at all, or a file over a limit with OVERSIZE=fail
+	unservable error
+	misses     missCache
+	// From the public dir's _redirects file, for paths no file matches
+	Redirects []RedirectRule
+}
+
+func newRouteTable() *RouteTable {
+	return &RouteTable{Routes: make(Routes), Search: newSearchIndex()}
+}
+
+// A short hash over every route and its content hash
+func (table *RouteTable) ContentHash() string {
+	paths := make([]string, 0, len(table.Routes))
+	for path := range table.Routes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	hash := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(hash, "%s %s\n", path, table.Routes[path].Hash)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+func (site *Site) Table() *RouteTable {
+	return site.table.Load()
+}
+
+// Set the deploy ID (such as a git commit) that reloads are stamped with,
+// instead of a hash of the content
+func (site *Site) SetDeployID(id string) {
+	site.deployID.Store(&id)
+}
+
+// Reload stamped with a new deploy ID, such as a commit a source moved to.
+// If the reload is refused the site keeps the ID of the table it's serving.
+func (site *Site) reloadDeploy(id string) error {
+	previous := site.deployID.Load()
+	site.SetDeployID(id)
+	if err := site.Reload(); err != nil {
+		site.deployID.Store(previous)
+		return err
+	}
+	return nil
+}
+
+// The configured headers file, or _headers in the public dir
+func (site *Site) getHeadersFile(publicDir string) string {
+	if site.HeadersFile != "" {
+		return site.HeadersFile
+	}
+	return filepath.Join(publicDir, "_headers")
+}
+
+// Populate a fresh route table from a public dir
+func (site *Site) Build(publicDir string) *RouteTable {
+	table := newRouteTable()
+	populateRoutes(site, table, publicDir)
+	site.populateVirtualRoutes(table.Routes, publicDir)
+	populateRobots(table.Routes)
+	if id := site.deployID.Load(); id != nil {
+		table.DeployID = *id
+	} else {
+		table.DeployID = table.ContentHash()
+	}
+	return table
+}
+
+// Populate a fresh route table and atomically swap it in, returning an error
+// if the table being served is kept instead
+func (site *Site) Reload() error {
+	start := time.Now()
+	loadTemplateData()
+	defer func() {
+		metrics.ReloadEvent(ReloadMetric{Hosts: site.Hosts, Routes: len(site.Table().Routes), Duration: time.Since(start)})
+		recordReloadStats(site, time.Since(start))
+	}()
+	if site.previews != nil {
+		site.previews.Reset()
+	}
+	if site.canary != nil {
+		site.canary.Reload(site)
+	}
+	if site.slots != nil {
+		return site.slots.Reload(site)
+	}
+	table := site.Build(site.PublicDir)
+	if err := site.check(table, site.PublicDir); err != nil {
+		return err
+	}
+	site.swapTable(table)
+	return nil
+}
+
+// Check a table built from dir can be swapped in, returning why not if the
+// table being served has to be kept instead
+func (site *Site) check(table *RouteTable, dir string) error {
+	if table.unservable != nil {
+		site.keepDeploy()
+		return table.unservable
+	}
+	if strictMode && !site.checkStrict(table, dir) {
+		return fmt.Errorf("%d errors populating %s", len(table.errors), dir)
+	}
+	if site.integrity != nil && !site.verify(table) {
+		return fmt.Errorf("%s doesn't match the integrity manifest", dir)
+	}
+	return nil
+}
+
+// Check a table against the integrity manifest. In strict mode a table that
+// doesn't match isn't served, and the server won't start with it.
+func (site *Site) verify(table *RouteTable) bool {
+	problems := site.integrity.Verify(table)
+	table.Problems = append(table.Problems, problems...)
+	if len(problems) == 0 {
+		return true
+	}
+	for _, problem := range problems {
+		logln("⇨ integrity check failed:", problem)
+	}
+	if !site.integrity.Strict {
+		return true
+	}
+	site.keepDeploy()
+	return false
+}
+
+// Log that the table being served is kept, if there is one. Before anything
+// has been served, the error Reload returns is for the caller to act on.
+func (site *Site) keepDeploy() {
+	if deployID := site.Table().DeployID; deployID != "" {
+		logln("⇨ keeping deploy", deployID)
+	}
+}
+
+// A directory served below a URL prefix, alongside the public dir
+type Mount struct {
+	Prefix string
+	Dir    string
+}
+
+type Mounts []Mount
+
+// Mounts are configured in JSON as an object of prefix to directory
+func (mounts *Mounts) UnmarshalJSON(dat []byte) error {
+	config := make(map[string]string)
+	if err := json.Unmarshal(dat, &config); err != nil {
+		return err
+	}
+	for prefix, dir := range config {
+		*mounts = append(*mounts, newMount(prefix, dir))
+	}
+	sort.Slice(*mounts, func(i, j int) bool {
+		return (*mounts)[i].Prefix < (*mounts)[j].Prefix
+	})
+	return nil
+}
+
+func newMount(prefix string, dir string) Mount {
+	return Mount{Prefix: "/" + strings.Trim(prefix, "/"), Dir: filepath.Clean(dir)}
+}
+
+// Parse MOUNTS, a comma separated list of `/prefix=dir` entries
+func parseMounts(config string) Mounts {
+	mounts := Mounts{}
+	for _, entry := range strings.Split(config, ",") {
+		prefix, dir, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || dir == "" {
+			continue
+		}
+		mounts = append(mounts, newMount(prefix, dir))
+	}
+	return mounts
+}
+
+var sites []*Site
+var defaultSite *Site
+
+func newSite(site *Site) (*Site, error) {
+	if site.PublicDir == "" && site.FS == nil {
+		return nil, fmt.Errorf("site %v has no publicDir", site.Hosts)
+	}
+	if site.ConfigPrefix == "" {
+		site.ConfigPrefix = getEnv("CONFIG_PREFIX", "VITE_")
+	}
+	for _, host := range site.Hosts {
+		glob, err := compileGlob(strings.ToLower(host))
+		if err != nil {
+			return nil, fmt.Errorf("site host %q: %s", host, err)
+		}
+		site.hostGlobs = append(site.hostGlobs, glob)
+	}
+	site.AppEnv = getAppEnv(site.ConfigPrefix)
+	site.memory = newMemoryCache()
+	site.table.Store(newRouteTable())
+	return site, nil
+}
+
+// Build output directories used when there's no PUBLIC_DIR or ./public, in
+// order of preference
+var buildDirs = []string{"dist", "build", "out", "_site"}
+
+func getPublicDir() string {
+	if dir := getEnv("PUBLIC_DIR", ""); dir != "" {
+		return dir
+	}
+	if _, err := os.Stat("public"); err == nil {
+		return "public"
+	}
+	for _, dir := range buildDirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			logln("⇨ no public dir, serving", dir)
+			return dir
+		}
+	}
+	return "public"
+}
+
+func getEnvSite() (*Site, error) {
+	publicDir := getPublicDir()
+	if bucketSource != nil {
+		publicDir = bucketSource.PublicDir()
+	}
+	if gitSource != nil {
+		publicDir = gitSource.PublicDir()
+	}
+	if ociSource != nil {
+		publicDir = ociSource.PublicDir()
+	}
+	if deployer != nil {
+		if err := deployer.Init(publicDir); err != nil {
+			return nil, err
+		}
+		publicDir = deployer.CurrentDir()
+	}
+	return newSite(&Site{
+		Hosts:        []string{"*"},
+		PublicDir:    publicDir,
+		SpaMode:      getEnv("SPA_MODE", "0") == "1",
+		ConfigPrefix: getEnv("CONFIG_PREFIX", "VITE_"),
+		HeadersFile:  getEnv("HEADERS_FILE", ""),
+		Default:      true,
+		Mounts:       parseMounts(getEnv("MOUNTS", "")),
+	})
+}
+
+// Load sites from SITES_FILE, a JSON array of sites, or fall back to a single
+// site configured from the environment
+func loadSites() ([]*Site, error) {
+	sitesFile := getEnv("SITES_FILE", "")
+	if sitesFile == "" {
+		site, err := getEnvSite()
+		if err != nil {
+			return nil, err
+		}
+		return []*Site{site}, nil
+	}
+
+	dat, err := os.ReadFile(sitesFile)
+	if err != nil {
+		return nil, err
+	}
+	configs := []*Site{}
+	if err := json.Unmarshal(dat, &configs); err != nil {
+		return nil, fmt.Errorf("%s: %s", sitesFile, err)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%s: no sites configured", sitesFile)
+	}
+	loaded := []*Site{}
+	for _, config := range configs {
+		site, err := newSite(config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", sitesFile, err)
+		}
+		loaded = append(loaded, site)
+	}
+	return loaded, nil
+}
+
+func getDefaultSite(sites []*Site) *Site {
+	for _, site := range sites {
+		if site.Default {
+			return site
+		}
+	}
+	return sites[0]
+}
+
+func stripPort(host string) string {
+	if strings.HasPrefix(host, "[") {
+		if end := strings.Index(host, "]"); end > 0 {
+			return host[1:end]
+		}
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 && strings.Count(host, ":") == 1 {
+		return host[:i]
+	}
+	return host
+}
+
+// Pick the first site with a host pattern matching the request Host
+func siteForHost(host string) *Site {
+	host = strings.ToLower(stripPort(host))
+	for _, site := range sites {
+		for _, glob := range site.hostGlobs {
+			if glob.MatchString(host) {
+				return site
+			}
+		}
+	}
+	return defaultSite
+}
@@ -0,0 +1,218 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+const slotsPath = "/__slots"
+
+// Blue/green (or more) content directories, each kept populated so
+// switching the live one is just swapping route tables
+type Slots struct {
+	Names []string
+	Dirs  map[string]string
+
+	mu     sync.Mutex
+	tables map[string]*RouteTable
+	active string
+}
+
+type SlotStatus struct {
+	Name   string `json:"name"`
+	Dir    string `json:"dir"`
+	Active bool   `json:"active"`
+	Warm   bool   `json:"warm"`
+	Routes int    `json:"routes"`
+}
+
+// Whether a path is one of the slots API's, rather than a site path that
+// happens to start the same way
+func isSlotsPath(path string) bool {
+	return path == slotsPath || strings.HasPrefix(path, slotsPath+"/")
+}
+
+// Parse SLOTS, a comma separated list of `name=dir` entries
+func getSlots() *Slots {
+	config := getEnv("SLOTS", "")
+	if config == "" {
+		return nil
+	}
+	slots := &Slots{Dirs: make(map[string]string), tables: make(map[string]*RouteTable)}
+	for _, entry := range strings.Split(config, ",") {
+		name, dir, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || name == "" || dir == "" {
+			configError("invalid slot %q", entry)
+			return nil
+		}
+		slots.Names = append(slots.Names, name)
+		slots.Dirs[name] = dir
+	}
+	slots.active = getEnv("SLOT_ACTIVE", slots.Names[0])
+	if _, exists := slots.Dirs[slots.active]; !exists {
+		configError("unknown active slot %q", slots.active)
+		return nil
+	}
+	return slots
+}
+
+// Populate a slot's route table without making it live. A table the site
+// would refuse to serve, e.g. in STRICT mode, isn't kept.
+func (slots *Slots) Warm(site *Site, name string) (*RouteTable, error) {
+	logln("⇨ warming slot", name, "→", slots.Dirs[name])
+	table := site.Build(slots.Dirs[name])
+	table.DeployID = table.ContentHash()
+	if err := site.check(table, slots.Dirs[name]); err != nil {
+		return nil, err
+	}
+	slots.mu.Lock()
+	slots.tables[name] = table
+	slots.mu.Unlock()
+	return table, nil
+}
+
+// Make a slot live, warming it first if it hasn't been. If it can't be
+// warmed the live slot is kept.
+func (slots *Slots) Activate(site *Site, name string) error {
+	if _, exists := slots.Dirs[name]; !exists {
+		return fmt.Errorf("unknown slot %q", name)
+	}
+	slots.mu.Lock()
+	table := slots.tables[name]
+	slots.mu.Unlock()
+	if table == nil {
+		warmed, err := slots.Warm(site, name)
+		if err != nil {
+			return err
+		}
+		table = warmed
+	}
+	slots.mu.Lock()
+	slots.active = name
+	slots.mu.Unlock()
+	site.swapTable(table)
+	logln("⇨ activated slot", name)
+	return nil
+}
+
+func (slots *Slots) Active() string {
+	slots.mu.Lock()
+	defer slots.mu.Unlock()
+	return slots.active
+}
+
+// Rebuild the live slot, keeping the table being served if it's refused
+func (slots *Slots) Reload(site *Site) error {
+	name := slots.Active()
+	table, err := slots.Warm(site, name)
+	if err != nil {
+		return err
+	}
+	if slots.Active() == name {
+		site.swapTable(table)
+	}
+	return nil
+}
+
+// Attach the slots to the site so reloads warm the live slot, and warm the
+// rest in the background
+func (slots *Slots) Start(site *Site) {
+	site.slots = slots
+	go func() {
+		for _, name := range slots.Names {
+			if name == slots.Active() {
+				continue
+			}
+			if _, err := slots.Warm(site, name); err != nil {
+				logln("⇨ error warming slot", name, err)
+			}
+		}
+	}()
+
+	if slotSignal == nil {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, slotSignal)
+	go func() {
+		for range signals {
+			if err := slots.Activate(site, slots.next()); err != nil {
+				logln("⇨ error activating slot", err)
+			}
+		}
+	}()
+}
+
+func (slots *Slots) next() string {
+	active := slots.Active()
+	for i, name := range slots.Names {
+		if name == active {
+			return slots.Names[(i+1)%len(slots.Names)]
+		}
+	}
+	return slots.Names[0]
+}
+
+func (slots *Slots) status() []SlotStatus {
+	slots.mu.Lock()
+	defer slots.mu.Unlock()
+	statuses := []SlotStatus{}
+	for _, name := range slots.Names {
+		status := SlotStatus{Name: name, Dir: slots.Dirs[name], Active: name == slots.active}
+		if table := slots.tables[name]; table != nil {
+			status.Warm = true
+			status.Routes = len(table.Routes)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// GET lists the slots, POST /__slots/<name> makes one live and
+// POST /__slots/<name>/warm repopulates one
+func (slots *Slots) handler(ctx *fasthttp.RequestCtx, site *Site) {
+	if !bearerAuthorized(ctx, adminToken) {
+		unauthorized(ctx)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(string(ctx.Path()), slotsPath), "/")
+	switch {
+	case rest == "" && ctx.IsGet():
+	case rest != "" && ctx.IsPost():
+		name, action, _ := strings.Cut(rest, "/")
+		if _, exists := slots.Dirs[name]; !exists {
+			ctx.Error("Not Found", fasthttp.StatusNotFound)
+			return
+		}
+		var err error
+		switch action {
+		case "":
+			err = slots.Activate(site, name)
+		case "warm":
+			var table *RouteTable
+			if table, err = slots.Warm(site, name); err == nil && slots.Active() == name {
+				site.swapTable(table)
+			}
+		default:
+			ctx.Error("Not Found", fasthttp.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logln("⇨ error with slot", name, err)
+			ctx.Error("Unprocessable Entity: "+err.Error(), fasthttp.StatusUnprocessableEntity)
+			return
+		}
+	default:
+		ctx.Error("Method Not Allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+	body, _ := json.Marshal(slots.status())
+	ctx.Response.Header.Set("Content-Type", "application/json")
+	ctx.SetBody(body)
+}
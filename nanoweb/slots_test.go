@@ -0,0 +1,91 @@
+package nanoweb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Serve the blue slot of a site with blue, green and missing slots
+func testSlots(t *testing.T) *Site {
+	t.Helper()
+	site := testSite(t, map[string]string{
+		"blue/index.html":  "blue",
+		"green/index.html": "green",
+	})
+	root := site.PublicDir
+	slots := &Slots{
+		Names:  []string{"blue", "green", "missing"},
+		Dirs:   map[string]string{"blue": filepath.Join(root, "blue"), "green": filepath.Join(root, "green"), "missing": filepath.Join(root, "missing")},
+		tables: make(map[string]*RouteTable),
+		active: "blue",
+	}
+	site.slots = slots
+	if err := site.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	previous := adminToken
+	adminToken = "token"
+	t.Cleanup(func() { adminToken = previous })
+	return site
+}
+
+func postSlot(t *testing.T, uri string) int {
+	t.Helper()
+	ctx := serveMethod("POST", uri, map[string]string{"Authorization": "Bearer token"})
+	return ctx.Response.StatusCode()
+}
+
+func TestSlotsActivate(t *testing.T) {
+	site := testSlots(t)
+	if body := string(serve("/").Response.Body()); body != "blue" {
+		t.Fatalf("serving %q, want blue", body)
+	}
+
+	if status := postSlot(t, "/__slots/green"); status != 200 {
+		t.Errorf("activating green: status %d, want 200", status)
+	}
+	if body := string(serve("/").Response.Body()); body != "green" {
+		t.Errorf("after activating green serving %q", body)
+	}
+
+	// A slot that can't be served is refused, keeping the live one
+	if status := postSlot(t, "/__slots/missing"); status != 422 {
+		t.Errorf("activating a missing slot: status %d, want 422", status)
+	}
+	if status := postSlot(t, "/__slots/missing/warm"); status != 422 {
+		t.Errorf("warming a missing slot: status %d, want 422", status)
+	}
+	if body := string(serve("/").Response.Body()); body != "green" || site.slots.Active() != "green" {
+		t.Errorf("after a refused slot serving %q from %s, want green", body, site.slots.Active())
+	}
+
+	// Reloading a live slot that has gone keeps its table
+	os.RemoveAll(site.slots.Dirs["green"])
+	if err := site.Reload(); err == nil {
+		t.Error("no error reloading a missing live slot")
+	}
+	if body := string(serve("/").Response.Body()); body != "green" {
+		t.Errorf("after a refused reload serving %q", body)
+	}
+
+	tests := []struct {
+		method string
+		uri    string
+		token  string
+		status int
+	}{
+		{"GET", "/__slots", "token", 200},
+		{"GET", "/__slots", "wrong", 401},
+		{"POST", "/__slots/blue", "", 401},
+		{"POST", "/__slots/unknown", "token", 404},
+		{"POST", "/__slots/blue/other", "token", 404},
+		{"DELETE", "/__slots", "token", 405},
+	}
+	for _, test := range tests {
+		ctx := serveMethod(test.method, test.uri, map[string]string{"Authorization": "Bearer " + test.token})
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s %s: status %d, want %d", test.method, test.uri, status, test.status)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package nanoweb
+
+import (
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Source maps give away the original source, which production often
+// shouldn't. SOURCEMAPS=serve serves *.map files like any other, none leaves
+// them out of the routes, and token only serves them with the ADMIN_TOKEN as
+// a bearer token, for debugging in production.
+var sourceMaps = getSourceMaps()
+
+func getSourceMaps() string {
+	switch value := getEnv("SOURCEMAPS", "serve"); value {
+	case "serve", "none":
+		return value
+	case "token":
+		if adminToken == "" {
+			configError("SOURCEMAPS=token needs an ADMIN_TOKEN")
+			return "none"
+		}
+		return value
+	default:
+		configError("invalid SOURCEMAPS %q", value)
+		return "none"
+	}
+}
+
+func isSourceMap(urlPath string) bool {
+	return strings.HasSuffix(urlPath, ".map")
+}
+
+// Whether a source map is left out of the routes
+func excludedSourceMap(urlPath string) bool {
+	return sourceMaps == "none" && isSourceMap(urlPath)
+}
+
+// Whether the request may be served the route at path
+func sourceMapAllowed(ctx *fasthttp.RequestCtx, path string) bool {
+	return sourceMaps != "token" || !isSourceMap(path) || bearerAuthorized(ctx, adminToken)
+}
@@ -0,0 +1,46 @@
+package nanoweb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestSourceMapsListedOnlyWithToken(t *testing.T) {
+	previousMaps, previousToken := sourceMaps, adminToken
+	sourceMaps, adminToken = "token", "secret"
+	t.Cleanup(func() { sourceMaps, adminToken = previousMaps, previousToken })
+	site := testSite(t, map[string]string{"js/app.js": "app", "js/app.js.map": "{}"})
+	routes := site.Table().Routes
+
+	for _, test := range []struct {
+		authorization string
+		files         []string
+	}{
+		{"", []string{"/js/app.js"}},
+		{"Bearer wrong", []string{"/js/app.js"}},
+		{"Bearer secret", []string{"/js/app.js", "/js/app.js.map"}},
+	} {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.Set("Authorization", test.authorization)
+		if files := directoryFiles(ctx, routes, "/js/"); !reflect.DeepEqual(files, test.files) {
+			t.Errorf("%q: listed %v, want %v", test.authorization, files, test.files)
+		}
+
+		ctx = &fasthttp.RequestCtx{}
+		ctx.Request.Header.Set("Authorization", test.authorization)
+		ctx.Request.Header.Set("Depth", "1")
+		propfindHandler(ctx, routes, "/js/")
+		if listed := strings.Contains(string(ctx.Response.Body()), "app.js.map"); listed != (len(test.files) == 2) {
+			t.Errorf("%q: PROPFIND listed the source map: %v", test.authorization, listed)
+		}
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	propfindHandler(ctx, routes, "/js/app.js.map")
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusNotFound {
+		t.Errorf("PROPFIND of the source map without the token: status %d", status)
+	}
+}
@@ -0,0 +1,89 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// STARTUP_OUTPUT=json prints the startup summary as one JSON document on
+// stdout, moving log lines to stderr
+var startupOutput = getEnv("STARTUP_OUTPUT", "text")
+
+func init() {
+	if startupOutput == "json" {
+		logOutput = os.Stderr
+	}
+}
+
+type SiteSummary struct {
+	Hosts      []string `json:"hosts"`
+	PublicDir  string   `json:"publicDir"`
+	Routes     int      `json:"routes"`
+	CacheBytes int      `json:"cacheBytes"`
+	DeployID   string   `json:"deployId"`
+}
+
+type StartupSummary struct {
+	Version  string            `json:"version"`
+	Listen   []string          `json:"listen"`
+	Config   map[string]string `json:"config"`
+	Sites    []SiteSummary     `json:"sites"`
+	Warnings []string          `json:"warnings"`
+}
+
+// Settings that are never printed
+func secretConfig(name string) bool {
+	return strings.Contains(name, "TOKEN") || strings.Contains(name, "SECRET") || strings.Contains(name, "PASSWORD")
+}
+
+func getStartupSummary(addrs []string) StartupSummary {
+	summary := StartupSummary{
+		Version:  getVersion().Version,
+		Listen:   addrs,
+		Config:   make(map[string]string),
+		Sites:    []SiteSummary{},
+		Warnings: []string{},
+	}
+	for _, config := range configVars {
+		value, set := lookupEnv(config.Name)
+		if !set {
+			value = config.Default
+		} else if secretConfig(config.Name) && value != "" {
+			value = "[redacted]"
+		}
+		summary.Config[config.Name] = value
+	}
+	for _, site := range sites {
+		table := site.Table()
+		cacheBytes := 0
+		for _, route := range table.Routes {
+			gzip, brotli := route.compressedSizes()
+			cacheBytes += len(route.Content.Plain) + gzip + brotli + len(route.Content.Zstd)
+		}
+		summary.Sites = append(summary.Sites, SiteSummary{
+			Hosts:      site.Hosts,
+			PublicDir:  site.PublicDir,
+			Routes:     len(table.Routes),
+			CacheBytes: cacheBytes,
+			DeployID:   table.DeployID,
+		})
+		summary.Warnings = append(summary.Warnings, table.Problems...)
+	}
+	return summary
+}
+
+func printStartupSummary(addrs []string) {
+	summary := getStartupSummary(addrs)
+	if startupOutput == "json" {
+		json.NewEncoder(os.Stdout).Encode(summary)
+		return
+	}
+	for _, site := range summary.Sites {
+		logf("⇨ serving %d routes (%d bytes) from %s\n", site.Routes, site.CacheBytes, site.PublicDir)
+	}
+	for _, warning := range summary.Warnings {
+		logln("⇨ warning:", warning)
+	}
+	logln("⇨ listening on", strings.Join(addrs, ", "))
+}
@@ -0,0 +1,205 @@
+package nanoweb
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const statsPath = "/__stats"
+const dashboardPath = "/__dashboard"
+
+var statsEnabled = getEnv("STATS", "0") == "1"
+
+// A page over /__stats for humans
+//
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+type SiteStats struct {
+	Hosts    []string   `json:"hosts"`
+	Routes   int        `json:"routes"`
+	DeployID string     `json:"deployId"`
+	Cache    CacheStats `json:"cache"`
+	Problems []string   `json:"problems,omitempty"`
+}
+
+// Bytes of content held in memory for each encoding
+type CacheStats struct {
+	Plain  int `json:"plain"`
+	Gzip   int `json:"gzip"`
+	Brotli int `json:"brotli"`
+	Zstd   int `json:"zstd"`
+}
+
+type RouteStats struct {
+	Path     string `json:"path"`
+	Requests int64  `json:"requests"`
+}
+
+type ReloadStats struct {
+	Time     time.Time `json:"time"`
+	Hosts    []string  `json:"hosts"`
+	Routes   int       `json:"routes"`
+	Duration float64   `json:"durationSeconds"`
+	DeployID string    `json:"deployId"`
+}
+
+// Percentiles of recent request latencies, in milliseconds
+type LatencyStats struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+type Stats struct {
+	Sites     []SiteStats      `json:"sites"`
+	Uptime    float64          `json:"uptimeSeconds"`
+	Requests  int64            `json:"requests"`
+	Statuses  map[string]int64 `json:"statuses"`
+	Latency   LatencyStats     `json:"latencyMs"`
+	TopRoutes []RouteStats     `json:"topRoutes"`
+	Reloads   []ReloadStats    `json:"reloads"`
+}
+
+// How many routes and reloads are listed, and how many latencies the
+// percentiles are taken over
+const statsTop = 10
+const statsReloads = 20
+const statsLatencies = 1024
+
+// Request counts kept while STATS is enabled
+var requestStats = struct {
+	sync.Mutex
+	started  time.Time
+	requests int64
+	statuses map[string]int64
+	routes   map[string]int64
+	reloads  []ReloadStats
+	// A ring of the most recent latencies
+	latencies []time.Duration
+}{started: time.Now(), statuses: make(map[string]int64), routes: make(map[string]int64)}
+
+func recordRequestStats(status int, duration time.Duration) {
+	if !statsEnabled {
+		return
+	}
+	requestStats.Lock()
+	defer requestStats.Unlock()
+	requestStats.requests++
+	requestStats.statuses[strconv.Itoa(status/100)+"xx"]++
+	if len(requestStats.latencies) < statsLatencies {
+		requestStats.latencies = append(requestStats.latencies, duration)
+	} else {
+		requestStats.latencies[requestStats.requests%statsLatencies] = duration
+	}
+}
+
+func getLatencyStats(latencies []time.Duration) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p int) float64 {
+		return float64(sorted[(len(sorted)-1)*p/100]) / float64(time.Millisecond)
+	}
+	return LatencyStats{P50: percentile(50), P90: percentile(90), P99: percentile(99)}
+}
+
+// Only paths that hit a route are counted, so the map can't grow past them
+func recordRouteStats(path string) {
+	if !statsEnabled {
+		return
+	}
+	requestStats.Lock()
+	defer requestStats.Unlock()
+	requestStats.routes[path]++
+}
+
+func recordReloadStats(site *Site, duration time.Duration) {
+	if !statsEnabled {
+		return
+	}
+	table := site.Table()
+	requestStats.Lock()
+	defer requestStats.Unlock()
+	requestStats.reloads = append(requestStats.reloads, ReloadStats{
+		Time:     time.Now(),
+		Hosts:    site.Hosts,
+		Routes:   len(table.Routes),
+		Duration: duration.Seconds(),
+		DeployID: table.DeployID,
+	})
+	if len(requestStats.reloads) > statsReloads {
+		requestStats.reloads = requestStats.reloads[1:]
+	}
+}
+
+func getStats() Stats {
+	stats := Stats{Sites: []SiteStats{}}
+	for _, site := range sites {
+		table := site.Table()
+		cache := CacheStats{}
+		for _, route := range table.Routes {
+			cache.Plain += len(route.Content.Plain)
+			gzip, brotli := route.compressedSizes()
+			cache.Gzip += gzip
+			cache.Brotli += brotli
+			cache.Zstd += len(route.Content.Zstd)
+		}
+		stats.Sites = append(stats.Sites, SiteStats{
+			Hosts:    site.Hosts,
+			Routes:   len(table.Routes),
+			DeployID: table.DeployID,
+			Cache:    cache,
+			Problems: table.Problems,
+		})
+	}
+	requestStats.Lock()
+	defer requestStats.Unlock()
+	stats.Uptime = time.Since(requestStats.started).Seconds()
+	stats.Requests = requestStats.requests
+	stats.Statuses = make(map[string]int64, len(requestStats.statuses))
+	for status, count := range requestStats.statuses {
+		stats.Statuses[status] = count
+	}
+	stats.Latency = getLatencyStats(requestStats.latencies)
+	stats.TopRoutes = make([]RouteStats, 0, len(requestStats.routes))
+	for path, count := range requestStats.routes {
+		stats.TopRoutes = append(stats.TopRoutes, RouteStats{Path: path, Requests: count})
+	}
+	sort.Slice(stats.TopRoutes, func(i, j int) bool {
+		if stats.TopRoutes[i].Requests != stats.TopRoutes[j].Requests {
+			return stats.TopRoutes[i].Requests > stats.TopRoutes[j].Requests
+		}
+		return stats.TopRoutes[i].Path < stats.TopRoutes[j].Path
+	})
+	if len(stats.TopRoutes) > statsTop {
+		stats.TopRoutes = stats.TopRoutes[:statsTop]
+	}
+	stats.Reloads = append([]ReloadStats{}, requestStats.reloads...)
+	return stats
+}
+
+func statsHandler(ctx *fasthttp.RequestCtx) {
+	body, err := json.Marshal(getStats())
+	if err != nil {
+		ctx.Error("Internal Server Error", fasthttp.StatusInternalServerError)
+		return
+	}
+	ctx.Response.Header.Set("Content-Type", "application/json")
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	ctx.SetBody(body)
+}
+
+func dashboardHandler(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("Content-Type", "text/html; charset=utf-8")
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	ctx.SetBody(dashboardHTML)
+}
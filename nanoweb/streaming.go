@@ -0,0 +1,23 @@
+package nanoweb
+
+import "github.com/valyala/fasthttp"
+
+var streamingEnabled = getEnv("STREAMING", "0") == "1"
+
+func streamingType(mimetype string) bool {
+	switch mimetype {
+	case "application/vnd.apple.mpegurl", "application/dash+xml", "video/mp2t", "video/iso.segment", "video/mp4", "audio/mp4", "audio/mpeg", "audio/aac":
+		return true
+	default:
+		return false
+	}
+}
+
+// CORS headers so players on other origins can fetch playlists and segments,
+// including with Range requests
+func setStreamingHeaders(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("Access-Control-Allow-Origin", "*")
+	ctx.Response.Header.Set("Access-Control-Allow-Headers", "Range")
+	ctx.Response.Header.Set("Access-Control-Expose-Headers", "Content-Length, Content-Range")
+	ctx.Response.Header.Set("Accept-Ranges", "bytes")
+}
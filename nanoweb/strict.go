@@ -0,0 +1,27 @@
+package nanoweb
+
+import (
+	"fmt"
+)
+
+// Errors populating a table, such as unreadable files and template errors,
+// are reported by the health check. STRICT=1 also refuses to start with
+// them, or to swap in a reloaded table that has any.
+var strictMode = getEnv("STRICT", "0") == "1"
+
+// Record an error populating a table, leaving the file out
+func (table *RouteTable) populateError(format string, a ...interface{}) {
+	message := fmt.Sprintf(format, a...)
+	logln("⇨ error", message)
+	table.errors = append(table.errors, message)
+	table.Problems = append(table.Problems, message)
+}
+
+func (site *Site) checkStrict(table *RouteTable, dir string) bool {
+	if len(table.errors) == 0 {
+		return true
+	}
+	logf("⇨ strict mode: %d errors populating %s\n", len(table.errors), dir)
+	site.keepDeploy()
+	return false
+}
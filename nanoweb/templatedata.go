@@ -0,0 +1,70 @@
+package nanoweb
+
+import (
+	"sort"
+	"sync"
+)
+
+// Supplies extra data to templates, such as feature flags fetched from a
+// service. It's loaded on every reload and available as .Data.<name>.
+type TemplateDataProvider interface {
+	Load() (interface{}, error)
+}
+
+type TemplateDataFunc func() (interface{}, error)
+
+func (load TemplateDataFunc) Load() (interface{}, error) {
+	return load()
+}
+
+var (
+	templateDataMu        sync.Mutex
+	templateDataProviders = make(map[string]TemplateDataProvider)
+	templateDataValues    = make(map[string]interface{})
+)
+
+func RegisterTemplateData(name string, provider TemplateDataProvider) {
+	templateDataMu.Lock()
+	defer templateDataMu.Unlock()
+	templateDataProviders[name] = provider
+}
+
+func WithTemplateData(name string, provider TemplateDataProvider) Option {
+	return func(server *Server) error {
+		RegisterTemplateData(name, provider)
+		return nil
+	}
+}
+
+// Load every provider, keeping the last value of any that fail
+func loadTemplateData() {
+	templateDataMu.Lock()
+	defer templateDataMu.Unlock()
+	names := make([]string, 0, len(templateDataProviders))
+	for name := range templateDataProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		value, err := templateDataProviders[name].Load()
+		if err != nil {
+			logln("⇨ error loading template data", name, err)
+			value = templateDataValues[name]
+		}
+		values[name] = value
+	}
+	templateDataValues = values
+}
+
+func getTemplateData() map[string]interface{} {
+	templateDataMu.Lock()
+	defer templateDataMu.Unlock()
+	return templateDataValues
+}
+
+// Reload the template data and repopulate every site, for providers that
+// know when their data has changed
+func RefreshTemplateData() {
+	reloadSites()
+}
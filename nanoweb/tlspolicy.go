@@ -0,0 +1,172 @@
+package nanoweb
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Which TLS versions and cipher suites to accept, and whether to staple OCSP
+// responses, for operators with a compliance baseline to meet. Zero values
+// keep Go's defaults.
+type TLSPolicy struct {
+	MinVersion   uint16
+	CipherSuites []uint16
+	OCSPStapling bool
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func getTLSPolicy() (*TLSPolicy, error) {
+	version, names := getEnv("TLS_MIN_VERSION", ""), getEnv("TLS_CIPHERS", "")
+	stapling := getEnv("TLS_OCSP_STAPLING", "0") == "1"
+	if version == "" && names == "" && !stapling {
+		return nil, nil
+	}
+	policy := &TLSPolicy{OCSPStapling: stapling}
+	if version != "" {
+		policy.MinVersion = tlsVersions[strings.TrimPrefix(version, "TLS")]
+		if policy.MinVersion == 0 {
+			return nil, fmt.Errorf("invalid TLS_MIN_VERSION %s, use 1.0, 1.1, 1.2 or 1.3", version)
+		}
+	}
+	ciphers, err := parseCipherSuites(names)
+	if err != nil {
+		return nil, err
+	}
+	policy.CipherSuites = ciphers
+	return policy, nil
+}
+
+// Parse a comma separated list of Go cipher suite names, e.g.
+// "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
+func parseCipherSuites(names string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite.ID
+	}
+	var ciphers []uint16
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %s in TLS_CIPHERS", name)
+		}
+		ciphers = append(ciphers, id)
+	}
+	return ciphers, nil
+}
+
+// Load the certificate and build the TLS config for the listeners. With OCSP
+// stapling, responses are fetched before serving and refreshed in the
+// background ahead of their next update.
+func (server *Server) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(server.TLSCert, server.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	var current atomic.Pointer[tls.Certificate]
+	current.Store(&cert)
+	config := &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return current.Load(), nil
+		},
+	}
+	if policy := server.TLSPolicy; policy != nil {
+		config.MinVersion = policy.MinVersion
+		config.CipherSuites = policy.CipherSuites
+		if policy.OCSPStapling {
+			next, err := stapleOCSP(&current)
+			if err != nil {
+				return nil, err
+			}
+			go refreshOCSP(&current, next)
+		}
+	}
+	return config, nil
+}
+
+func refreshOCSP(current *atomic.Pointer[tls.Certificate], next time.Time) {
+	for {
+		if next.IsZero() {
+			next = time.Now().Add(24 * time.Hour)
+		}
+		// Refresh halfway to the next update, and retry hourly on errors
+		wait := time.Until(next) / 2
+		if wait < time.Minute {
+			wait = time.Minute
+		}
+		time.Sleep(wait)
+		updated, err := stapleOCSP(current)
+		if err != nil {
+			logln("⇨ error refreshing OCSP staple", err)
+			next = time.Now().Add(2 * time.Hour)
+			continue
+		}
+		next = updated
+	}
+}
+
+// Fetch a fresh OCSP response for the current certificate and staple it,
+// returning when the responder expects to have the next one
+func stapleOCSP(current *atomic.Pointer[tls.Certificate]) (time.Time, error) {
+	cert := *current.Load()
+	if len(cert.Certificate) < 2 {
+		return time.Time{}, errors.New("OCSP stapling needs the issuer in the certificate chain")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return time.Time{}, err
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(leaf.OCSPServer) == 0 {
+		return time.Time{}, errors.New("certificate has no OCSP responder")
+	}
+	request, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("OCSP responder returned %s", res.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return time.Time{}, err
+	}
+	response, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if response.Status != ocsp.Good {
+		return time.Time{}, fmt.Errorf("OCSP status for certificate is %d", response.Status)
+	}
+	cert.OCSPStaple = raw
+	current.Store(&cert)
+	logln("⇨ stapled OCSP response, next update", response.NextUpdate.Format(time.RFC3339))
+	return response.NextUpdate, nil
+}
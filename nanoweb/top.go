@@ -0,0 +1,106 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Show live stats from a running server's /__stats, redrawn in place
+func topCommand(args []string) int {
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	interval := flags.Duration("interval", 2*time.Second, "how often to refresh")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	url := getServerURL()
+	if flags.NArg() > 0 {
+		url = strings.TrimSuffix(flags.Arg(0), "/")
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	var last *Stats
+	var lastTime time.Time
+	for {
+		stats, err := fetchStats(client, url+statsPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		now := time.Now()
+		printTop(url, stats, last, now.Sub(lastTime))
+		last, lastTime = &stats, now
+		time.Sleep(*interval)
+	}
+}
+
+func fetchStats(client *http.Client, url string) (Stats, error) {
+	var stats Stats
+	res, err := client.Get(url)
+	if err != nil {
+		return stats, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return stats, fmt.Errorf("GET %s: %s (is STATS=1 set?)", url, res.Status)
+	}
+	return stats, json.NewDecoder(res.Body).Decode(&stats)
+}
+
+// Rates are per second since the last refresh
+func printTop(url string, stats Stats, last *Stats, elapsed time.Duration) {
+	rate := func(current int64, previous int64) string {
+		if last == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f", float64(current-previous)/elapsed.Seconds())
+	}
+	var b strings.Builder
+	// Move to the top left and clear the screen
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "nano-web top - %s - up %s\n\n", url, (time.Duration(stats.Uptime) * time.Second).String())
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	var previous int64
+	if last != nil {
+		previous = last.Requests
+	}
+	fmt.Fprintf(w, "requests/s\t%s\t(%d total)\n", rate(stats.Requests, previous), stats.Requests)
+	fmt.Fprintf(w, "latency\tp50 %.2fms\tp90 %.2fms\tp99 %.2fms\n", stats.Latency.P50, stats.Latency.P90, stats.Latency.P99)
+	statuses := make([]string, 0, len(stats.Statuses))
+	for status := range stats.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		var previous int64
+		if last != nil {
+			previous = last.Statuses[status]
+		}
+		fmt.Fprintf(w, "%s/s\t%s\t(%d total)\n", status, rate(stats.Statuses[status], previous), stats.Statuses[status])
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "ROUTE\tREQ/S\tTOTAL")
+	for _, route := range stats.TopRoutes {
+		var previous int64
+		if last != nil {
+			for _, lastRoute := range last.TopRoutes {
+				if lastRoute.Path == route.Path {
+					previous = lastRoute.Requests
+				}
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\n", route.Path, rate(route.Requests, previous), route.Requests)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "HOSTS\tDEPLOY\tROUTES")
+	for _, site := range stats.Sites {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", strings.Join(site.Hosts, ","), site.DeployID, site.Routes)
+	}
+	w.Flush()
+	os.Stdout.WriteString(b.String())
+}
@@ -0,0 +1,49 @@
+package nanoweb
+
+import (
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Directory indexes are routed both with and without a trailing slash.
+// TRAILING_SLASH=add redirects /docs to /docs/, remove redirects /docs/ to
+// /docs, and ignore serves both.
+var trailingSlash = getTrailingSlash()
+
+func getTrailingSlash() string {
+	switch value := getEnv("TRAILING_SLASH", "ignore"); value {
+	case "add", "remove", "ignore":
+		return value
+	default:
+		configError("invalid TRAILING_SLASH %q", value)
+		return "ignore"
+	}
+}
+
+// Redirect to the canonical form of a directory index, returning false if
+// the path already is one
+func redirectTrailingSlash(ctx *fasthttp.RequestCtx, routes Routes, path string) bool {
+	var target string
+	switch {
+	case !ctx.IsGet() && !ctx.IsHead():
+		return false
+	case trailingSlash == "add" && !strings.HasSuffix(path, "/"):
+		if _, exists := routes[path+"/"]; !exists {
+			return false
+		}
+		target = path + "/"
+	case trailingSlash == "remove" && path != "/" && strings.HasSuffix(path, "/"):
+		if _, exists := routes[strings.TrimSuffix(path, "/")]; !exists {
+			return false
+		}
+		target = strings.TrimSuffix(path, "/")
+	default:
+		return false
+	}
+	if query := ctx.URI().QueryString(); len(query) > 0 {
+		target += "?" + string(query)
+	}
+	ctx.Redirect(target, fasthttp.StatusMovedPermanently)
+	return true
+}
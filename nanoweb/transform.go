@@ -0,0 +1,57 @@
+package nanoweb
+
+import (
+	"sync"
+)
+
+// Rewrites a route's content when sites are populated, after templating and
+// before compression, e.g. to replace tokens, rewrite links or insert a
+// banner. Transformers run in the order they're registered, each getting the
+// previous one's output.
+type Transformer interface {
+	Transform(urlPath string, contentType string, content []byte) ([]byte, error)
+}
+
+type TransformerFunc func(urlPath string, contentType string, content []byte) ([]byte, error)
+
+func (transform TransformerFunc) Transform(urlPath string, contentType string, content []byte) ([]byte, error) {
+	return transform(urlPath, contentType, content)
+}
+
+var (
+	transformersMu sync.Mutex
+	transformers   []Transformer
+)
+
+func RegisterTransformer(transformer Transformer) {
+	transformersMu.Lock()
+	defer transformersMu.Unlock()
+	transformers = append(transformers, transformer)
+}
+
+func WithTransformer(transformer Transformer) Option {
+	return func(server *Server) error {
+		RegisterTransformer(transformer)
+		return nil
+	}
+}
+
+func hasTransformers() bool {
+	transformersMu.Lock()
+	defer transformersMu.Unlock()
+	return len(transformers) > 0
+}
+
+func transformContent(urlPath string, contentType string, content []byte) ([]byte, error) {
+	transformersMu.Lock()
+	registered := transformers
+	transformersMu.Unlock()
+	for _, transformer := range registered {
+		transformed, err := transformer.Transform(urlPath, contentType, content)
+		if err != nil {
+			return nil, err
+		}
+		content = transformed
+	}
+	return content, nil
+}
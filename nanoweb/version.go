@@ -0,0 +1,113 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const versionPath = "/_version"
+
+const releasesURL = "https://api.github.com/repos/radiosilence/nano-web/releases/latest"
+
+var versionEnabled = getEnv("VERSION_ENDPOINT", "0") == "1"
+
+// Set at build time with -ldflags "-X <module>/nanoweb.version=..." (and commit and buildDate)
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// The version, falling back to the VCS details Go embeds for the commit and
+// date when they weren't set at build time
+func getVersion() VersionInfo {
+	info := VersionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+func versionHandler(ctx *fasthttp.RequestCtx) {
+	writeJSON(ctx, fasthttp.StatusOK, getVersion())
+}
+
+func versionCommand(args []string) int {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	check := flags.Bool("check", false, "check GitHub for a newer release")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	info := getVersion()
+	fmt.Println("nano-web", info.Version)
+	if info.Commit != "" {
+		fmt.Println("commit   ", info.Commit)
+	}
+	if info.BuildDate != "" {
+		fmt.Println("built    ", info.BuildDate)
+	}
+	fmt.Println("go       ", info.GoVersion, info.Platform)
+	if !*check {
+		return 0
+	}
+	latest, err := getLatestRelease()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error checking for updates:", err)
+		return 1
+	}
+	if strings.TrimPrefix(latest, "v") == strings.TrimPrefix(info.Version, "v") {
+		fmt.Println("\nup to date")
+	} else {
+		fmt.Printf("\n%s is available: https://github.com/radiosilence/nano-web/releases/tag/%s\n", latest, latest)
+	}
+	return 0
+}
+
+func getLatestRelease() (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(releasesURL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s from %s", res.Status, releasesURL)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&release); err != nil {
+		return "", err
+	}
+	return release.TagName, nil
+}
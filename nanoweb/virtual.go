@@ -0,0 +1,142 @@
+package nanoweb
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const routesPath = "/__routes"
+
+// Whether a path is one of the routes API's, rather than a site path that
+// happens to start the same way
+func isRoutesPath(path string) bool {
+	return path == routesPath || strings.HasPrefix(path, routesPath+"/")
+}
+
+// A route whose content is provided in memory rather than by a file, kept
+// across reloads
+type VirtualRoute struct {
+	Content     []byte
+	ContentType string
+	ModTime     time.Time
+}
+
+type virtualRoutes struct {
+	mu     sync.Mutex
+	routes map[string]VirtualRoute
+}
+
+// Build a virtual route through the same pipeline as files
+func (site *Site) makeVirtualRoute(urlPath string, virtual VirtualRoute, headerRules []HeaderRule) Route {
+	route := makeContentRoute(virtual.Content, virtual.ContentType, virtual.ModTime)
+	applyHeaderRules(headerRules, urlPath, &route)
+	applyDownloadRules(urlPath, &route)
+	return route
+}
+
+func (site *Site) populateVirtualRoutes(routes Routes, publicDir string) {
+	site.virtual.mu.Lock()
+	defer site.virtual.mu.Unlock()
+	if len(site.virtual.routes) == 0 {
+		return
+	}
+	headerRules, _ := loadHeaderRules(site.getHeadersFile(publicDir))
+	for urlPath, virtual := range site.virtual.routes {
+		logln("⇨ adding route", urlPath, "→ virtual")
+		routes[urlPath] = site.makeVirtualRoute(urlPath, virtual, headerRules)
+	}
+}
+
+// Serve content from memory at a path, e.g. a generated build-info.json,
+// replacing any file there. The content type defaults to the one for the
+// path's extension.
+func (site *Site) AddRoute(urlPath string, content []byte, contentType string) error {
+	if !strings.HasPrefix(urlPath, "/") || path.Clean(urlPath) != urlPath {
+		return fmt.Errorf("invalid route path %q", urlPath)
+	}
+	if contentType == "" {
+		contentType = getMimetype(strings.ToLower(path.Ext(urlPath)))
+	}
+	virtual := VirtualRoute{Content: content, ContentType: contentType, ModTime: time.Now()}
+	site.virtual.mu.Lock()
+	if site.virtual.routes == nil {
+		site.virtual.routes = make(map[string]VirtualRoute)
+	}
+	site.virtual.routes[urlPath] = virtual
+	site.virtual.mu.Unlock()
+	headerRules, _ := loadHeaderRules(site.getHeadersFile(site.PublicDir))
+	route := site.makeVirtualRoute(urlPath, virtual, headerRules)
+	site.updateRoutes(func(routes Routes) { routes[urlPath] = route })
+	return nil
+}
+
+// Stop serving a virtual route. A file at the path is served again after the
+// next reload.
+func (site *Site) RemoveRoute(urlPath string) bool {
+	site.virtual.mu.Lock()
+	_, exists := site.virtual.routes[urlPath]
+	delete(site.virtual.routes, urlPath)
+	site.virtual.mu.Unlock()
+	if exists {
+		site.updateRoutes(func(routes Routes) { delete(routes, urlPath) })
+	}
+	return exists
+}
+
+func (site *Site) VirtualRoutes() []string {
+	site.virtual.mu.Lock()
+	defer site.virtual.mu.Unlock()
+	paths := make([]string, 0, len(site.virtual.routes))
+	for urlPath := range site.virtual.routes {
+		paths = append(paths, urlPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Swap in a copy of the live table with some routes changed
+func (site *Site) updateRoutes(update func(Routes)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	current := site.Table()
+	table := &RouteTable{Routes: make(Routes, len(current.Routes)+1), Search: current.Search, DeployID: current.DeployID, Problems: current.Problems, Redirects: current.Redirects}
+	for urlPath, route := range current.Routes {
+		table.Routes[urlPath] = route
+	}
+	update(table.Routes)
+	site.swapTable(table)
+}
+
+// GET /__routes lists virtual routes, PUT /__routes/<path> serves the request
+// body at <path> with the request's Content-Type and DELETE removes it
+func routesHandler(ctx *fasthttp.RequestCtx, site *Site) {
+	if !bearerAuthorized(ctx, adminToken) {
+		unauthorized(ctx)
+		return
+	}
+	urlPath := strings.TrimPrefix(string(ctx.Path()), routesPath)
+	switch {
+	case ctx.IsGet() && (urlPath == "" || urlPath == "/"):
+		writeJSON(ctx, fasthttp.StatusOK, site.VirtualRoutes())
+	case ctx.IsPut():
+		if err := site.AddRoute(urlPath, append([]byte(nil), ctx.PostBody()...), string(ctx.Request.Header.ContentType())); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+		writeJSON(ctx, fasthttp.StatusOK, site.VirtualRoutes())
+	case ctx.IsDelete():
+		if !site.RemoveRoute(urlPath) {
+			ctx.Error("Not Found", fasthttp.StatusNotFound)
+			return
+		}
+		writeJSON(ctx, fasthttp.StatusOK, site.VirtualRoutes())
+	default:
+		ctx.Error("Method Not Allowed", fasthttp.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,65 @@
+package nanoweb
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestRoutesHandler(t *testing.T) {
+	testSite(t, map[string]string{"index.html": "home", "__routesfoo.txt": "site page"})
+	previous := adminToken
+	adminToken = "token"
+	t.Cleanup(func() { adminToken = previous })
+
+	put := &fasthttp.RequestCtx{}
+	put.Request.Header.SetMethod(fasthttp.MethodPut)
+	put.Request.SetRequestURI(routesPath + "/build.json")
+	put.Request.Header.Set("Authorization", "Bearer token")
+	put.Request.Header.SetContentType("application/json")
+	put.Request.SetBody([]byte(`{"build":1}`))
+	handler(put)
+	if status := put.Response.StatusCode(); status != 200 {
+		t.Fatalf("PUT: status %d, want 200", status)
+	}
+	served := serve("/build.json")
+	if body, contentType := string(served.Response.Body()), string(served.Response.Header.ContentType()); body != `{"build":1}` || !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("serving %q as %s", body, contentType)
+	}
+
+	auth := map[string]string{"Authorization": "Bearer token"}
+	var listed []string
+	json.Unmarshal(serveMethod("GET", routesPath, auth).Response.Body(), &listed)
+	if len(listed) != 1 || listed[0] != "/build.json" {
+		t.Errorf("listing %v", listed)
+	}
+
+	tests := []struct {
+		method string
+		uri    string
+		token  string
+		status int
+	}{
+		{"GET", routesPath, "wrong", 401},
+		{"PUT", routesPath, "token", 400},
+		{"DELETE", routesPath + "/build.json", "token", 200},
+		{"DELETE", routesPath + "/build.json", "token", 404},
+		{"POST", routesPath + "/build.json", "token", 405},
+		// Site paths that merely start like the API are the site's
+		{"GET", "/__routesfoo.txt", "", 200},
+	}
+	for _, test := range tests {
+		ctx := serveMethod(test.method, test.uri, map[string]string{"Authorization": "Bearer " + test.token})
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s %s: status %d, want %d", test.method, test.uri, status, test.status)
+		}
+	}
+	if status := serve("/build.json").Response.StatusCode(); status != 404 {
+		t.Errorf("after DELETE: status %d, want 404", status)
+	}
+	if body := string(serve("/__routesfoo.txt").Response.Body()); body != "site page" {
+		t.Errorf("/__routesfoo.txt: serving %q", body)
+	}
+}
@@ -0,0 +1,138 @@
+package nanoweb
+
+import (
+	"encoding/xml"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+var webdavEnabled = getEnv("WEBDAV", "0") == "1"
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	Namespace string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"D:href"`
+	Propstat davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+type davProp struct {
+	DisplayName   string          `xml:"D:displayname"`
+	ResourceType  davResourceType `xml:"D:resourcetype"`
+	ContentLength string          `xml:"D:getcontentlength,omitempty"`
+	ContentType   string          `xml:"D:getcontenttype,omitempty"`
+	LastModified  string          `xml:"D:getlastmodified,omitempty"`
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+func davHref(urlPath string) string {
+	return (&url.URL{Path: urlPath}).EscapedPath()
+}
+
+func davFile(urlPath string, route Route) davResponse {
+	return davResponse{
+		Href: davHref(urlPath),
+		Propstat: davPropstat{
+			Prop: davProp{
+				DisplayName:   path.Base(urlPath),
+				ContentLength: strconv.Itoa(route.PlainLen),
+				ContentType:   route.ContentType,
+				LastModified:  route.LastModified,
+			},
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+}
+
+func davCollection(dir string) davResponse {
+	return davResponse{
+		Href: davHref(dir),
+		Propstat: davPropstat{
+			Prop: davProp{
+				DisplayName:  path.Base(dir),
+				ResourceType: davResourceType{Collection: &struct{}{}},
+			},
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+}
+
+func webdavOptions(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("DAV", "1")
+	ctx.Response.Header.Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+	ctx.Response.Header.Set("MS-Author-Via", "DAV")
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+// Answer PROPFIND from the route table, treating directories of file routes
+// as collections
+func propfindHandler(ctx *fasthttp.RequestCtx, routes Routes, urlPath string) {
+	depth := string(ctx.Request.Header.Peek("Depth"))
+	responses := []davResponse{}
+
+	if route, exists := routes[urlPath]; exists && isFileRoute(urlPath, route) {
+		if !sourceMapAllowed(ctx, urlPath) {
+			notFound(ctx, routes)
+			auditDenied(ctx, "source_map")
+			return
+		}
+		responses = append(responses, davFile(urlPath, route))
+	} else {
+		dir := strings.TrimSuffix(urlPath, "/") + "/"
+		files := directoryFiles(ctx, routes, dir)
+		if len(files) == 0 {
+			ctx.Error("Not Found", fasthttp.StatusNotFound)
+			return
+		}
+		responses = append(responses, davCollection(dir))
+		if depth != "0" {
+			dirs := make(map[string]bool)
+			for _, file := range files {
+				rest := strings.TrimPrefix(file, dir)
+				segments := strings.Split(rest, "/")
+				if depth == "1" && len(segments) > 1 {
+					dirs[dir+segments[0]+"/"] = true
+					continue
+				}
+				for i := 1; i < len(segments); i++ {
+					dirs[dir+strings.Join(segments[:i], "/")+"/"] = true
+				}
+				responses = append(responses, davFile(file, routes[file]))
+			}
+			sorted := make([]string, 0, len(dirs))
+			for subdir := range dirs {
+				sorted = append(sorted, subdir)
+			}
+			sort.Strings(sorted)
+			for _, subdir := range sorted {
+				responses = append(responses, davCollection(subdir))
+			}
+		}
+	}
+
+	body, err := xml.Marshal(davMultistatus{Namespace: "DAV:", Responses: responses})
+	if err != nil {
+		ctx.Error("Internal Server Error", fasthttp.StatusInternalServerError)
+		return
+	}
+	ctx.Response.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	ctx.SetStatusCode(fasthttp.StatusMultiStatus)
+	ctx.SetBodyString(xml.Header)
+	ctx.Write(body)
+}
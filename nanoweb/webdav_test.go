@@ -0,0 +1,94 @@
+package nanoweb
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// With WEBDAV, OPTIONS is answered for WebDAV clients, except CORS
+// preflights, which go through the usual method handling
+func TestWebDAVOptions(t *testing.T) {
+	testSite(t, map[string]string{"index.html": "home"})
+	previous := webdavEnabled
+	webdavEnabled = true
+	t.Cleanup(func() { webdavEnabled = previous })
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		dav     string
+	}{
+		{"WebDAV client", nil, 200, "1"},
+		{"CORS preflight", map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "GET"}, 204, ""},
+	}
+	for _, test := range tests {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(fasthttp.MethodOptions)
+		ctx.Request.SetRequestURI("/")
+		for key, value := range test.headers {
+			ctx.Request.Header.Set(key, value)
+		}
+		handler(ctx)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, status, test.status)
+		}
+		if dav := string(ctx.Response.Header.Peek("DAV")); dav != test.dav {
+			t.Errorf("%s: DAV %q, want %q", test.name, dav, test.dav)
+		}
+	}
+}
+
+// PROPFIND lists a file, or a directory's files and subdirectories to the
+// requested depth
+func TestPropfind(t *testing.T) {
+	testSite(t, map[string]string{
+		"docs/a.txt":     "a",
+		"docs/sub/b.txt": "b",
+	})
+	previous := webdavEnabled
+	webdavEnabled = true
+	t.Cleanup(func() { webdavEnabled = previous })
+
+	tests := []struct {
+		uri    string
+		depth  string
+		status int
+		hrefs  []string
+	}{
+		{"/docs/a.txt", "0", 207, []string{"/docs/a.txt"}},
+		{"/docs", "0", 207, []string{"/docs/"}},
+		{"/docs/", "1", 207, []string{"/docs/", "/docs/a.txt", "/docs/sub/"}},
+		{"/docs/", "infinity", 207, []string{"/docs/", "/docs/a.txt", "/docs/sub/b.txt", "/docs/sub/"}},
+		{"/missing/", "1", 404, nil},
+	}
+	for _, test := range tests {
+		ctx := serveMethod("PROPFIND", test.uri, map[string]string{"Depth": test.depth})
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("PROPFIND %s depth %s: status %d, want %d", test.uri, test.depth, status, test.status)
+			continue
+		}
+		if test.status != 207 {
+			continue
+		}
+		var multistatus struct {
+			Responses []struct {
+				Href string `xml:"href"`
+			} `xml:"response"`
+		}
+		if err := xml.Unmarshal(ctx.Response.Body(), &multistatus); err != nil {
+			t.Errorf("PROPFIND %s depth %s: %v", test.uri, test.depth, err)
+			continue
+		}
+		hrefs := []string{}
+		for _, response := range multistatus.Responses {
+			hrefs = append(hrefs, response.Href)
+		}
+		if strings.Join(hrefs, " ") != strings.Join(test.hrefs, " ") {
+			t.Errorf("PROPFIND %s depth %s: %v, want %v", test.uri, test.depth, hrefs, test.hrefs)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package nanoweb
+
+import (
+	"archive/zip"
+	"bufio"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var zipDownloadsEnabled = getEnv("ZIP_DOWNLOADS", "0") == "1"
+
+func isZipRequest(ctx *fasthttp.RequestCtx) bool {
+	return zipDownloadsEnabled && string(ctx.QueryArgs().Peek("download")) == "zip"
+}
+
+// Whether a route key is the file itself rather than an index alias or a
+// generated route
+func isFileRoute(urlPath string, route Route) bool {
+	return route.Source != "" && path.Base(urlPath) == filepath.Base(route.Source)
+}
+
+// Collect the file routes below a directory that the request may be served
+func directoryFiles(ctx *fasthttp.RequestCtx, routes Routes, dir string) []string {
+	files := []string{}
+	for urlPath, route := range routes {
+		if strings.HasPrefix(urlPath, dir) && isFileRoute(urlPath, route) && sourceMapAllowed(ctx, urlPath) {
+			files = append(files, urlPath)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Stream a zip archive of a directory's cached contents
+func zipHandler(ctx *fasthttp.RequestCtx, routes Routes, dir string) {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	files := directoryFiles(ctx, routes, dir)
+	if len(files) == 0 {
+		ctx.Error("Not Found", fasthttp.StatusNotFound)
+		return
+	}
+
+	name := path.Base(dir)
+	if name == "/" {
+		name = "site"
+	}
+	ctx.Response.Header.Set("Content-Type", "application/zip")
+	ctx.Response.Header.Set("Content-Disposition", contentDisposition(name+".zip"))
+	snapshot := make([]Route, len(files))
+	for i, urlPath := range files {
+		snapshot[i] = routes[urlPath]
+	}
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		archive := zip.NewWriter(w)
+		for i, urlPath := range files {
+			route := snapshot[i]
+			header := &zip.FileHeader{
+				Name:   strings.TrimPrefix(urlPath, dir),
+				Method: zip.Store,
+			}
+			if compressedType(route.ContentType) {
+				header.Method = zip.Deflate
+			}
+			if modTime, err := http.ParseTime(route.LastModified); err == nil {
+				header.Modified = modTime
+			} else {
+				header.Modified = time.Now()
+			}
+			file, err := archive.CreateHeader(header)
+			if err != nil {
+				logln("⇨ error writing zip entry", urlPath, err)
+				return
+			}
+			route.writeTo(file)
+			w.Flush()
+		}
+		archive.Close()
+	})
+}
@@ -0,0 +1,55 @@
+package nanoweb
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestZipDownloads(t *testing.T) {
+	previous := zipDownloadsEnabled
+	zipDownloadsEnabled = true
+	t.Cleanup(func() { zipDownloadsEnabled = previous })
+	testSite(t, map[string]string{
+		"index.html":          "home",
+		"docs/index.html":     "docs",
+		"docs/guide.txt":      "guide",
+		"docs/images/map.svg": "<svg/>",
+		"docsextra/other.txt": "other",
+	})
+
+	ctx := serve("/docs/?download=zip")
+	if contentType := string(ctx.Response.Header.ContentType()); contentType != "application/zip" {
+		t.Fatalf("Content-Type %q", contentType)
+	}
+	if disposition := string(ctx.Response.Header.Peek("Content-Disposition")); disposition != contentDisposition("docs.zip") {
+		t.Errorf("Content-Disposition %q", disposition)
+	}
+	body := ctx.Response.Body()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each file once, below the directory, without index aliases or
+	// neighbouring directories that share its prefix
+	want := map[string]string{"index.html": "docs", "guide.txt": "guide", "images/map.svg": "<svg/>"}
+	if len(archive.File) != len(want) {
+		t.Errorf("%d files, want %d", len(archive.File), len(want))
+	}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(content) != want[file.Name] {
+			t.Errorf("%s: %q, want %q", file.Name, content, want[file.Name])
+		}
+	}
+
+	if status := serve("/missing/?download=zip").Response.StatusCode(); status != 404 {
+		t.Errorf("missing directory: status %d, want 404", status)
+	}
+}